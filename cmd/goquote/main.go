@@ -10,19 +10,19 @@ func main() {
 	config := &config.Config{}
 
 	cmd := cobra.Command{
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return config.RegisterConfigFile()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := config.RegisterConfigFile()
-			if err != nil {
-				return err
-			}
-
-			err = run(config)
-			return err
+			return run(config)
 		},
 	}
 
 	config.RegisterFlags(cmd.PersistentFlags())
 
+	cmd.AddCommand(migrateCommand(config))
+	cmd.AddCommand(reindexScoresCommand(config))
+
 	err := cmd.Execute()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"goquotebot/pkg/config"
+	"goquotebot/pkg/storages"
+	"goquotebot/pkg/storages/migrations"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func migrateCommand(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema version",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cfg, func(m *migrations.Migrator) error {
+				statuses, err := m.Status()
+				if err != nil {
+					return err
+				}
+				for _, status := range statuses {
+					state := "pending"
+					if status.Applied {
+						state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+					}
+					fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, state)
+				}
+				return nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "up",
+		Short: "Apply every pending migration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cfg, func(m *migrations.Migrator) error {
+				return migrateTo(m, m.Latest())
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "to <n>",
+		Short: "Apply or revert migrations until the schema is at version <n>",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid version %q: %w", args[0], err)
+			}
+			return withMigrator(cfg, func(m *migrations.Migrator) error {
+				return migrateTo(m, version)
+			})
+		},
+	})
+
+	return cmd
+}
+
+func migrateTo(m *migrations.Migrator, version int) error {
+	from, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	err = m.To(version)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("schema migrated from version %d to %d\n", from, version)
+	return nil
+}
+
+func withMigrator(cfg *config.Config, f func(*migrations.Migrator) error) error {
+	var db *sql.DB
+	var newMigrator func(*sql.DB) (*migrations.Migrator, error)
+	var err error
+
+	switch cfg.Storage.Backend {
+	case "", storages.BackendSqlite:
+		if cfg.Storage.Sqlite == nil || cfg.Storage.Sqlite.Path == "" {
+			return errors.New("storage.sqlite.path must be set to run migrations")
+		}
+		db, err = storages.OpenSqlite(*cfg.Storage.Sqlite)
+		newMigrator = migrations.NewSqliteMigrator
+	case storages.BackendPostgres:
+		if cfg.Storage.Postgres == nil || cfg.Storage.Postgres.DSN == "" {
+			return errors.New("storage.postgres.dsn must be set to run migrations")
+		}
+		db, err = storages.OpenPostgres(*cfg.Storage.Postgres)
+		newMigrator = migrations.NewPostgresMigrator
+	default:
+		return fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	return f(m)
+}
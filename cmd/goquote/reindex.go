@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"goquotebot/pkg/config"
+	"goquotebot/pkg/storages"
+
+	"github.com/spf13/cobra"
+)
+
+func reindexScoresCommand(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "reindex-scores",
+		Short: "Recompute the score, upvotes and downvotes of every quote from the votes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := storages.NewDB(cfg.Storage)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			err = db.ReindexScores(context.Background())
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("scores reindexed")
+			return nil
+		},
+	}
+}
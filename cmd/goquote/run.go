@@ -4,6 +4,9 @@ import (
 	"goquotebot/internal/monitoring/logging"
 	"goquotebot/pkg/config"
 	t "goquotebot/pkg/telegram"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
@@ -26,8 +29,13 @@ func run(cfg *config.Config) error {
 	if err != nil {
 		return err
 	}
-	server.Start()
-	defer server.Stop()
+	go server.Start()
 
-	return nil
+	// Stopping the server cancels the requests being handled
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	logger.Info("shutting down", zap.Stringer("signal", sig))
+
+	return server.Stop()
 }
@@ -4,6 +4,7 @@ import (
 	"goquotebot/internal/monitoring/logging"
 	"goquotebot/internal/monitoring/metrics"
 	"goquotebot/pkg/storages"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -20,8 +21,14 @@ type Config struct {
 }
 
 type TelegramConfig struct {
-	Token   string `yaml:"token" mapstructure:"token"`
+	Token string `yaml:"token" mapstructure:"token"`
+	// Groups are the Telegram groups served by the bot, each one has its own quotes
+	Groups []string `yaml:"groups" mapstructure:"groups"`
+	// GroupID is the group served before Groups existed, it is served too and
+	// receives the quotes stored back then
 	GroupID string `yaml:"group_id" mapstructure:"group_id"`
+	// RequestTimeout bounds the handling of each update, 5s by default
+	RequestTimeout time.Duration `yaml:"request_timeout" mapstructure:"request_timeout"`
 }
 
 // RegisterFlags overwrite the configuration with parameter passed with flags
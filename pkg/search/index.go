@@ -0,0 +1,193 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adrg/strutil"
+	"github.com/adrg/strutil/metrics"
+)
+
+const (
+	MetricSorensenDice       = "sorensen-dice"
+	MetricJaccard            = "jaccard"
+	MetricOverlapCoefficient = "overlap-coefficient"
+	MetricLevenshtein        = "levenshtein"
+	MetricJaroWinkler        = "jaro-winkler"
+)
+
+type Config struct {
+	// Metric is the similarity used to score the candidates, sorensen-dice by default
+	Metric string `yaml:"metric" mapstructure:"metric"`
+	// Threshold is the similarity a quote must exceed to be returned, 0.1 by default
+	Threshold float64 `yaml:"threshold" mapstructure:"threshold"`
+	// NgramSize is used to find the candidates and by the n-gram metrics, 2 by default
+	NgramSize int `yaml:"ngram_size" mapstructure:"ngram_size"`
+}
+
+// Match is a quote similar to the searched expression
+type Match struct {
+	QuoteID    int
+	Similarity float64
+}
+
+// Index keeps the n-grams of the quotes in memory. Only the quotes sharing at
+// least one n-gram with the expression are scored with the metric.
+type Index struct {
+	mu       sync.RWMutex
+	contents map[int]string
+	// ngrams maps an n-gram to the number of times it appears in each quote
+	ngrams map[string]map[int]int
+	// sizes is the total number of n-grams of each quote
+	sizes map[int]int
+
+	metric    strutil.StringMetric
+	threshold float64
+	ngramSize int
+	// bounded is set when the metric cannot exceed the Sorensen-Dice
+	// coefficient of the n-grams, so that candidates can be skipped unscored
+	bounded bool
+}
+
+func NewIndex(cfg Config) (*Index, error) {
+	index := &Index{
+		contents:  make(map[int]string),
+		ngrams:    make(map[string]map[int]int),
+		sizes:     make(map[int]int),
+		threshold: cfg.Threshold,
+		ngramSize: cfg.NgramSize,
+	}
+	if index.threshold == 0 {
+		index.threshold = 0.1
+	}
+	if index.ngramSize == 0 {
+		index.ngramSize = 2
+	}
+
+	switch cfg.Metric {
+	case "", MetricSorensenDice:
+		index.metric = &metrics.SorensenDice{CaseSensitive: true, NgramSize: index.ngramSize}
+		index.bounded = true
+	case MetricJaccard:
+		index.metric = &metrics.Jaccard{CaseSensitive: true, NgramSize: index.ngramSize}
+		index.bounded = true
+	case MetricOverlapCoefficient:
+		index.metric = &metrics.OverlapCoefficient{CaseSensitive: true, NgramSize: index.ngramSize}
+	case MetricLevenshtein:
+		index.metric = metrics.NewLevenshtein()
+	case MetricJaroWinkler:
+		index.metric = metrics.NewJaroWinkler()
+	default:
+		return nil, fmt.Errorf("unknown search metric %q", cfg.Metric)
+	}
+
+	return index, nil
+}
+
+// Add indexes the content of a quote, replacing its previous content
+func (i *Index) Add(quoteID int, content string) {
+	content = strings.ToLower(content)
+	ngrams, size := ngramCounts(content, i.ngramSize)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(quoteID)
+	i.contents[quoteID] = content
+	i.sizes[quoteID] = size
+	for ngram, count := range ngrams {
+		if i.ngrams[ngram] == nil {
+			i.ngrams[ngram] = make(map[int]int)
+		}
+		i.ngrams[ngram][quoteID] = count
+	}
+}
+
+func (i *Index) Remove(quoteID int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(quoteID)
+}
+
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.contents)
+}
+
+// Search returns at most max quotes (all of them if max is negative) whose
+// similarity with the expression exceeds the threshold, the closest first
+func (i *Index) Search(expression string, max int) []Match {
+	expression = strings.ToLower(expression)
+	ngrams, size := ngramCounts(expression, i.ngramSize)
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	// Number of n-grams shared with each candidate, as counted by the n-gram metrics
+	common := make(map[int]int)
+	for ngram, count := range ngrams {
+		for quoteID, quoteCount := range i.ngrams[ngram] {
+			if quoteCount < count {
+				common[quoteID] += quoteCount
+			} else {
+				common[quoteID] += count
+			}
+		}
+	}
+
+	matches := make([]Match, 0)
+	for quoteID, shared := range common {
+		if i.bounded && 2*float64(shared)/float64(size+i.sizes[quoteID]) <= i.threshold {
+			continue
+		}
+		similarity := i.metric.Compare(expression, i.contents[quoteID])
+		if similarity > i.threshold {
+			matches = append(matches, Match{QuoteID: quoteID, Similarity: similarity})
+		}
+	}
+
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].Similarity != matches[b].Similarity {
+			return matches[a].Similarity > matches[b].Similarity
+		}
+		return matches[a].QuoteID > matches[b].QuoteID
+	})
+	if max >= 0 && len(matches) > max {
+		matches = matches[:max]
+	}
+	return matches
+}
+
+func (i *Index) remove(quoteID int) {
+	content, ok := i.contents[quoteID]
+	if !ok {
+		return
+	}
+
+	ngrams, _ := ngramCounts(content, i.ngramSize)
+	for ngram := range ngrams {
+		delete(i.ngrams[ngram], quoteID)
+		if len(i.ngrams[ngram]) == 0 {
+			delete(i.ngrams, ngram)
+		}
+	}
+	delete(i.contents, quoteID)
+	delete(i.sizes, quoteID)
+}
+
+// ngramCounts splits s the way strutil does for its n-gram metrics
+func ngramCounts(s string, size int) (map[string]int, int) {
+	runes := []rune(s)
+	ngrams := make(map[string]int)
+	total := 0
+	for start := 0; start+size <= len(runes); start++ {
+		ngrams[string(runes[start:start+size])]++
+		total++
+	}
+	return ngrams, total
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var corpus = map[int]string{
+	101: "I never said I was a morning person",
+	102: "Who put pineapple on my pizza again?",
+	103: "The printer knows when you are in a hurry",
+	104: "Quantum physics is just spicy statistics",
+	105: "My cat filed a complaint about Mondays",
+	106: "Coffee first, questions later, apologies never",
+}
+
+func newCorpusIndex(t *testing.T, cfg Config) *Index {
+	index, err := NewIndex(cfg)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	for quoteID, content := range corpus {
+		index.Add(quoteID, content)
+	}
+	return index
+}
+
+func matchIDs(matches []Match) []int {
+	ids := make([]int, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, match.QuoteID)
+	}
+	return ids
+}
+
+func TestNewIndex(t *testing.T) {
+	samples := []struct {
+		Metric        string
+		ErrorExpected bool
+	}{
+		{Metric: "", ErrorExpected: false},
+		{Metric: MetricSorensenDice, ErrorExpected: false},
+		{Metric: MetricJaccard, ErrorExpected: false},
+		{Metric: MetricOverlapCoefficient, ErrorExpected: false},
+		{Metric: MetricLevenshtein, ErrorExpected: false},
+		{Metric: MetricJaroWinkler, ErrorExpected: false},
+		{Metric: "soundex", ErrorExpected: true},
+	}
+
+	for _, sample := range samples {
+		_, err := NewIndex(Config{Metric: sample.Metric})
+		if (err != nil) != sample.ErrorExpected {
+			t.Errorf("got error %v for metric %q", err, sample.Metric)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	index := newCorpusIndex(t, Config{})
+
+	samples := []struct {
+		Expression string
+		Max        int
+		Expected   []int
+	}{
+		{Expression: "PINEAPPLE on pizza", Max: 1, Expected: []int{102}},
+		{Expression: "morning person", Max: 1, Expected: []int{101}},
+		{Expression: "zzzz", Max: 5, Expected: []int{}},
+		{Expression: "a", Max: 5, Expected: []int{}},
+	}
+
+	for _, sample := range samples {
+		got := matchIDs(index.Search(sample.Expression, sample.Max))
+		if fmt.Sprint(got) != fmt.Sprint(sample.Expected) {
+			t.Errorf("got %v, wanted %v for %q", got, sample.Expected, sample.Expression)
+		}
+	}
+
+	matches := index.Search("never", -1)
+	for i := 1; i < len(matches); i++ {
+		if matches[i].Similarity > matches[i-1].Similarity {
+			t.Errorf("got %v, matches should be sorted by similarity", matches)
+		}
+	}
+	if len(index.Search("never", 1)) != 1 {
+		t.Errorf("got more than 1 match")
+	}
+}
+
+func TestIndexUpdates(t *testing.T) {
+	index := newCorpusIndex(t, Config{})
+
+	index.Remove(102)
+	index.Remove(999)
+	for _, match := range index.Search("pineapple on pizza", -1) {
+		if match.QuoteID == 102 {
+			t.Errorf("got %v, the removed quote should not match", match)
+		}
+	}
+	if index.Len() != len(corpus)-1 {
+		t.Errorf("got %d quotes, wanted %d", index.Len(), len(corpus)-1)
+	}
+
+	index.Add(107, "Pineapple belongs on pizza")
+	if got := matchIDs(index.Search("pineapple on pizza", 1)); fmt.Sprint(got) != "[107]" {
+		t.Errorf("got %v, wanted [107]", got)
+	}
+
+	// Adding a quote again replaces its content
+	index.Add(107, "Quantum pizza")
+	for _, match := range index.Search("pineapple belongs", -1) {
+		if match.QuoteID == 107 {
+			t.Errorf("got %v, the old content should not match", match)
+		}
+	}
+	if index.Len() != len(corpus) {
+		t.Errorf("got %d quotes, wanted %d", index.Len(), len(corpus))
+	}
+}
+
+// The n-gram pruning must return what scoring every quote would
+func TestIndexPruning(t *testing.T) {
+	words := []string{"pizza", "never", "coffee", "cat", "quantum", "printer", "morning", "the", "a", "is", "on", "my"}
+	sentence := func(r *rand.Rand) string {
+		s := words[r.Intn(len(words))]
+		for n := r.Intn(8); n > 0; n-- {
+			s += " " + words[r.Intn(len(words))]
+		}
+		return s
+	}
+
+	for _, metric := range []string{MetricSorensenDice, MetricJaccard, MetricOverlapCoefficient} {
+		r := rand.New(rand.NewSource(1))
+		index, err := NewIndex(Config{Metric: metric, Threshold: 0.3})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		contents := make(map[int]string)
+		for quoteID := 0; quoteID < 300; quoteID++ {
+			contents[quoteID] = sentence(r)
+			index.Add(quoteID, contents[quoteID])
+		}
+
+		for n := 0; n < 50; n++ {
+			expression := sentence(r)
+			expected := 0
+			for _, content := range contents {
+				if index.metric.Compare(expression, content) > 0.3 {
+					expected++
+				}
+			}
+			if got := len(index.Search(expression, -1)); got != expected {
+				t.Errorf("got %d matches, wanted %d for %q with %s", got, expected, expression, metric)
+			}
+		}
+	}
+}
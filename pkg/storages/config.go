@@ -1,9 +1,71 @@
 package storages
 
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"goquotebot/pkg/search"
+)
+
+const (
+	BackendSqlite   = "sqlite"
+	BackendPostgres = "postgres"
+)
+
 type Config struct {
-	Sqlite *SqliteConfig `yaml:"sqlite" mapstructure:"sqlite"`
+	// Backend is either sqlite (default) or postgres
+	Backend  string          `yaml:"backend" mapstructure:"backend"`
+	Sqlite   *SqliteConfig   `yaml:"sqlite" mapstructure:"sqlite"`
+	Postgres *PostgresConfig `yaml:"postgres" mapstructure:"postgres"`
+	// Search configures the index used by SearchExpression
+	Search search.Config `yaml:"search" mapstructure:"search"`
+	// Duplicates configures the index AddQuote looks for duplicates in, its
+	// threshold defaults to 0.45
+	Duplicates search.Config `yaml:"duplicates" mapstructure:"duplicates"`
+	// Retention is how long deleted quotes stay in the trash, forever when 0
+	Retention time.Duration `yaml:"retention" mapstructure:"retention"`
 }
 
 type SqliteConfig struct {
 	Path string `yaml:"path" mapstructure:"path"`
+	// JournalMode defaults to WAL
+	JournalMode string `yaml:"journal_mode" mapstructure:"journal_mode"`
+	// BusyTimeout defaults to 5s
+	BusyTimeout time.Duration `yaml:"busy_timeout" mapstructure:"busy_timeout"`
+	// Synchronous defaults to NORMAL
+	Synchronous string `yaml:"synchronous" mapstructure:"synchronous"`
+}
+
+type PostgresConfig struct {
+	DSN             string        `yaml:"dsn" mapstructure:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns" mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" mapstructure:"conn_max_lifetime"`
+}
+
+// DSN returns the go-sqlite3 data source name, with the pragmas set on every connection
+func (cfg SqliteConfig) DSN() string {
+	journalMode := cfg.JournalMode
+	if journalMode == "" {
+		journalMode = "WAL"
+	}
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = 5 * time.Second
+	}
+	synchronous := cfg.Synchronous
+	if synchronous == "" {
+		synchronous = "NORMAL"
+	}
+
+	params := url.Values{}
+	params.Set("_journal_mode", journalMode)
+	params.Set("_busy_timeout", fmt.Sprint(busyTimeout.Milliseconds()))
+	params.Set("_synchronous", synchronous)
+	params.Set("_foreign_keys", "on")
+
+	// The path is escaped, SQLite would read its ?, # and % as parts of the URI
+	path := (&url.URL{Path: cfg.Path}).EscapedPath()
+	return (&url.URL{Scheme: "file", Opaque: path, RawQuery: params.Encode()}).String()
 }
@@ -0,0 +1,1642 @@
+package storages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"goquotebot/pkg/search"
+	"goquotebot/pkg/storages/migrations"
+)
+
+// conformanceQuotes are different enough not to be flagged as duplicates of each other
+var conformanceQuotes = []AddQuoteRequest{
+	{Author: "alice", Content: "I never said I was a morning person", QuoteContext: "Bob"},
+	{Author: "bob", Content: "Who put pineapple on my pizza again?", QuoteContext: "Carol"},
+	{Author: "carol", Content: "The printer knows when you are in a hurry", QuoteContext: "Dave"},
+	{Author: "dave", Content: "Quantum physics is just spicy statistics", QuoteContext: "Erin"},
+	{Author: "erin", Content: "My cat filed a complaint about Mondays", QuoteContext: "Frank"},
+	{Author: "frank", Content: "Coffee first, questions later, apologies never", QuoteContext: "Alice"},
+}
+
+func TestSqliteConformance(t *testing.T) {
+	testConformance(t, func(t *testing.T) DB {
+		db, err := NewSqliteWrapper(SqliteConfig{Path: filepath.Join(t.TempDir(), "test.db")})
+		if err != nil {
+			skipWithoutFullText(t, err)
+			t.Fatalf("error %v should not have occured", err)
+		}
+		return db
+	})
+}
+
+// TestPostgresConformance runs against the server given by GOQUOTE_TEST_POSTGRES_DSN,
+// e.g. the one started by `docker-compose --profile postgres up -d postgres`. Its tables are dropped.
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("GOQUOTE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GOQUOTE_TEST_POSTGRES_DSN is not set")
+	}
+
+	testConformance(t, func(t *testing.T) DB {
+		db, err := NewPostgresStore(PostgresConfig{DSN: dsn})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+
+		// Start every test from an empty schema
+		migrator, err := migrations.NewPostgresMigrator(db.(*PostgresStore).DB)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		err = migrator.To(0)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		err = migrator.Up()
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		return db
+	})
+}
+
+func TestMemoryConformance(t *testing.T) {
+	testConformance(t, func(t *testing.T) DB {
+		return NewMemoryStore()
+	})
+}
+
+func TestIndexedConformance(t *testing.T) {
+	testConformance(t, func(t *testing.T) DB {
+		db, err := NewIndexedDB(NewMemoryStore(), search.Config{}, search.Config{})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		return db
+	})
+}
+
+// testConformance checks the behaviour every DB implementation must share
+func testConformance(t *testing.T, newDB func(t *testing.T) DB) {
+	tests := []struct {
+		Name string
+		Run  func(*testing.T, DB)
+	}{
+		{Name: "AddQuote", Run: testAddQuote},
+		{Name: "AddQuoteForbiddenContext", Run: testAddQuoteForbiddenContext},
+		{Name: "AddQuoteDuplicate", Run: testAddQuoteDuplicate},
+		{Name: "DeleteQuote", Run: testDeleteQuote},
+		{Name: "Trash", Run: testTrash},
+		{Name: "EditQuote", Run: testEditQuote},
+		{Name: "RollbackQuote", Run: testRollbackQuote},
+		{Name: "GetQuotes", Run: testGetQuotes},
+		{Name: "GetLastQuotes", Run: testGetLastQuotes},
+		{Name: "GetRandomQuotes", Run: testGetRandomQuotes},
+		{Name: "Votes", Run: testVotes},
+		{Name: "ConcurrentVotes", Run: testConcurrentVotes},
+		{Name: "TopAndFlop", Run: testTopAndFlop},
+		{Name: "SearchWord", Run: testSearchWord},
+		{Name: "SearchExpression", Run: testSearchExpression},
+		{Name: "Pages", Run: testPages},
+		{Name: "Speakers", Run: testSpeakers},
+		{Name: "Tags", Run: testTags},
+		{Name: "Dialogues", Run: testDialogues},
+		{Name: "Replies", Run: testReplies},
+		{Name: "Media", Run: testMedia},
+		{Name: "Posts", Run: testPosts},
+		{Name: "Groups", Run: testGroups},
+		{Name: "AdoptQuotes", Run: testAdoptQuotes},
+		{Name: "CanceledContext", Run: testCanceledContext},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			db := newDB(t)
+			defer db.Close()
+			test.Run(t, db)
+		})
+	}
+}
+
+// mustAddQuotes stores the quotes and returns their IDs, in the same order
+func mustAddQuotes(t *testing.T, db DB, quotes ...AddQuoteRequest) []int {
+	t.Helper()
+	ctx := context.Background()
+	ids := make([]int, 0, len(quotes))
+	for _, quote := range quotes {
+		added, err := db.AddQuote(ctx, quote)
+		if err != nil {
+			t.Fatalf("failed to add %q: %v", quote.Content, err)
+		}
+		ids = append(ids, added.QuoteID)
+	}
+	return ids
+}
+
+// inChat returns the quotes as added in the group
+func inChat(chatID int64, quotes ...AddQuoteRequest) []AddQuoteRequest {
+	scoped := make([]AddQuoteRequest, 0, len(quotes))
+	for _, quote := range quotes {
+		quote.ChatID = chatID
+		scoped = append(scoped, quote)
+	}
+	return scoped
+}
+
+func quoteIDs(quotes []QuoteResponse) []int {
+	ids := make([]int, 0, len(quotes))
+	for _, quote := range quotes {
+		ids = append(ids, quote.QuoteID)
+	}
+	return ids
+}
+
+func sortedQuoteIDs(quotes []QuoteResponse) []int {
+	ids := quoteIDs(quotes)
+	sort.Ints(ids)
+	return ids
+}
+
+func stringIDs(ids ...int) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, fmt.Sprint(id))
+	}
+	return res
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testAddQuote(t *testing.T, db DB) {
+	ctx := context.Background()
+	added, err := db.AddQuote(ctx, conformanceQuotes[0])
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if added.QuoteID <= 100 {
+		t.Errorf("got quote ID %d, IDs should start after 100", added.QuoteID)
+	}
+	ids := []int{added.QuoteID}
+
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids...)})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 1 {
+		t.Fatalf("got %d quotes, wanted 1", len(quotes))
+	}
+	quote := quotes[0]
+	if added.Content != quote.Content || added.QuoteContext != quote.QuoteContext || added.Author != quote.Author || !added.IsActive {
+		t.Errorf("AddQuote returned %+v, stored %+v", added, quote)
+	}
+	expected := conformanceQuotes[0]
+	if quote.Author != expected.Author || quote.Content != expected.Content || quote.QuoteContext != expected.QuoteContext {
+		t.Errorf("got %+v, wanted %+v", quote, expected)
+	}
+	if !quote.IsActive || quote.Votes != 0 || quote.CreatedAt.IsZero() || !quote.DeletedAt.IsZero() {
+		t.Errorf("unexpected state for a new quote: %+v", quote)
+	}
+
+	ids = append(ids, mustAddQuotes(t, db, conformanceQuotes[1])...)
+	if ids[1] <= ids[0] {
+		t.Errorf("got IDs %v, they should be increasing", ids)
+	}
+}
+
+func testAddQuoteForbiddenContext(t *testing.T, db DB) {
+	ctx := context.Background()
+	_, err := db.AddQuote(ctx, AddQuoteRequest{Author: "alice", Content: "Nobody knows who said this", QuoteContext: "Anonyme"})
+	if !errors.Is(err, ErrForbiddenContext) {
+		t.Errorf("got error %v, wanted %v", err, ErrForbiddenContext)
+	}
+
+	quotes, err := db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 0 {
+		t.Errorf("got %d quotes, the rejected quote should not be stored", len(quotes))
+	}
+}
+
+func testAddQuoteDuplicate(t *testing.T, db DB) {
+	ctx := context.Background()
+	// The duplicated quote is older than the last 5 ones
+	ids := mustAddQuotes(t, db, conformanceQuotes[:6]...)
+
+	duplicate := conformanceQuotes[0]
+	duplicate.Author = "someone else"
+	_, err := db.AddQuote(ctx, duplicate)
+	var duplicateErr ErrProbableDuplicate
+	if !errors.As(err, &duplicateErr) {
+		t.Fatalf("got error %v, a duplicated quote should be rejected", err)
+	}
+	if len(duplicateErr.Matches) == 0 || duplicateErr.Matches[0].QuoteID != ids[0] || duplicateErr.Matches[0].Similarity < 0.45 {
+		t.Errorf("got %+v, wanted a duplicate of quote %d", duplicateErr, ids[0])
+	}
+	if duplicateErr.NearMiss() {
+		t.Errorf("got %+v, an identical quote is not a near miss", duplicateErr)
+	}
+
+	// Identical quotes cannot be forced
+	duplicate.Force = true
+	_, err = db.AddQuote(ctx, duplicate)
+	if !errors.As(err, &duplicateErr) {
+		t.Errorf("got error %v, a forced identical quote should be rejected", err)
+	}
+
+	nearMiss := AddQuoteRequest{Author: "bob", Content: "I never said I was a morning person!!", QuoteContext: "Bob"}
+	_, err = db.AddQuote(ctx, nearMiss)
+	if !errors.As(err, &duplicateErr) || !duplicateErr.NearMiss() {
+		t.Fatalf("got error %v, wanted a near miss", err)
+	}
+	nearMiss.Force = true
+	added, err := db.AddQuote(ctx, nearMiss)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	quotes, err := db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 7 || quotes[0].QuoteID != added.QuoteID {
+		t.Errorf("got %v, wanted the 6 quotes and the forced one", quoteIDs(quotes))
+	}
+}
+
+func testDeleteQuote(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[0], conformanceQuotes[1])
+
+	err := db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: ids[0], Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: ids[0], Deleter: "alice"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v when deleting a quote twice, wanted %v", err, ErrNotFound)
+	}
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: 99999, Deleter: "alice"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v when deleting an unknown quote, wanted %v", err, ErrNotFound)
+	}
+
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids...)})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), ids[1:]) {
+		t.Errorf("got %v, the deleted quote should be hidden", quoteIDs(quotes))
+	}
+
+	quotes, err = db.GetRandomQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), ids[1:]) {
+		t.Errorf("got %v, the deleted quote should be hidden", quoteIDs(quotes))
+	}
+
+	quotes, err = db.SearchWord(ctx, SearchExpressionRequest{Expression: "morning", QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 0 {
+		t.Errorf("got %v, the deleted quote should not be searchable", quoteIDs(quotes))
+	}
+
+	// Deleted quotes are no longer compared against new ones
+	mustAddQuotes(t, db, conformanceQuotes[0])
+}
+
+func testTrash(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:3]...)
+	err := db.UpVoteQuote(ctx, VoteQuoteRequest{QuoteID: ids[0], Voter: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	for _, quoteID := range ids {
+		err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: quoteID, Deleter: "alice"})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+	}
+
+	trash, err := db.GetTrash(ctx, TrashRequest{QuoteNb: 2})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(trash), []int{ids[2], ids[1]}) {
+		t.Errorf("got %v, wanted the last deleted quotes first", quoteIDs(trash))
+	}
+	for _, quote := range trash {
+		if quote.IsActive || quote.DeletedBy != "alice" || quote.DeletedAt.IsZero() {
+			t.Errorf("got %+v, wanted a quote deleted by alice", quote)
+		}
+	}
+	trash, err = db.GetTrash(ctx, TrashRequest{QuoteNb: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(trash), []int{ids[0]}) {
+		t.Errorf("got %v on the second page, wanted %v", quoteIDs(trash), ids[:1])
+	}
+
+	restored, err := db.RestoreQuote(ctx, UniqueSpecifiedQuoteRequest{QuoteID: ids[0]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !restored.IsActive || restored.DeletedBy != "" || !restored.DeletedAt.IsZero() || restored.Votes != 1 {
+		t.Errorf("got %+v, wanted an available quote keeping its vote", restored)
+	}
+	quotes, err := db.SearchExpression(ctx, SearchExpressionRequest{Expression: conformanceQuotes[0].Content, QuoteNb: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), ids[:1]) {
+		t.Errorf("got %v, the restored quote should be searchable", quoteIDs(quotes))
+	}
+
+	err = db.PurgeQuote(ctx, UniqueSpecifiedQuoteRequest{QuoteID: ids[1]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// Only trashed quotes can be restored or purged
+	for _, quoteID := range []int{ids[0], ids[1], 99999} {
+		_, err = db.RestoreQuote(ctx, UniqueSpecifiedQuoteRequest{QuoteID: quoteID})
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v restoring quote %d, wanted %v", err, quoteID, ErrNotFound)
+		}
+		err = db.PurgeQuote(ctx, UniqueSpecifiedQuoteRequest{QuoteID: quoteID})
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v purging quote %d, wanted %v", err, quoteID, ErrNotFound)
+		}
+	}
+
+	purged, err := db.PurgeTrash(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if purged != 0 {
+		t.Errorf("got %d purged quotes, the trash is younger than the retention", purged)
+	}
+	// Deletion dates are stored to the second
+	time.Sleep(1100 * time.Millisecond)
+	purged, err = db.PurgeTrash(ctx, 0)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if purged != 1 {
+		t.Errorf("got %d purged quotes, wanted 1", purged)
+	}
+	trash, err = db.GetTrash(ctx, TrashRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("got %v, the trash should be empty", quoteIDs(trash))
+	}
+	quotes, err = db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), ids[:1]) {
+		t.Errorf("got %v, only the restored quote should be left", quoteIDs(quotes))
+	}
+}
+
+func testEditQuote(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:2]...)
+
+	edited, err := db.EditQuote(ctx, EditQuoteRequest{QuoteID: ids[0], Content: "I never said I was a morning bird", QuoteContext: "Bobby", Editor: "carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if edited.QuoteID != ids[0] || edited.Content != "I never said I was a morning bird" || edited.QuoteContext != "Bobby" || edited.Author != conformanceQuotes[0].Author {
+		t.Errorf("got %+v after the edit", edited)
+	}
+	quotes, err := db.SearchWord(ctx, SearchExpressionRequest{Expression: "bird", QuoteNb: 5})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), []int{ids[0]}) {
+		t.Errorf("got %v, the edited content should be searchable", quoteIDs(quotes))
+	}
+
+	// An edit changing nothing is not recorded
+	_, err = db.EditQuote(ctx, EditQuoteRequest{QuoteID: ids[0], Content: "I never said I was a morning bird", QuoteContext: "Bobby", Editor: "carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	revisions, err := db.GetRevisions(ctx, UniqueSpecifiedQuoteRequest{QuoteID: ids[0]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("got %d revisions, wanted 2", len(revisions))
+	}
+	first, second := revisions[0], revisions[1]
+	if first.Revision != 1 || first.Content != conformanceQuotes[0].Content || first.Editor != conformanceQuotes[0].Author || first.Diff != "" || first.EditedAt.IsZero() {
+		t.Errorf("unexpected first revision %+v", first)
+	}
+	if second.Revision != 2 || second.Editor != "carol" || second.Diff != "content: I never said I was a morning [-person-] {+bird+}\ncontext: [-Bob-] {+Bobby+}" || second.EditedAt.IsZero() {
+		t.Errorf("unexpected second revision %+v", second)
+	}
+
+	_, err = db.EditQuote(ctx, EditQuoteRequest{QuoteID: ids[1], Content: "Nobody knows", QuoteContext: "Anonyme", Editor: "carol"})
+	if !errors.Is(err, ErrForbiddenContext) {
+		t.Errorf("got error %v, wanted %v", err, ErrForbiddenContext)
+	}
+
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: ids[1], Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	for _, quoteID := range []int{ids[1], 99999} {
+		_, err = db.EditQuote(ctx, EditQuoteRequest{QuoteID: quoteID, Content: "content", QuoteContext: "context", Editor: "carol"})
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v editing quote %d, wanted %v", err, quoteID, ErrNotFound)
+		}
+		_, err = db.GetRevisions(ctx, UniqueSpecifiedQuoteRequest{QuoteID: quoteID})
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v for the revisions of quote %d, wanted %v", err, quoteID, ErrNotFound)
+		}
+	}
+}
+
+func testRollbackQuote(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[0])
+
+	_, err := db.EditQuote(ctx, EditQuoteRequest{QuoteID: ids[0], Content: "I never said I was a night owl", QuoteContext: "Bob", Editor: "carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	quote, err := db.RollbackQuote(ctx, RollbackQuoteRequest{QuoteID: ids[0], Revision: 1, Editor: "admin"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if quote.Content != conformanceQuotes[0].Content || quote.QuoteContext != conformanceQuotes[0].QuoteContext {
+		t.Errorf("got %+v, wanted the first revision", quote)
+	}
+
+	// The rollback is a revision too, so that it can be rolled back
+	revisions, err := db.GetRevisions(ctx, UniqueSpecifiedQuoteRequest{QuoteID: ids[0]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(revisions) != 3 || revisions[2].Editor != "admin" || revisions[2].Content != conformanceQuotes[0].Content {
+		t.Errorf("got %+v, wanted a third revision by admin", revisions)
+	}
+
+	for _, request := range []RollbackQuoteRequest{{QuoteID: ids[0], Revision: 4}, {QuoteID: 99999, Revision: 1}} {
+		_, err = db.RollbackQuote(ctx, request)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("got error %v for %+v, wanted %v", err, request, ErrNotFound)
+		}
+	}
+}
+
+func testGetQuotes(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:4]...)
+
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids[3], ids[1], 99999)})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(sortedQuoteIDs(quotes), []int{ids[1], ids[3]}) {
+		t.Errorf("got %v, wanted %v", quoteIDs(quotes), []int{ids[1], ids[3]})
+	}
+
+	quotes, err = db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 0 {
+		t.Errorf("got %v, wanted no quote", quoteIDs(quotes))
+	}
+}
+
+func testGetLastQuotes(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:4]...)
+
+	quotes, err := db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 3})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := []int{ids[3], ids[2], ids[1]}
+	if !equalIDs(quoteIDs(quotes), expected) {
+		t.Errorf("got %v, wanted %v", quoteIDs(quotes), expected)
+	}
+}
+
+func testGetRandomQuotes(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:4]...)
+
+	quotes, err := db.GetRandomQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 2})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 2 {
+		t.Errorf("got %d quotes, wanted 2", len(quotes))
+	}
+
+	quotes, err = db.GetRandomQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(sortedQuoteIDs(quotes), ids) {
+		t.Errorf("got %v, wanted %v", sortedQuoteIDs(quotes), ids)
+	}
+}
+
+func testVotes(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[0])
+
+	votes := func() int {
+		t.Helper()
+		quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids...)})
+		if err != nil || len(quotes) != 1 {
+			t.Fatalf("failed to fetch the quote: %v", err)
+		}
+		return quotes[0].Votes
+	}
+
+	steps := []struct {
+		Vote     func(context.Context, VoteQuoteRequest) error
+		Voter    int64
+		Expected int
+	}{
+		{Vote: db.UpVoteQuote, Voter: 1, Expected: 1},
+		{Vote: db.UpVoteQuote, Voter: 1, Expected: 1},
+		{Vote: db.DownVoteQuote, Voter: 1, Expected: -1},
+		{Vote: db.UpVoteQuote, Voter: 2, Expected: 0},
+		{Vote: db.UpVoteQuote, Voter: 3, Expected: 1},
+		{Vote: db.UnVoteQuote, Voter: 1, Expected: 2},
+		{Vote: db.UnVoteQuote, Voter: 1, Expected: 2},
+	}
+
+	for i, step := range steps {
+		err := step.Vote(ctx, VoteQuoteRequest{QuoteID: ids[0], Voter: step.Voter})
+		if err != nil {
+			t.Fatalf("error %v should not have occured at step %d", err, i)
+		}
+		if got := votes(); got != step.Expected {
+			t.Errorf("got %d votes at step %d, wanted %d", got, i, step.Expected)
+		}
+	}
+
+	err := db.DownVoteQuote(ctx, VoteQuoteRequest{QuoteID: ids[0], Voter: 4})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = db.ReindexScores(ctx)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids...)})
+	if err != nil || len(quotes) != 1 {
+		t.Fatalf("failed to fetch the quote: %v", err)
+	}
+	if quotes[0].Votes != 1 || quotes[0].UpVotes != 2 || quotes[0].DownVotes != 1 {
+		t.Errorf("got %d votes (+%d -%d), wanted 1 (+2 -1)", quotes[0].Votes, quotes[0].UpVotes, quotes[0].DownVotes)
+	}
+
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: ids[0], Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	for _, vote := range []func(context.Context, VoteQuoteRequest) error{db.UpVoteQuote, db.DownVoteQuote, db.UnVoteQuote} {
+		for _, quoteID := range []int{ids[0], 99999} {
+			err := vote(ctx, VoteQuoteRequest{QuoteID: quoteID, Voter: 1})
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("got error %v when voting for quote %d, wanted %v", err, quoteID, ErrNotFound)
+			}
+		}
+	}
+}
+
+func testConcurrentVotes(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[0])
+
+	// Fast taps from the same voters must never be counted twice
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		for _, voter := range []int64{1, 2} {
+			wg.Add(1)
+			go func(voter int64) {
+				defer wg.Done()
+				errs <- db.UpVoteQuote(ctx, VoteQuoteRequest{QuoteID: ids[0], Voter: voter})
+			}(voter)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+	}
+
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids...)})
+	if err != nil || len(quotes) != 1 {
+		t.Fatalf("failed to fetch the quote: %v", err)
+	}
+	if quotes[0].Votes != 2 {
+		t.Errorf("got %d votes, wanted 2", quotes[0].Votes)
+	}
+}
+
+func testTopAndFlop(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:6]...)
+	best, good, neutral, bad, unvoted, deleted := ids[0], ids[1], ids[2], ids[3], ids[4], ids[5]
+	_ = unvoted
+
+	votes := []struct {
+		Vote    func(context.Context, VoteQuoteRequest) error
+		QuoteID int
+		Voter   int64
+	}{
+		{Vote: db.UpVoteQuote, QuoteID: best, Voter: 1},
+		{Vote: db.UpVoteQuote, QuoteID: best, Voter: 2},
+		{Vote: db.UpVoteQuote, QuoteID: good, Voter: 1},
+		{Vote: db.UpVoteQuote, QuoteID: neutral, Voter: 1},
+		{Vote: db.DownVoteQuote, QuoteID: neutral, Voter: 2},
+		{Vote: db.DownVoteQuote, QuoteID: bad, Voter: 1},
+		{Vote: db.UpVoteQuote, QuoteID: deleted, Voter: 1},
+		{Vote: db.UpVoteQuote, QuoteID: deleted, Voter: 2},
+		{Vote: db.UpVoteQuote, QuoteID: deleted, Voter: 3},
+	}
+	for _, vote := range votes {
+		err := vote.Vote(ctx, VoteQuoteRequest{QuoteID: vote.QuoteID, Voter: vote.Voter})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+	}
+	err := db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: deleted, Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	quotes, err := db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := []int{best, good, neutral}
+	if !equalIDs(quoteIDs(quotes), expected) {
+		t.Errorf("got top %v, wanted %v", quoteIDs(quotes), expected)
+	}
+
+	quotes, err = db.GetFlopQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected = []int{bad, neutral}
+	if !equalIDs(quoteIDs(quotes), expected) {
+		t.Errorf("got flop %v, wanted %v", quoteIDs(quotes), expected)
+	}
+
+	quotes, err = db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), []int{best}) {
+		t.Errorf("got top %v, wanted %v", quoteIDs(quotes), []int{best})
+	}
+}
+
+func testSearchWord(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:6]...)
+
+	samples := []struct {
+		Input    SearchExpressionRequest
+		Expected []int
+	}{
+		{
+			Input:    SearchExpressionRequest{Expression: "pizza", QuoteNb: 5},
+			Expected: []int{ids[1]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "PRINTER", QuoteNb: 5},
+			Expected: []int{ids[2]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "never", QuoteNb: 5},
+			Expected: []int{ids[0], ids[5]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "elephant", QuoteNb: 5},
+			Expected: []int{},
+		},
+	}
+
+	for _, sample := range samples {
+		quotes, err := db.SearchWord(ctx, sample.Input)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if !equalIDs(sortedQuoteIDs(quotes), sample.Expected) {
+			t.Errorf("got %v, wanted %v for %q", sortedQuoteIDs(quotes), sample.Expected, sample.Input.Expression)
+		}
+	}
+
+	quotes, err := db.SearchWord(ctx, SearchExpressionRequest{Expression: "never", QuoteNb: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 1 {
+		t.Errorf("got %d quotes, wanted 1", len(quotes))
+	}
+
+	// Full-text search: word prefixes, in the content or the context, by relevance
+	samples = []struct {
+		Input    SearchExpressionRequest
+		Expected []int
+	}{
+		{
+			Input:    SearchExpressionRequest{Expression: "pine", QuoteNb: 5},
+			Expected: []int{ids[1]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "ever", QuoteNb: 5},
+			Expected: []int{},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "carol", QuoteNb: 5},
+			Expected: []int{ids[1]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "cat mondays", QuoteNb: 5},
+			Expected: []int{ids[4]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "cat pizza", QuoteNb: 5},
+			Expected: []int{},
+		}, {
+			Input:    SearchExpressionRequest{Expression: `"quantum" OR (physics*`, QuoteNb: 5},
+			Expected: []int{},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "!!!", QuoteNb: 5},
+			Expected: []int{},
+		},
+	}
+	for _, sample := range samples {
+		quotes, err := db.SearchWord(ctx, sample.Input)
+		if err != nil {
+			t.Fatalf("error %v should not have occured for %q", err, sample.Input.Expression)
+		}
+		if !equalIDs(sortedQuoteIDs(quotes), sample.Expected) {
+			t.Errorf("got %v, wanted %v for %q", sortedQuoteIDs(quotes), sample.Expected, sample.Input.Expression)
+		}
+	}
+
+	// "alice" is the context of the last quote but appears in no content, the
+	// quote mentioning it twice in its content comes first
+	relevant := mustAddQuotes(t, db, AddQuoteRequest{Author: "bob", Content: "Alice, dear Alice, the stars are out", QuoteContext: "Zed"})
+	quotes, err = db.SearchWord(ctx, SearchExpressionRequest{Expression: "alice", QuoteNb: 5})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := []int{relevant[0], ids[5]}
+	if !equalIDs(quoteIDs(quotes), expected) {
+		t.Errorf("got %v, wanted %v", quoteIDs(quotes), expected)
+	}
+
+	// Every store folds the diacritics of the quotes and of the expression
+	accented := mustAddQuotes(t, db,
+		AddQuoteRequest{Author: "bob", Content: "Un café crème, déjà froid", QuoteContext: "Élodie"},
+		AddQuoteRequest{Author: "bob", Content: "The cafe is closed on Sundays", QuoteContext: "Zed"},
+	)
+	samples = []struct {
+		Input    SearchExpressionRequest
+		Expected []int
+	}{
+		{
+			Input:    SearchExpressionRequest{Expression: "cafe", QuoteNb: 5},
+			Expected: []int{accented[0], accented[1]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "CAFÉ", QuoteNb: 5},
+			Expected: []int{accented[0], accented[1]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "creme deja", QuoteNb: 5},
+			Expected: []int{accented[0]},
+		}, {
+			Input:    SearchExpressionRequest{Expression: "elodie", QuoteNb: 5},
+			Expected: []int{accented[0]},
+		},
+	}
+	for _, sample := range samples {
+		quotes, err := db.SearchWord(ctx, sample.Input)
+		if err != nil {
+			t.Fatalf("error %v should not have occured for %q", err, sample.Input.Expression)
+		}
+		if !equalIDs(sortedQuoteIDs(quotes), sample.Expected) {
+			t.Errorf("got %v, wanted %v for %q", sortedQuoteIDs(quotes), sample.Expected, sample.Input.Expression)
+		}
+	}
+}
+
+func testSearchExpression(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:6]...)
+
+	quotes, err := db.SearchExpression(ctx, SearchExpressionRequest{Expression: "pineapple on pizza", QuoteNb: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), []int{ids[1]}) {
+		t.Errorf("got %v, wanted %v", quoteIDs(quotes), []int{ids[1]})
+	}
+
+	quotes, err = db.SearchExpression(ctx, SearchExpressionRequest{Expression: "a", QuoteNb: 3})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) > 3 {
+		t.Errorf("got %d quotes, wanted at most 3", len(quotes))
+	}
+}
+
+func testPages(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:6]...)
+
+	quotes, err := db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := []int{ids[3], ids[2]}
+	if !equalIDs(quoteIDs(quotes), expected) {
+		t.Errorf("got %v, wanted %v", quoteIDs(quotes), expected)
+	}
+	quotes, err = db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 2, Offset: 6})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 0 {
+		t.Errorf("got %v after the last quote", quoteIDs(quotes))
+	}
+
+	for _, id := range ids[:3] {
+		err = db.UpVoteQuote(ctx, VoteQuoteRequest{QuoteID: id, Voter: 1})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+	}
+	quotes, err = db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 5, Offset: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected = []int{ids[1], ids[2]}
+	if !equalIDs(quoteIDs(quotes), expected) {
+		t.Errorf("got top %v, wanted %v", quoteIDs(quotes), expected)
+	}
+
+	// The pages of a search follow each other without overlapping
+	for _, search := range []struct {
+		Name string
+		Run  func(context.Context, SearchExpressionRequest) ([]QuoteResponse, error)
+	}{
+		{Name: "SearchWord", Run: db.SearchWord},
+		{Name: "SearchExpression", Run: db.SearchExpression},
+	} {
+		all, err := search.Run(ctx, SearchExpressionRequest{Expression: "never", QuoteNb: 10})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		var paged []QuoteResponse
+		for offset := 0; offset <= len(all); offset++ {
+			page, err := search.Run(ctx, SearchExpressionRequest{Expression: "never", QuoteNb: 1, Offset: offset})
+			if err != nil {
+				t.Fatalf("error %v should not have occured", err)
+			}
+			paged = append(paged, page...)
+		}
+		if len(all) == 0 || !equalIDs(quoteIDs(paged), quoteIDs(all)) {
+			t.Errorf("%s: got pages %v, wanted %v", search.Name, quoteIDs(paged), quoteIDs(all))
+		}
+	}
+}
+
+// withContexts returns the quotes attributed to the contexts, in the same order
+func withContexts(quotes []AddQuoteRequest, contexts ...string) []AddQuoteRequest {
+	attributed := make([]AddQuoteRequest, 0, len(contexts))
+	for i, quoteContext := range contexts {
+		quote := quotes[i]
+		quote.QuoteContext = quoteContext
+		attributed = append(attributed, quote)
+	}
+	return attributed
+}
+
+// speakerQuotes returns the number of quotes of each speaker by name
+func speakerQuotes(t *testing.T, db DB, chatID int64) map[string]int {
+	t.Helper()
+	speakers, err := db.GetSpeakers(context.Background(), chatID)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	counts := make(map[string]int)
+	for _, speaker := range speakers {
+		counts[speaker.Name] = speaker.Quotes
+	}
+	return counts
+}
+
+func testSpeakers(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, inChat(1, withContexts(conformanceQuotes, "Bob", "bob", " @bob", "Bobby", "Alice")...)...)
+
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{ChatID: 1, QuoteIDs: stringIDs(ids...)})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].QuoteID < quotes[j].QuoteID })
+	for i, quote := range quotes[:3] {
+		if quote.Speaker != "Bob" || quote.SpeakerID != quotes[0].SpeakerID {
+			t.Errorf("quote %d has speaker %d %q, wanted %d \"Bob\"", i, quote.SpeakerID, quote.Speaker, quotes[0].SpeakerID)
+		}
+	}
+	if quotes[3].Speaker != "Bobby" || quotes[3].SpeakerID == quotes[0].SpeakerID {
+		t.Errorf("got speaker %d %q, Bobby is someone else until aliased", quotes[3].SpeakerID, quotes[3].Speaker)
+	}
+
+	speakers, err := db.GetSpeakers(ctx, 1)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	var names []string
+	for _, speaker := range speakers {
+		names = append(names, speaker.Name)
+	}
+	if fmt.Sprint(names) != "[Bob Alice Bobby]" || speakers[0].Quotes != 3 {
+		t.Errorf("got speakers %+v, wanted Bob with 3 quotes then Alice and Bobby", speakers)
+	}
+
+	// Aliases
+	speaker, err := db.AliasSpeaker(ctx, AliasSpeakerRequest{ChatID: 1, Alias: "Robert", Speaker: "BOB"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if speaker.Name != "Bob" || fmt.Sprint(speaker.Aliases) != "[Robert]" || speaker.Quotes != 3 {
+		t.Errorf("got %+v, wanted Bob aliased Robert", speaker)
+	}
+	added, err := db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", Content: conformanceQuotes[5].Content, QuoteContext: "robert"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if added.Speaker != "Bob" {
+		t.Errorf("got speaker %q, the alias should match Bob", added.Speaker)
+	}
+	_, err = db.AliasSpeaker(ctx, AliasSpeakerRequest{ChatID: 1, Alias: "Bobby", Speaker: "Bob"})
+	if !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("got %v aliasing another speaker, wanted %v", err, ErrAliasTaken)
+	}
+	_, err = db.AliasSpeaker(ctx, AliasSpeakerRequest{ChatID: 1, Alias: "Nobody", Speaker: "Zoe"})
+	if !errors.Is(err, ErrSpeakerNotFound) {
+		t.Errorf("got %v aliasing an unknown speaker, wanted %v", err, ErrSpeakerNotFound)
+	}
+
+	// Merging
+	speaker, err = db.MergeSpeakers(ctx, MergeSpeakersRequest{ChatID: 1, From: "bobby", Into: "Robert"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if speaker.Name != "Bob" || fmt.Sprint(speaker.Aliases) != "[Bobby Robert]" || speaker.Quotes != 5 {
+		t.Errorf("got %+v, wanted Bob with the quotes and aliases of Bobby", speaker)
+	}
+	counts := speakerQuotes(t, db, 1)
+	if len(counts) != 2 || counts["Bob"] != 5 || counts["Alice"] != 1 {
+		t.Errorf("got speakers %v after the merge, wanted Bob and Alice", counts)
+	}
+	quotes, err = db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{ChatID: 1, QuoteIDs: stringIDs(ids[3])})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 1 || quotes[0].Speaker != "Bob" || quotes[0].QuoteContext != "Bobby" {
+		t.Errorf("got %+v, the quote should keep its context and move to Bob", quotes)
+	}
+	_, err = db.MergeSpeakers(ctx, MergeSpeakersRequest{ChatID: 1, From: "Zoe", Into: "Bob"})
+	if !errors.Is(err, ErrSpeakerNotFound) {
+		t.Errorf("got %v merging an unknown speaker, wanted %v", err, ErrSpeakerNotFound)
+	}
+
+	// Editing the context attributes the quote again
+	edited, err := db.EditQuote(ctx, EditQuoteRequest{ChatID: 1, QuoteID: ids[4], Content: conformanceQuotes[4].Content, QuoteContext: "Bobby", Editor: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if edited.Speaker != "Bob" {
+		t.Errorf("got speaker %q after the edit, wanted Bob", edited.Speaker)
+	}
+	counts = speakerQuotes(t, db, 1)
+	if counts["Bob"] != 6 || counts["Alice"] != 0 {
+		t.Errorf("got speakers %v after the edit, wanted Bob with 6 quotes", counts)
+	}
+
+	// Each group has its own speakers
+	mustAddQuotes(t, db, inChat(2, withContexts(conformanceQuotes, "bob")...)...)
+	counts = speakerQuotes(t, db, 2)
+	if len(counts) != 1 || counts["bob"] != 1 {
+		t.Errorf("got speakers %v in chat 2, wanted its own bob", counts)
+	}
+	_, err = db.MergeSpeakers(ctx, MergeSpeakersRequest{ChatID: 2, From: "Robert", Into: "bob"})
+	if !errors.Is(err, ErrSpeakerNotFound) {
+		t.Errorf("got %v merging the speaker of another group, wanted %v", err, ErrSpeakerNotFound)
+	}
+}
+
+func testTags(t *testing.T, db DB) {
+	ctx := context.Background()
+	quotes := append([]AddQuoteRequest(nil), conformanceQuotes[:3]...)
+	quotes[0].Tags = []string{"Work", "#cats", "work"}
+	quotes[1].Tags = []string{"work"}
+	ids := mustAddQuotes(t, db, quotes...)
+
+	_, err := db.AddQuote(ctx, AddQuoteRequest{Author: "alice", Content: "Tags are words, not numbers", QuoteContext: "Bob", Tags: []string{"42"}})
+	if !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("got error %v adding a numeric tag, wanted %v", err, ErrInvalidTag)
+	}
+
+	added, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids[0])})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(added) != 1 || fmt.Sprint(added[0].Tags) != "[cats work]" {
+		t.Errorf("got %+v, wanted the tags cats and work", added)
+	}
+
+	tagged, err := db.TagQuote(ctx, TagQuoteRequest{QuoteID: ids[2], Add: []string{"Mondays", "work", "cats"}, Remove: []string{"cats"}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if fmt.Sprint(tagged.Tags) != "[mondays work]" {
+		t.Errorf("got tags %v, wanted [mondays work]", tagged.Tags)
+	}
+	tagged, err = db.TagQuote(ctx, TagQuoteRequest{QuoteID: ids[0], Remove: []string{"#Cats", "unknown"}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if fmt.Sprint(tagged.Tags) != "[work]" {
+		t.Errorf("got tags %v, wanted [work]", tagged.Tags)
+	}
+	_, err = db.TagQuote(ctx, TagQuoteRequest{QuoteID: 99999, Add: []string{"work"}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v tagging an unknown quote, wanted %v", err, ErrNotFound)
+	}
+	_, err = db.TagQuote(ctx, TagQuoteRequest{QuoteID: ids[0], Add: []string{"not a tag"}})
+	if !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("got error %v, wanted %v", err, ErrInvalidTag)
+	}
+
+	tags, err := db.GetTags(ctx, 0)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := []TagResponse{{Tag: "work", Quotes: 3}, {Tag: "mondays", Quotes: 1}}
+	if fmt.Sprint(tags) != fmt.Sprint(expected) {
+		t.Errorf("got tags %v, wanted %v", tags, expected)
+	}
+
+	listed, err := db.GetRandomQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10, Filter: QuoteFilter{Tag: "#Mondays"}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(listed), ids[2:]) {
+		t.Errorf("got %v, wanted the quotes tagged mondays %v", quoteIDs(listed), ids[2:])
+	}
+	listed, err = db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 2, Filter: QuoteFilter{Tag: "work"}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(listed), []int{ids[2], ids[1]}) {
+		t.Errorf("got %v, wanted the last quotes tagged work", quoteIDs(listed))
+	}
+	err = db.UpVoteQuote(ctx, VoteQuoteRequest{QuoteID: ids[0], Voter: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	listed, err = db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10, Filter: QuoteFilter{Tag: "mondays"}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(listed) != 0 {
+		t.Errorf("got top %v, no quote tagged mondays has votes", quoteIDs(listed))
+	}
+	_, err = db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10, Filter: QuoteFilter{Tag: "not a tag"}})
+	if !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("got error %v, wanted %v", err, ErrInvalidTag)
+	}
+
+	// Deleted quotes are not counted, purged ones lose their tags
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: ids[1], Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = db.PurgeQuote(ctx, UniqueSpecifiedQuoteRequest{QuoteID: ids[1]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	tags, err = db.GetTags(ctx, 0)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected = []TagResponse{{Tag: "work", Quotes: 2}, {Tag: "mondays", Quotes: 1}}
+	if fmt.Sprint(tags) != fmt.Sprint(expected) {
+		t.Errorf("got tags %v, wanted %v", tags, expected)
+	}
+
+	// Tags belong to the group of their quotes
+	tags, err = db.GetTags(ctx, 2)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("got tags %v in another group", tags)
+	}
+	_, err = db.TagQuote(ctx, TagQuoteRequest{ChatID: 2, QuoteID: ids[0], Add: []string{"work"}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v tagging the quote of another group, wanted %v", err, ErrNotFound)
+	}
+}
+
+// lineSpeakers returns the "Speaker: words" lines of the quote
+func lineSpeakers(quote QuoteResponse) []string {
+	var lines []string
+	for _, line := range quote.Lines {
+		lines = append(lines, line.Speaker+": "+line.Content)
+	}
+	return lines
+}
+
+func testDialogues(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[0])
+	dialogue := "alice: Who ate the last croissant?\n\n @Bob : Not me\nAlice: Your beard is full of crumbs"
+	added, err := db.AddQuote(ctx, AddQuoteRequest{Author: "carol", Content: dialogue, QuoteContext: "alice, Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := []string{"alice: Who ate the last croissant?", "Bob: Not me", "alice: Your beard is full of crumbs"}
+	if fmt.Sprint(lineSpeakers(added)) != fmt.Sprint(expected) {
+		t.Errorf("got lines %q, wanted %q", lineSpeakers(added), expected)
+	}
+	if added.SpeakerID != 0 || added.Lines[0].SpeakerID == 0 || added.Lines[0].SpeakerID != added.Lines[2].SpeakerID || added.Lines[0].SpeakerID == added.Lines[1].SpeakerID {
+		t.Errorf("got %+v, each line should have its speaker and the dialogue none", added)
+	}
+	if added.Content != dialogue {
+		t.Errorf("got content %q, wanted it as written %q", added.Content, dialogue)
+	}
+	counts := speakerQuotes(t, db, 0)
+	if counts["alice"] != 1 || counts["Bob"] != 2 {
+		t.Errorf("got speakers %v, the dialogue should count once for alice and Bob", counts)
+	}
+
+	// A single line is a plain quote
+	single, err := db.AddQuote(ctx, AddQuoteRequest{Author: "carol", Content: "Bob: I only said one thing", QuoteContext: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if single.Lines != nil || single.Speaker != "Bob" {
+		t.Errorf("got %+v, wanted a plain quote of Bob", single)
+	}
+
+	// Dialogues are listed, searched and voted like the other quotes
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(ids[0], added.QuoteID)})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].QuoteID < quotes[j].QuoteID })
+	if len(quotes) != 2 || quotes[0].Lines != nil || fmt.Sprint(lineSpeakers(quotes[1])) != fmt.Sprint(expected) {
+		t.Errorf("got %+v, wanted the lines of the dialogue only", quotes)
+	}
+	quotes, err = db.SearchWord(ctx, SearchExpressionRequest{Expression: "croissant", QuoteNb: 5})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), []int{added.QuoteID}) || len(quotes[0].Lines) != 3 {
+		t.Errorf("got %+v, wanted the dialogue with its lines", quotes)
+	}
+	err = db.UpVoteQuote(ctx, VoteQuoteRequest{QuoteID: added.QuoteID, Voter: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	quotes, err = db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), []int{added.QuoteID}) || quotes[0].Votes != 1 || len(quotes[0].Lines) != 3 {
+		t.Errorf("got top %+v, wanted the voted dialogue", quotes)
+	}
+
+	// Merging speakers moves their lines
+	_, err = db.MergeSpeakers(ctx, MergeSpeakersRequest{From: "Bob", Into: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	quotes, err = db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{QuoteIDs: stringIDs(added.QuoteID)})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 1 || quotes[0].Lines[1].Speaker != "alice" || quotes[0].Lines[1].SpeakerID != quotes[0].Lines[0].SpeakerID {
+		t.Errorf("got %+v, the line of Bob should move to alice", quotes)
+	}
+	if added.Lines[1].Speaker != "Bob" {
+		t.Errorf("got %+v, the merge changed a quote already returned", added.Lines)
+	}
+
+	// Editing a dialogue into a plain quote drops its lines, and back
+	edited, err := db.EditQuote(ctx, EditQuoteRequest{QuoteID: added.QuoteID, Content: "Your beard is full of crumbs", QuoteContext: "Alice", Editor: "carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if edited.Lines != nil || edited.Speaker != "alice" {
+		t.Errorf("got %+v, wanted a plain quote of alice", edited)
+	}
+	edited, err = db.EditQuote(ctx, EditQuoteRequest{QuoteID: added.QuoteID, Content: "Dave: Crumbs?\nAlice: Crumbs.", QuoteContext: "Dave, Alice", Editor: "carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if fmt.Sprint(lineSpeakers(edited)) != "[Dave: Crumbs? alice: Crumbs.]" || edited.SpeakerID != 0 {
+		t.Errorf("got %+v, wanted the lines of the new dialogue", edited)
+	}
+	rolled, err := db.RollbackQuote(ctx, RollbackQuoteRequest{QuoteID: added.QuoteID, Revision: 1, Editor: "carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(rolled.Lines) != 3 || rolled.Lines[0].Content != "Who ate the last croissant?" {
+		t.Errorf("got %+v, wanted the lines of the first revision", rolled)
+	}
+
+	// Purged dialogues lose their lines
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: added.QuoteID, Deleter: "carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	counts = speakerQuotes(t, db, 0)
+	if counts["alice"] != 2 || counts["Dave"] != 0 {
+		t.Errorf("got speakers %v, a deleted dialogue should not count", counts)
+	}
+	err = db.PurgeQuote(ctx, UniqueSpecifiedQuoteRequest{QuoteID: added.QuoteID})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+}
+
+func testReplies(t *testing.T, db DB) {
+	ctx := context.Background()
+	said := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	added, err := db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", Content: "I never said I was a morning person", QuoteContext: "Bob Smith", SaidAt: said.Add(time.Millisecond), MessageID: 42, TelegramIDs: map[string]int64{"Bob Smith": 1001}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !added.SaidAt.Equal(said) || added.MessageID != 42 {
+		t.Errorf("got said at %v in message %d, wanted %v in 42", added.SaidAt, added.MessageID, said)
+	}
+	typed, err := db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", Content: "Who put pineapple on my pizza again?", QuoteContext: "Carol"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !typed.SaidAt.IsZero() || typed.MessageID != 0 {
+		t.Errorf("got said at %v in message %d, a quote typed in was taken from no message", typed.SaidAt, typed.MessageID)
+	}
+
+	// The Telegram user matches the speaker whatever the name it is quoted under
+	renamed, err := db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", Content: "The printer knows when you are in a hurry", QuoteContext: "Bobby", TelegramIDs: map[string]int64{"Bobby": 1001}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if renamed.SpeakerID != added.SpeakerID || renamed.Speaker != "Bob Smith" {
+		t.Errorf("got speaker %d %q, wanted the linked speaker %d", renamed.SpeakerID, renamed.Speaker, added.SpeakerID)
+	}
+	dialogue, err := db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", Content: "Carol: Coffee?\nDave: Tea.", QuoteContext: "Carol, Dave", TelegramIDs: map[string]int64{"Carol": 1002, "Dave": 1003}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if dialogue.Lines[0].SpeakerID != typed.SpeakerID {
+		t.Errorf("got speaker %d, Carol should be the speaker typed in before", dialogue.Lines[0].SpeakerID)
+	}
+
+	speakers, err := db.GetSpeakers(ctx, 1)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	linked := make(map[string]string)
+	for _, speaker := range speakers {
+		linked[speaker.Name] = fmt.Sprint(speaker.TelegramID, speaker.Aliases)
+	}
+	expected := map[string]string{"Bob Smith": "1001 [Bobby]", "Carol": "1002 []", "Dave": "1003 []"}
+	if fmt.Sprint(linked) != fmt.Sprint(expected) {
+		t.Errorf("got speakers %v, wanted %v", linked, expected)
+	}
+
+	// A user is linked in its group only
+	other, err := db.AddQuote(ctx, AddQuoteRequest{ChatID: 2, Author: "alice", Content: "Quantum physics is just spicy statistics", QuoteContext: "Robert", TelegramIDs: map[string]int64{"Robert": 1001}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if other.Speaker != "Robert" || other.SpeakerID == added.SpeakerID {
+		t.Errorf("got speaker %d %q, wanted a speaker of the other group", other.SpeakerID, other.Speaker)
+	}
+}
+
+func testMedia(t *testing.T, db DB) {
+	ctx := context.Background()
+	photo := Media{Type: MediaPhoto, FileID: "AgACAgQAAxkBAAIB"}
+	added, err := db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", Content: "Me after the deploy", QuoteContext: "Bob", Media: photo})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if added.Media != photo {
+		t.Errorf("got media %v, wanted %v", added.Media, photo)
+	}
+	// Stickers have no caption
+	sticker := Media{Type: MediaSticker, FileID: "CAACAgIAAxkBAAIC"}
+	_, err = db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", QuoteContext: "Carol", Media: sticker})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	mustAddQuotes(t, db, inChat(1, conformanceQuotes[0])...)
+
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{ChatID: 1, QuoteIDs: []string{fmt.Sprint(added.QuoteID), fmt.Sprint(added.QuoteID + 1), fmt.Sprint(added.QuoteID + 2)}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := []Media{photo, sticker, {}}
+	if len(quotes) != len(expected) {
+		t.Fatalf("got %d quotes, wanted %d", len(quotes), len(expected))
+	}
+	for i, quote := range quotes {
+		if quote.Media != expected[i] {
+			t.Errorf("got media %v for quote %d, wanted %v", quote.Media, quote.QuoteID, expected[i])
+		}
+	}
+
+	for _, media := range []Media{{Type: "document", FileID: "BQACAgIAAxkBAAID"}, {Type: MediaVoice}} {
+		_, err = db.AddQuote(ctx, AddQuoteRequest{ChatID: 1, Author: "alice", Content: "Listen to this", Media: media})
+		if !errors.Is(err, ErrInvalidMedia) {
+			t.Errorf("got error %v for media %v, wanted %v", err, media, ErrInvalidMedia)
+		}
+	}
+}
+
+func testPosts(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, inChat(1, conformanceQuotes[0], conformanceQuotes[1])...)
+	other := mustAddQuotes(t, db, inChat(2, conformanceQuotes[2])...)
+
+	for _, request := range []AddPostRequest{
+		{ChatID: 1, PostChatID: -100, MessageID: 500, QuoteIDs: []int{ids[0], ids[1]}},
+		{ChatID: 1, PostChatID: 1001, MessageID: 501, QuoteIDs: []int{ids[1]}, Caption: true},
+		// The quotes of another group are not posted
+		{ChatID: 1, PostChatID: -100, MessageID: 502, QuoteIDs: []int{ids[0], other[0]}},
+		// An edited message shows other quotes
+		{ChatID: 1, PostChatID: -100, MessageID: 503, QuoteIDs: []int{ids[1]}},
+		{ChatID: 1, PostChatID: -100, MessageID: 503, QuoteIDs: []int{ids[0]}},
+	} {
+		err := db.AddPost(ctx, request)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+	}
+
+	posts, err := db.GetPosts(ctx, UniqueSpecifiedQuoteRequest{ChatID: 1, QuoteID: ids[0]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := fmt.Sprint([]PostResponse{
+		{PostChatID: -100, MessageID: 503, QuoteIDs: []int{ids[0]}},
+		{PostChatID: -100, MessageID: 502, QuoteIDs: []int{ids[0]}},
+		{PostChatID: -100, MessageID: 500, QuoteIDs: []int{ids[0], ids[1]}},
+	})
+	if fmt.Sprint(posts) != expected {
+		t.Errorf("got posts %v, wanted %v", posts, expected)
+	}
+	posts, err = db.GetPosts(ctx, UniqueSpecifiedQuoteRequest{ChatID: 1, QuoteID: ids[1]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(posts) != 2 || !posts[0].Caption || posts[0].MessageID != 501 {
+		t.Errorf("got posts %v, wanted the caption 501 first", posts)
+	}
+	posts, err = db.GetPosts(ctx, UniqueSpecifiedQuoteRequest{ChatID: 2, QuoteID: ids[0]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(posts) != 0 {
+		t.Errorf("got posts %v of a quote of another group", posts)
+	}
+
+	// Purged quotes leave their posts
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{ChatID: 1, QuoteID: ids[0], Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = db.PurgeQuote(ctx, UniqueSpecifiedQuoteRequest{ChatID: 1, QuoteID: ids[0]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	posts, err = db.GetPosts(ctx, UniqueSpecifiedQuoteRequest{ChatID: 1, QuoteID: ids[1]})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected = fmt.Sprint([]PostResponse{
+		{PostChatID: 1001, MessageID: 501, QuoteIDs: []int{ids[1]}, Caption: true},
+		{PostChatID: -100, MessageID: 500, QuoteIDs: []int{ids[1]}},
+	})
+	if fmt.Sprint(posts) != expected {
+		t.Errorf("got posts %v, wanted %v", posts, expected)
+	}
+}
+
+func testGroups(t *testing.T, db DB) {
+	ctx := context.Background()
+	// The same quote is no duplicate in another group
+	first := mustAddQuotes(t, db, inChat(1, conformanceQuotes[0], conformanceQuotes[1])...)
+	second := mustAddQuotes(t, db, inChat(2, conformanceQuotes[0])...)
+
+	quotes, err := db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{ChatID: 1, QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), []int{first[1], first[0]}) || quotes[0].ChatID != 1 {
+		t.Errorf("got %+v, wanted the quotes of chat 1", quotes)
+	}
+	quotes, err = db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{ChatID: 2, QuoteIDs: stringIDs(first...)})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 0 {
+		t.Errorf("got %v, the quotes of chat 1 should not be found from chat 2", quoteIDs(quotes))
+	}
+	quotes, err = db.SearchExpression(ctx, SearchExpressionRequest{ChatID: 2, Expression: conformanceQuotes[0].Content, QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), second) {
+		t.Errorf("got %v, wanted %v", quoteIDs(quotes), second)
+	}
+	quotes, err = db.SearchWord(ctx, SearchExpressionRequest{ChatID: 2, Expression: "pineapple", QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 0 {
+		t.Errorf("got %v, the quotes of chat 1 should not be found from chat 2", quoteIDs(quotes))
+	}
+
+	// Nothing can be done from a group to the quotes of another one
+	err = db.UpVoteQuote(ctx, VoteQuoteRequest{ChatID: 2, QuoteID: first[0], Voter: 1})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v voting from another group, wanted %v", err, ErrNotFound)
+	}
+	_, err = db.EditQuote(ctx, EditQuoteRequest{ChatID: 2, QuoteID: first[0], Content: "content", QuoteContext: "context", Editor: "carol"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v editing from another group, wanted %v", err, ErrNotFound)
+	}
+	_, err = db.GetRevisions(ctx, UniqueSpecifiedQuoteRequest{ChatID: 2, QuoteID: first[0]})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for the revisions from another group, wanted %v", err, ErrNotFound)
+	}
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{ChatID: 2, QuoteID: first[0], Deleter: "alice"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v deleting from another group, wanted %v", err, ErrNotFound)
+	}
+
+	err = db.UpVoteQuote(ctx, VoteQuoteRequest{ChatID: 1, QuoteID: first[0], Voter: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	quotes, err = db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{ChatID: 2, QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 0 {
+		t.Errorf("got %v, the ranking of chat 2 should be empty", quoteIDs(quotes))
+	}
+
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{ChatID: 1, QuoteID: first[1], Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	trash, err := db.GetTrash(ctx, TrashRequest{ChatID: 2, QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("got %v, the trash of chat 2 should be empty", quoteIDs(trash))
+	}
+	_, err = db.RestoreQuote(ctx, UniqueSpecifiedQuoteRequest{ChatID: 2, QuoteID: first[1]})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v restoring from another group, wanted %v", err, ErrNotFound)
+	}
+	err = db.PurgeQuote(ctx, UniqueSpecifiedQuoteRequest{ChatID: 2, QuoteID: first[1]})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v purging from another group, wanted %v", err, ErrNotFound)
+	}
+}
+
+func testAdoptQuotes(t *testing.T, db DB) {
+	ctx := context.Background()
+	ids := mustAddQuotes(t, db, conformanceQuotes[:2]...)
+	err := db.UpVoteQuote(ctx, VoteQuoteRequest{QuoteID: ids[0], Voter: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// Searching loads the indexes of chat 0 before the quotes move
+	quotes, err := db.SearchExpression(ctx, SearchExpressionRequest{Expression: conformanceQuotes[0].Content, QuoteNb: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), ids[:1]) {
+		t.Errorf("got %v, wanted %v", quoteIDs(quotes), ids[:1])
+	}
+
+	adopted, err := db.AdoptQuotes(ctx, 42)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if adopted != 2 {
+		t.Errorf("got %d adopted quotes, wanted 2", adopted)
+	}
+
+	quotes, err = db.GetTopQuotes(ctx, MultipleUnspecifiedQuotesRequest{ChatID: 42, QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !equalIDs(quoteIDs(quotes), ids[:1]) || quotes[0].Votes != 1 {
+		t.Errorf("got %+v, the quote should keep its vote", quotes)
+	}
+	for chatID, expected := range map[int64][]int{0: {}, 42: ids[:1]} {
+		quotes, err = db.SearchExpression(ctx, SearchExpressionRequest{ChatID: chatID, Expression: conformanceQuotes[0].Content, QuoteNb: 1})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if !equalIDs(quoteIDs(quotes), expected) {
+			t.Errorf("got %v searching chat %d, wanted %v", quoteIDs(quotes), chatID, expected)
+		}
+	}
+
+	if counts := speakerQuotes(t, db, 42); counts["Bob"] != 1 || counts["Carol"] != 1 {
+		t.Errorf("got speakers %v, they should move with their quotes", counts)
+	}
+
+	adopted, err = db.AdoptQuotes(ctx, 43)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if adopted != 0 {
+		t.Errorf("got %d adopted quotes, the quotes already have a group", adopted)
+	}
+}
+
+func testCanceledContext(t *testing.T, db DB) {
+	ids := mustAddQuotes(t, db, conformanceQuotes[0])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := db.AddQuote(ctx, conformanceQuotes[1])
+	if err == nil {
+		t.Errorf("AddQuote should fail with a canceled context")
+	}
+	_, err = db.GetLastQuotes(ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 1})
+	if err == nil {
+		t.Errorf("GetLastQuotes should fail with a canceled context")
+	}
+	err = db.UpVoteQuote(ctx, VoteQuoteRequest{QuoteID: ids[0], Voter: 1})
+	if err == nil {
+		t.Errorf("UpVoteQuote should fail with a canceled context")
+	}
+
+	quotes, err := db.GetLastQuotes(context.Background(), MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(quotes) != 1 || quotes[0].Votes != 0 {
+		t.Errorf("nothing should have been written with a canceled context, got %+v", quotes)
+	}
+}
@@ -0,0 +1,157 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+)
+
+// maxSpeakerLength is the length of the longest speaker name of a dialogue
+// line, in bytes, the text before the colon of a longer line being a sentence
+const maxSpeakerLength = 64
+
+var regexDialogueLine = regexp.MustCompile(`^([^:]+?)\s*:\s*(\S.*)$`)
+
+// dialogueQueries are the statements behind the lines of the dialogues,
+// SQLite and PostgreSQL share the logic but not the placeholders
+type dialogueQueries struct {
+	// add inserts the line (quoteID, position, speakerID, content)
+	add string
+	// delete removes the lines of (quoteID)
+	delete string
+}
+
+var sqliteDialogueQueries = dialogueQueries{
+	add:    "INSERT INTO QuoteLines (quoteID, position, speakerID, content) VALUES (?,?,?,?)",
+	delete: "DELETE FROM QuoteLines WHERE quoteID=?",
+}
+
+var postgresDialogueQueries = dialogueQueries{
+	add:    "INSERT INTO QuoteLines (quoteID, position, speakerID, content) VALUES ($1,$2,$3,$4)",
+	delete: "DELETE FROM QuoteLines WHERE quoteID=$1",
+}
+
+// ParseDialogue reads a dialogue, at least two "Speaker: words" lines, the
+// empty lines being skipped. It reports false for any other text.
+func ParseDialogue(text string) ([]QuoteLine, bool) {
+	var lines []QuoteLine
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		matches := regexDialogueLine.FindStringSubmatch(line)
+		if matches == nil || len(matches[1]) > maxSpeakerLength {
+			return nil, false
+		}
+		speaker := speakerName(matches[1])
+		if speaker == "" {
+			return nil, false
+		}
+		lines = append(lines, QuoteLine{Speaker: speaker, Content: strings.TrimSpace(matches[2])})
+	}
+	if len(lines) < 2 {
+		return nil, false
+	}
+	return lines, true
+}
+
+// FormatDialogue writes the lines as ParseDialogue reads them, one "Speaker: words" per line
+func FormatDialogue(lines []QuoteLine) string {
+	formatted := make([]string, 0, len(lines))
+	for _, line := range lines {
+		formatted = append(formatted, line.Speaker+": "+line.Content)
+	}
+	return strings.Join(formatted, "\n")
+}
+
+// DialogueContext names the speakers of the lines in order of appearance,
+// "Alice, Bob", as the context of a dialogue
+func DialogueContext(lines []QuoteLine) string {
+	var speakers []string
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		name := strings.ToLower(line.Speaker)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		speakers = append(speakers, line.Speaker)
+	}
+	return strings.Join(speakers, ", ")
+}
+
+// quoteSpeaker returns the speaker of a quote, NULL for the dialogues as each
+// of their lines has its own
+func quoteSpeaker(ctx context.Context, db querier, q speakerQueries, chatID int64, content string, quoteContext string, telegramIDs map[string]int64) (sql.NullInt64, error) {
+	if _, ok := ParseDialogue(content); ok {
+		return sql.NullInt64{}, nil
+	}
+	return speakerFor(ctx, db, q, chatID, quoteContext, telegramIDs[speakerName(quoteContext)])
+}
+
+// addLines stores the lines of the quote when its content is a dialogue
+func addLines(ctx context.Context, db querier, q dialogueQueries, sq speakerQueries, chatID int64, quoteID int, content string, telegramIDs map[string]int64) error {
+	lines, _ := ParseDialogue(content)
+	for i, line := range lines {
+		speakerID, err := speakerFor(ctx, db, sq, chatID, line.Speaker, telegramIDs[line.Speaker])
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, q.add, quoteID, i+1, speakerID, line.Content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceLines stores the lines of the new content of a quote in place of the
+// ones of its old content
+func replaceLines(ctx context.Context, db querier, q dialogueQueries, sq speakerQueries, chatID int64, quoteID int, oldContent string, content string) error {
+	if _, ok := ParseDialogue(oldContent); ok {
+		_, err := db.ExecContext(ctx, q.delete, quoteID)
+		if err != nil {
+			return err
+		}
+	}
+	return addLines(ctx, db, q, sq, chatID, quoteID, content, nil)
+}
+
+// dialogueIDs returns the IDs of the dialogues among the quotes
+func dialogueIDs(quotes []QuoteResponse) []interface{} {
+	var ids []interface{}
+	for _, quote := range quotes {
+		if _, ok := ParseDialogue(quote.Content); ok {
+			ids = append(ids, quote.QuoteID)
+		}
+	}
+	return ids
+}
+
+// scanLines reads quoteID, speakerID, speaker name and content rows, in order,
+// into the Lines of the quotes
+func scanLines(results *sql.Rows, quotes []QuoteResponse) error {
+	positions := make(map[int]int)
+	for i, quote := range quotes {
+		positions[quote.QuoteID] = i
+	}
+
+	for results.Next() {
+		var quoteID int
+		var speakerID sql.NullInt32
+		var speaker sql.NullString
+		var line QuoteLine
+		err := results.Scan(&quoteID, &speakerID, &speaker, &line.Content)
+		if err != nil {
+			return err
+		}
+		line.SpeakerID = int(speakerID.Int32)
+		line.Speaker = speaker.String
+		if i, ok := positions[quoteID]; ok {
+			quotes[i].Lines = append(quotes[i].Lines, line)
+		}
+	}
+	return results.Err()
+}
@@ -0,0 +1,70 @@
+package storages
+
+import "strings"
+
+// revisionDiff describes the changes of an edit, one line per changed field
+func revisionDiff(oldContent, oldContext, content, context string) string {
+	lines := make([]string, 0, 2)
+	if oldContent != content {
+		lines = append(lines, "content: "+wordDiff(oldContent, content))
+	}
+	if oldContext != context {
+		lines = append(lines, "context: "+wordDiff(oldContext, context))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wordDiff marks the removed words as [-removed-] and the added ones as
+// {+added+}, like git diff --word-diff
+func wordDiff(old, new string) string {
+	a, b := strings.Fields(old), strings.Fields(new)
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var words, removed, added []string
+	flush := func() {
+		if len(removed) > 0 {
+			words = append(words, "[-"+strings.Join(removed, " ")+"-]")
+			removed = nil
+		}
+		if len(added) > 0 {
+			words = append(words, "{+"+strings.Join(added, " ")+"+}")
+			added = nil
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			words = append(words, a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			removed = append(removed, a[i])
+			i++
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+	flush()
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,47 @@
+package storages
+
+import "testing"
+
+func TestWordDiff(t *testing.T) {
+	samples := []struct {
+		Old      string
+		New      string
+		Expected string
+	}{
+		{Old: "same words", New: "same words", Expected: "same words"},
+		{Old: "I nevre said that", New: "I never said that", Expected: "I [-nevre-] {+never+} said that"},
+		{Old: "a b c", New: "a c", Expected: "a [-b-] c"},
+		{Old: "a c", New: "a b c", Expected: "a {+b+} c"},
+		{Old: "one two three", New: "four five", Expected: "[-one two three-] {+four five+}"},
+		{Old: "", New: "brand new", Expected: "{+brand new+}"},
+		{Old: "all gone", New: "", Expected: "[-all gone-]"},
+		{Old: "spacing   does  not\nmatter", New: "spacing does not matter", Expected: "spacing does not matter"},
+	}
+
+	for _, sample := range samples {
+		got := wordDiff(sample.Old, sample.New)
+		if got != sample.Expected {
+			t.Errorf("got %q, wanted %q for %q -> %q", got, sample.Expected, sample.Old, sample.New)
+		}
+	}
+}
+
+func TestRevisionDiff(t *testing.T) {
+	samples := []struct {
+		Old      [2]string
+		New      [2]string
+		Expected string
+	}{
+		{Old: [2]string{"quote", "Bob"}, New: [2]string{"quote", "Bob"}, Expected: ""},
+		{Old: [2]string{"a quote", "Bob"}, New: [2]string{"the quote", "Bob"}, Expected: "content: [-a-] {+the+} quote"},
+		{Old: [2]string{"quote", "Bob"}, New: [2]string{"quote", "Alice"}, Expected: "context: [-Bob-] {+Alice+}"},
+		{Old: [2]string{"a quote", "Bob"}, New: [2]string{"quote", "Alice"}, Expected: "content: [-a-] quote\ncontext: [-Bob-] {+Alice+}"},
+	}
+
+	for _, sample := range samples {
+		got := revisionDiff(sample.Old[0], sample.Old[1], sample.New[0], sample.New[1])
+		if got != sample.Expected {
+			t.Errorf("got %q, wanted %q", got, sample.Expected)
+		}
+	}
+}
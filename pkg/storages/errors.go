@@ -0,0 +1,42 @@
+package storages
+
+import (
+	"errors"
+	"fmt"
+
+	"goquotebot/pkg/search"
+)
+
+var (
+	// ErrNotFound is returned when a quote does not exist or has been deleted
+	ErrNotFound = errors.New("quote not found")
+	// ErrForbiddenContext is returned when a quote is attributed to a blacklisted context
+	ErrForbiddenContext = errors.New("forbidden quote context")
+	// ErrSpeakerNotFound is returned when no speaker of the group matches a name
+	ErrSpeakerNotFound = errors.New("speaker not found")
+	// ErrAliasTaken is returned when an alias already matches another speaker
+	ErrAliasTaken = errors.New("alias already used by another speaker")
+	// ErrInvalidTag is returned for tags that are not words of letters, digits and dashes
+	ErrInvalidTag = errors.New("invalid tag")
+	// ErrInvalidMedia is returned for media of an unknown type or without file
+	ErrInvalidMedia = errors.New("invalid media")
+	// ErrNoFullText is returned when SQLite was built without FTS5, the bot
+	// must be built with -tags sqlite_fts5
+	ErrNoFullText = errors.New("sqlite built without FTS5, build with -tags sqlite_fts5")
+)
+
+// ErrProbableDuplicate is returned when a new quote is too similar to stored ones
+type ErrProbableDuplicate struct {
+	// Matches are the most similar quotes, the closest first
+	Matches []search.Match
+}
+
+func (e ErrProbableDuplicate) Error() string {
+	return fmt.Sprintf("probable duplicate of quote %d (similarity %.2f)", e.Matches[0].QuoteID, e.Matches[0].Similarity)
+}
+
+// NearMiss reports whether no stored quote is identical to the new one, in
+// which case AddQuoteRequest.Force can add it anyway
+func (e ErrProbableDuplicate) NearMiss() bool {
+	return e.Matches[0].Similarity < 1
+}
@@ -0,0 +1,65 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldDiacritics drops the accents of the letters, as the full-text indexes do
+var foldDiacritics = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// checkFullText returns ErrNoFullText when this build of SQLite lacks FTS5,
+// which the search_index migration and SearchWord need
+func checkFullText(ctx context.Context, db *sql.DB) error {
+	var enabled bool
+	err := db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNoFullText
+	}
+	return nil
+}
+
+// searchTerms splits a search expression into words, dropping punctuation and
+// any character that would be an operator in a full-text query
+func searchTerms(expression string) []string {
+	return strings.FieldsFunc(expression, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// fts5Query matches the quotes having every term as a word prefix
+func fts5Query(terms []string) string {
+	query := make([]string, 0, len(terms))
+	for _, term := range terms {
+		query = append(query, `"`+term+`"*`)
+	}
+	return strings.Join(query, " ")
+}
+
+// tsQuery is the PostgreSQL counterpart of fts5Query
+func tsQuery(terms []string) string {
+	query := make([]string, 0, len(terms))
+	for _, term := range terms {
+		query = append(query, term+":*")
+	}
+	return strings.Join(query, " & ")
+}
+
+// foldText lowers the text and drops its diacritics, so that "Café" and "cafe"
+// are the same word
+func foldText(text string) string {
+	folded, _, err := transform.String(foldDiacritics, strings.ToLower(text))
+	if err != nil {
+		return strings.ToLower(text)
+	}
+	return folded
+}
@@ -0,0 +1,37 @@
+package storages
+
+import (
+	"testing"
+)
+
+func TestSearchQueries(t *testing.T) {
+	samples := []struct {
+		Input   string
+		FTS5    string
+		TsQuery string
+	}{
+		{Input: "pizza", FTS5: `"pizza"*`, TsQuery: "pizza:*"},
+		{Input: "  l'été, déjà!  ", FTS5: `"l"* "été"* "déjà"*`, TsQuery: "l:* & été:* & déjà:*"},
+		{Input: `"a" OR (b* NEAR c) -d`, FTS5: `"a"* "OR"* "b"* "NEAR"* "c"* "d"*`, TsQuery: "a:* & OR:* & b:* & NEAR:* & c:* & d:*"},
+		{Input: "!!! ...", FTS5: "", TsQuery: ""},
+	}
+
+	for _, sample := range samples {
+		terms := searchTerms(sample.Input)
+		if got := fts5Query(terms); got != sample.FTS5 {
+			t.Errorf("got %q, wanted %q for %q", got, sample.FTS5, sample.Input)
+		}
+		if got := tsQuery(terms); got != sample.TsQuery {
+			t.Errorf("got %q, wanted %q for %q", got, sample.TsQuery, sample.Input)
+		}
+	}
+}
+
+func TestFoldText(t *testing.T) {
+	samples := map[string]string{"Café": "cafe", "DÉJÀ vu": "deja vu", "Élodie": "elodie", "naïve": "naive", "pizza": "pizza"}
+	for input, expected := range samples {
+		if got := foldText(input); got != expected {
+			t.Errorf("got %q, wanted %q for %q", got, expected, input)
+		}
+	}
+}
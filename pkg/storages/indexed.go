@@ -0,0 +1,296 @@
+package storages
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"goquotebot/pkg/search"
+)
+
+const (
+	// DefaultDuplicateThreshold is the similarity above which a new quote is a probable duplicate
+	DefaultDuplicateThreshold = 0.45
+	// duplicateMatches is the number of similar quotes reported by ErrProbableDuplicate
+	duplicateMatches = 3
+)
+
+// IndexedDB answers SearchExpression and looks for duplicates from in-memory
+// search indexes instead of scoring every stored quote. The indexes of a group
+// are loaded on its first request and kept up to date by the writes going
+// through IndexedDB, the other methods reach the wrapped DB.
+type IndexedDB struct {
+	DB
+	searchCfg     search.Config
+	duplicatesCfg search.Config
+
+	// mu guards chats only, the indexes of each group have their own lock
+	mu    sync.Mutex
+	chats map[int64]*chatIndexes
+}
+
+// chatIndexes are the indexes of the quotes of one group, nil until loaded
+type chatIndexes struct {
+	// mu is held while the indexes load and while a quote is checked then
+	// added, so that two adds of the same quote cannot both pass the check
+	mu         sync.Mutex
+	search     *search.Index
+	duplicates *search.Index
+}
+
+func NewIndexedDB(db DB, searchCfg search.Config, duplicatesCfg search.Config) (*IndexedDB, error) {
+	duplicatesCfg = duplicatesConfig(duplicatesCfg)
+	// Report a bad configuration now rather than on the first request
+	for _, cfg := range []search.Config{searchCfg, duplicatesCfg} {
+		_, err := search.NewIndex(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &IndexedDB{
+		DB:            db,
+		searchCfg:     searchCfg,
+		duplicatesCfg: duplicatesCfg,
+		chats:         make(map[int64]*chatIndexes),
+	}, nil
+}
+
+func (i *IndexedDB) AddQuote(ctx context.Context, request AddQuoteRequest) (QuoteResponse, error) {
+	if !checkContext(request.QuoteContext) {
+		return QuoteResponse{}, ErrForbiddenContext
+	}
+	indexes, err := i.lockIndexes(ctx, request.ChatID)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	defer indexes.mu.Unlock()
+	err = checkDuplicate(indexes.duplicates, request)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+
+	request.checked = true
+	quote, err := i.DB.AddQuote(ctx, request)
+	if err != nil {
+		return quote, err
+	}
+	indexes.add(quote)
+	return quote, nil
+}
+
+func (i *IndexedDB) DeleteQuote(ctx context.Context, request DeleteQuoteRequest) error {
+	err := i.DB.DeleteQuote(ctx, request)
+	if err != nil {
+		return err
+	}
+	i.update(request.ChatID, func(indexes *chatIndexes) {
+		indexes.search.Remove(request.QuoteID)
+		indexes.duplicates.Remove(request.QuoteID)
+	})
+	return nil
+}
+
+func (i *IndexedDB) RestoreQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) (QuoteResponse, error) {
+	quote, err := i.DB.RestoreQuote(ctx, request)
+	if err != nil {
+		return quote, err
+	}
+	i.reindex(quote)
+	return quote, nil
+}
+
+func (i *IndexedDB) EditQuote(ctx context.Context, request EditQuoteRequest) (QuoteResponse, error) {
+	quote, err := i.DB.EditQuote(ctx, request)
+	if err != nil {
+		return quote, err
+	}
+	i.reindex(quote)
+	return quote, nil
+}
+
+func (i *IndexedDB) RollbackQuote(ctx context.Context, request RollbackQuoteRequest) (QuoteResponse, error) {
+	quote, err := i.DB.RollbackQuote(ctx, request)
+	if err != nil {
+		return quote, err
+	}
+	i.reindex(quote)
+	return quote, nil
+}
+
+func (i *IndexedDB) SearchExpression(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	indexes, err := i.indexes(ctx, request.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	return searchIndex(ctx, i.DB, indexes.search, request)
+}
+
+// AdoptQuotes moves the quotes, the indexes of both chats are loaded again on their next use
+func (i *IndexedDB) AdoptQuotes(ctx context.Context, chatID int64) (int, error) {
+	adopted, err := i.DB.AdoptQuotes(ctx, chatID)
+	if err != nil {
+		return adopted, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.chats, 0)
+	delete(i.chats, chatID)
+	return adopted, nil
+}
+
+// chat returns the indexes of the group, creating them unloaded if needed
+func (i *IndexedDB) chat(chatID int64) *chatIndexes {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	indexes, ok := i.chats[chatID]
+	if !ok {
+		indexes = &chatIndexes{}
+		i.chats[chatID] = indexes
+	}
+	return indexes
+}
+
+// lockIndexes returns the indexes of the group locked, loading them on first
+// use without blocking the other groups. The caller unlocks them.
+func (i *IndexedDB) lockIndexes(ctx context.Context, chatID int64) (*chatIndexes, error) {
+	indexes := i.chat(chatID)
+	indexes.mu.Lock()
+	if indexes.search != nil {
+		return indexes, nil
+	}
+
+	searchIndex, err := loadIndex(ctx, i.DB, chatID, i.searchCfg)
+	if err != nil {
+		indexes.mu.Unlock()
+		return nil, err
+	}
+	duplicates, err := loadIndex(ctx, i.DB, chatID, i.duplicatesCfg)
+	if err != nil {
+		indexes.mu.Unlock()
+		return nil, err
+	}
+	indexes.search = searchIndex
+	indexes.duplicates = duplicates
+	return indexes, nil
+}
+
+// indexes returns the indexes of the group, loading them on first use
+func (i *IndexedDB) indexes(ctx context.Context, chatID int64) (*chatIndexes, error) {
+	indexes, err := i.lockIndexes(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	indexes.mu.Unlock()
+	return indexes, nil
+}
+
+// update changes the indexes of the group under their lock, if they are loaded
+func (i *IndexedDB) update(chatID int64, change func(indexes *chatIndexes)) {
+	i.mu.Lock()
+	indexes, ok := i.chats[chatID]
+	i.mu.Unlock()
+	if !ok {
+		return
+	}
+	indexes.mu.Lock()
+	defer indexes.mu.Unlock()
+	if indexes.search != nil {
+		change(indexes)
+	}
+}
+
+// reindex stores the current content of the quote in the indexes of its group,
+// if they are loaded
+func (i *IndexedDB) reindex(quote QuoteResponse) {
+	i.update(quote.ChatID, func(indexes *chatIndexes) {
+		indexes.add(quote)
+	})
+}
+
+// add stores the current content of the quote in both indexes
+func (c *chatIndexes) add(quote QuoteResponse) {
+	c.search.Add(quote.QuoteID, quote.Content)
+	c.duplicates.Add(quote.QuoteID, quote.Content)
+}
+
+// duplicatesConfig sets the default threshold of the duplicates index
+func duplicatesConfig(cfg search.Config) search.Config {
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultDuplicateThreshold
+	}
+	return cfg
+}
+
+// loadIndex indexes every available quote of the group
+func loadIndex(ctx context.Context, db DB, chatID int64, cfg search.Config) (*search.Index, error) {
+	index, err := search.NewIndex(cfg)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := db.GetContents(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the search index: %w", err)
+	}
+	for quoteID, content := range contents {
+		index.Add(quoteID, content)
+	}
+	return index, nil
+}
+
+// searchIndex fetches the quotes matched by the index, the closest first,
+// after the offset
+func searchIndex(ctx context.Context, db DB, index *search.Index, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	matches := index.Search(request.Expression, request.Offset+request.QuoteNb)
+	if request.Offset >= len(matches) {
+		return []QuoteResponse{}, nil
+	}
+	matches = matches[request.Offset:]
+	rank := make(map[int]int, len(matches))
+	quoteIDs := make([]string, 0, len(matches))
+	for i, match := range matches {
+		rank[match.QuoteID] = i
+		quoteIDs = append(quoteIDs, fmt.Sprint(match.QuoteID))
+	}
+
+	quotes, err := db.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{ChatID: request.ChatID, QuoteIDs: quoteIDs})
+	if err != nil {
+		return quotes, err
+	}
+	sort.Slice(quotes, func(a, b int) bool {
+		return rank[quotes[a].QuoteID] < rank[quotes[b].QuoteID]
+	})
+	return quotes, nil
+}
+
+// checkDuplicate returns ErrProbableDuplicate when the index holds quotes
+// similar to the new one, unless it is forced and none of them is identical.
+// Media quotes are never duplicates, their caption alone not telling them apart.
+func checkDuplicate(index *search.Index, request AddQuoteRequest) error {
+	if !request.Media.IsZero() {
+		return nil
+	}
+	matches := index.Search(request.Content, duplicateMatches)
+	if len(matches) == 0 {
+		return nil
+	}
+	duplicate := ErrProbableDuplicate{Matches: matches}
+	if request.Force && duplicate.NearMiss() {
+		return nil
+	}
+	return duplicate
+}
+
+// checkStoredDuplicate is checkDuplicate for the DBs that keep no index, it
+// compares the new quote with every available one of its group
+func checkStoredDuplicate(ctx context.Context, db DB, request AddQuoteRequest) error {
+	if request.checked {
+		return nil
+	}
+	index, err := loadIndex(ctx, db, request.ChatID, duplicatesConfig(search.Config{}))
+	if err != nil {
+		return err
+	}
+	return checkDuplicate(index, request)
+}
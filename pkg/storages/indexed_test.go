@@ -0,0 +1,161 @@
+package storages
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"goquotebot/pkg/search"
+)
+
+func TestIndexedDB(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqlite, err := NewSqliteWrapper(SqliteConfig{Path: path})
+	if err != nil {
+		skipWithoutFullText(t, err)
+		t.Fatalf("error %v should not have occured", err)
+	}
+	ids := mustAddQuotes(t, sqlite, conformanceQuotes[:3]...)
+
+	// The quotes stored before the index is created are loaded on first use
+	db, err := NewIndexedDB(sqlite, search.Config{Threshold: 0.5}, search.Config{})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	defer db.Close()
+	indexes, err := db.indexes(ctx, 0)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if indexes.search.Len() != 3 {
+		t.Errorf("got %d indexed quotes, wanted 3", indexes.search.Len())
+	}
+
+	steps := []struct {
+		Name string
+		Run  func() error
+		// Expression must find Expected only
+		Expression string
+		Expected   []int
+	}{
+		{
+			Name:       "loaded",
+			Run:        func() error { return nil },
+			Expression: "who put pineapple on my pizza",
+			Expected:   []int{ids[1]},
+		},
+		{
+			Name: "added",
+			Run: func() error {
+				added, err := db.AddQuote(ctx, conformanceQuotes[4])
+				ids = append(ids, added.QuoteID)
+				return err
+			},
+			Expression: "my cat filed a complaint",
+			Expected:   []int{ids[2] + 1},
+		},
+		{
+			Name:       "deleted",
+			Run:        func() error { return db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: ids[1], Deleter: "alice"}) },
+			Expression: "who put pineapple on my pizza",
+			Expected:   []int{},
+		},
+		{
+			Name: "edited",
+			Run: func() error {
+				_, err := db.EditQuote(ctx, EditQuoteRequest{QuoteID: ids[0], Content: "Who put pineapple on my pizza again?", QuoteContext: "Bob", Editor: "bob"})
+				return err
+			},
+			Expression: "who put pineapple on my pizza",
+			Expected:   []int{ids[0]},
+		},
+		{
+			Name: "rolled back",
+			Run: func() error {
+				_, err := db.RollbackQuote(ctx, RollbackQuoteRequest{QuoteID: ids[0], Revision: 1, Editor: "admin"})
+				return err
+			},
+			Expression: "who put pineapple on my pizza",
+			Expected:   []int{},
+		},
+	}
+
+	for _, step := range steps {
+		err := step.Run()
+		if err != nil {
+			t.Fatalf("%s: error %v should not have occured", step.Name, err)
+		}
+		quotes, err := db.SearchExpression(ctx, SearchExpressionRequest{Expression: step.Expression, QuoteNb: 5})
+		if err != nil {
+			t.Fatalf("%s: error %v should not have occured", step.Name, err)
+		}
+		if !equalIDs(quoteIDs(quotes), step.Expected) {
+			t.Errorf("%s: got %v, wanted %v", step.Name, quoteIDs(quotes), step.Expected)
+		}
+	}
+
+	// A failed write leaves the index untouched
+	err = db.DeleteQuote(ctx, DeleteQuoteRequest{QuoteID: ids[1], Deleter: "alice"})
+	if err != ErrNotFound {
+		t.Errorf("got %v, wanted %v", err, ErrNotFound)
+	}
+	if indexes.search.Len() != 3 {
+		t.Errorf("got %d indexed quotes, wanted 3", indexes.search.Len())
+	}
+}
+
+// slowAdds is a DB taking its time to add quotes
+type slowAdds struct {
+	DB
+}
+
+func (s slowAdds) AddQuote(ctx context.Context, request AddQuoteRequest) (QuoteResponse, error) {
+	time.Sleep(10 * time.Millisecond)
+	return s.DB.AddQuote(ctx, request)
+}
+
+func TestIndexedDBConcurrentDuplicates(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewIndexedDB(slowAdds{NewMemoryStore()}, search.Config{}, search.Config{})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	defer db.Close()
+
+	// The same quote added at once is only stored once
+	errs := make([]error, 10)
+	var wg sync.WaitGroup
+	for n := range errs {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			_, errs[n] = db.AddQuote(ctx, conformanceQuotes[0])
+		}(n)
+	}
+	wg.Wait()
+
+	added := 0
+	for _, err := range errs {
+		var duplicate ErrProbableDuplicate
+		switch {
+		case err == nil:
+			added++
+		case !errors.As(err, &duplicate):
+			t.Errorf("got %v, wanted a probable duplicate", err)
+		}
+	}
+	if added != 1 {
+		t.Errorf("got the quote added %d times, wanted once", added)
+	}
+}
+
+func TestNewIndexedDBUnknownMetric(t *testing.T) {
+	_, err := NewIndexedDB(NewMemoryStore(), search.Config{Metric: "soundex"}, search.Config{})
+	if err == nil {
+		t.Errorf("an unknown metric should be rejected")
+	}
+}
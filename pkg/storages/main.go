@@ -1,32 +1,111 @@
 package storages
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
 type DB interface {
-	// Tables
-	CreateQuotesTable() error
-	DeleteQuotesTable() error
-	CreateVotesTable() error
-	DeleteVotesTable() error
-
-	// Get
-	GetQuotes(MultipleSpecifiedQuotesRequest) ([]QuoteResponse, error)
-	GetLastQuotes(MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
-	GetRandomQuotes(MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
-	GetTopQuotes(request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
-	GetFlopQuotes(request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
-
-	// Add, Delete
-	AddQuote(AddQuoteRequest) (string, error)
-	DeleteQuote(UniqueSpecifiedQuoteRequest) error
-
-	// Votes
-	UpVoteQuote(request VoteQuoteRequest) error
-	UnVoteQuote(request VoteQuoteRequest) error
-	DownVoteQuote(request VoteQuoteRequest) error
+	// Get, the listings keep the quotes matching the filter of the request and
+	// return ErrInvalidTag when filtering on an invalid tag
+	GetQuotes(ctx context.Context, request MultipleSpecifiedQuotesRequest) ([]QuoteResponse, error)
+	GetLastQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
+	GetRandomQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
+	GetTopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
+	GetFlopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error)
+
+	// Add, Delete, AddQuote returns ErrForbiddenContext, ErrProbableDuplicate or ErrInvalidTag,
+	// DeleteQuote returns ErrNotFound for unknown or deleted quotes
+	AddQuote(ctx context.Context, request AddQuoteRequest) (QuoteResponse, error)
+	DeleteQuote(ctx context.Context, request DeleteQuoteRequest) error
+
+	// Trash, RestoreQuote and PurgeQuote return ErrNotFound for the quotes that
+	// are not in the trash. Purging deletes the quotes with their votes,
+	// revisions and tags for good.
+	GetTrash(ctx context.Context, request TrashRequest) ([]QuoteResponse, error)
+	RestoreQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) (QuoteResponse, error)
+	PurgeQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) error
+	// PurgeTrash purges the quotes trashed for longer than olderThan and returns how many there were
+	PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error)
+
+	// Edit, they return ErrNotFound for unknown or deleted quotes and unknown
+	// revisions, EditQuote returns ErrForbiddenContext. Every change is kept as
+	// a new revision, a rollback included.
+	EditQuote(ctx context.Context, request EditQuoteRequest) (QuoteResponse, error)
+	RollbackQuote(ctx context.Context, request RollbackQuoteRequest) (QuoteResponse, error)
+	GetRevisions(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]RevisionResponse, error)
+
+	// Votes, they return ErrNotFound for unknown or deleted quotes
+	UpVoteQuote(ctx context.Context, request VoteQuoteRequest) error
+	UnVoteQuote(ctx context.Context, request VoteQuoteRequest) error
+	DownVoteQuote(ctx context.Context, request VoteQuoteRequest) error
+
+	// Posts, the messages the bot posted quotes in. AddPost skips the quotes
+	// of other groups and replaces the quotes of an edited message, GetPosts
+	// returns the latest posts of a quote of the group with all their quotes,
+	// the latest first.
+	AddPost(ctx context.Context, request AddPostRequest) error
+	GetPosts(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]PostResponse, error)
+
+	// Speakers, quotes are attributed to the speaker matching their context,
+	// the lines of the dialogues to the speaker they name, a new one is
+	// created for unknown names. AliasSpeaker and MergeSpeakers
+	// return ErrSpeakerNotFound, AliasSpeaker returns ErrAliasTaken.
+	GetSpeakers(ctx context.Context, chatID int64) ([]SpeakerResponse, error)
+	AliasSpeaker(ctx context.Context, request AliasSpeakerRequest) (SpeakerResponse, error)
+	MergeSpeakers(ctx context.Context, request MergeSpeakersRequest) (SpeakerResponse, error)
+
+	// Tags, TagQuote returns ErrNotFound for unknown or deleted quotes and ErrInvalidTag
+	TagQuote(ctx context.Context, request TagQuoteRequest) (QuoteResponse, error)
+	GetTags(ctx context.Context, chatID int64) ([]TagResponse, error)
 
 	// Search
-	SearchWord(request SearchExpressionRequest) ([]QuoteResponse, error)
-	SearchExpression(request SearchExpressionRequest) ([]QuoteResponse, error)
+	SearchWord(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error)
+	SearchExpression(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error)
 
 	// DB
+	// GetContents returns the content of every available quote of the group by ID
+	GetContents(ctx context.Context, chatID int64) (map[int]string, error)
+	// AdoptQuotes moves the quotes stored before the groups were recorded, in
+	// chat 0, to the group with their votes and speakers and returns how many
+	// there were
+	AdoptQuotes(ctx context.Context, chatID int64) (int, error)
+	// ReindexScores recomputes the score, upvotes and downvotes of every quote from its votes
+	ReindexScores(ctx context.Context) error
 	Close() error
 }
+
+// NewDB opens the storage backend selected in the configuration, the search
+// indexes of each group are loaded on first use
+func NewDB(cfg Config) (DB, error) {
+	db, err := openBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := NewIndexedDB(db, cfg.Search, cfg.Duplicates)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return indexed, nil
+}
+
+func openBackend(cfg Config) (DB, error) {
+	switch cfg.Backend {
+	case "", BackendSqlite:
+		if cfg.Sqlite == nil {
+			return nil, errors.New("storage.sqlite.path must be set")
+		}
+		return NewSqliteWrapper(*cfg.Sqlite)
+	case BackendPostgres:
+		if cfg.Postgres == nil || cfg.Postgres.DSN == "" {
+			return nil, errors.New("storage.postgres.dsn must be set")
+		}
+		return NewPostgresStore(*cfg.Postgres)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
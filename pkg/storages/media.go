@@ -0,0 +1,28 @@
+package storages
+
+import "database/sql"
+
+// checkMedia returns ErrInvalidMedia unless the media is zero or a known type
+// with a file
+func checkMedia(media Media) error {
+	if media.IsZero() {
+		return nil
+	}
+	switch media.Type {
+	case MediaPhoto, MediaVoice, MediaVideo, MediaSticker:
+	default:
+		return ErrInvalidMedia
+	}
+	if media.FileID == "" {
+		return ErrInvalidMedia
+	}
+	return nil
+}
+
+// mediaColumns are the type and the file of a media as stored, NULL for the text quotes
+func mediaColumns(media Media) (sql.NullString, sql.NullString) {
+	if media.IsZero() {
+		return sql.NullString{}, sql.NullString{}
+	}
+	return sql.NullString{String: string(media.Type), Valid: true}, sql.NullString{String: media.FileID, Valid: true}
+}
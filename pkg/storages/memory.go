@@ -0,0 +1,974 @@
+package storages
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goquotebot/pkg/search"
+)
+
+// MemoryStore keeps quotes and votes in memory. It behaves like SqliteWrapper
+// and is meant for tests and local runs where no persistence is needed.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	quotes    []QuoteResponse
+	votes     map[int]map[int64]int
+	revisions map[int][]RevisionResponse
+	nextID    int
+
+	// speakers keep their aliases, their quotes are counted on read
+	speakers      []SpeakerResponse
+	nextSpeakerID int
+
+	// posts are the messages the quotes were posted in, the latest last
+	posts []PostResponse
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		votes:     make(map[int]map[int64]int),
+		revisions: make(map[int][]RevisionResponse),
+		nextID:    101,
+
+		nextSpeakerID: 1,
+	}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) AddQuote(ctx context.Context, request AddQuoteRequest) (QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return QuoteResponse{}, err
+	}
+
+	contextIsAllowed := checkContext(request.QuoteContext)
+	if !contextIsAllowed {
+		return QuoteResponse{}, ErrForbiddenContext
+	}
+
+	tags, err := tagNames(request.Tags)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = checkMedia(request.Media)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+
+	err = checkStoredDuplicate(ctx, m, request)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	quote := QuoteResponse{
+		QuoteID:      m.nextID,
+		ChatID:       request.ChatID,
+		Author:       request.Author,
+		Content:      request.Content,
+		QuoteContext: request.QuoteContext,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+		Tags:         sortedTags(tags),
+		SaidAt:       saidAt(request.SaidAt).Time,
+		MessageID:    request.MessageID,
+		Media:        request.Media,
+		IsActive:     true,
+	}
+	quote.SpeakerID, quote.Speaker, quote.Lines = m.speakersOf(request.ChatID, request.Content, request.QuoteContext, request.TelegramIDs)
+	m.quotes = append(m.quotes, quote)
+	m.revisions[quote.QuoteID] = []RevisionResponse{{
+		QuoteID:      quote.QuoteID,
+		Revision:     1,
+		Content:      quote.Content,
+		QuoteContext: quote.QuoteContext,
+		Editor:       quote.Author,
+		EditedAt:     quote.CreatedAt,
+	}}
+	m.nextID++
+	return quote, nil
+}
+
+func (m *MemoryStore) DeleteQuote(ctx context.Context, request DeleteQuoteRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(request.ChatID, request.QuoteID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.quotes[i].IsActive = false
+	m.quotes[i].DeletedAt = time.Now().UTC().Truncate(time.Second)
+	m.quotes[i].DeletedBy = request.Deleter
+	return nil
+}
+
+func (m *MemoryStore) GetTrash(ctx context.Context, request TrashRequest) ([]QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var quotes []QuoteResponse
+	for _, quote := range m.quotes {
+		if !quote.IsActive && quote.ChatID == request.ChatID {
+			quotes = append(quotes, m.withVotes(quote))
+		}
+	}
+	sort.Slice(quotes, func(i, j int) bool {
+		if !quotes[i].DeletedAt.Equal(quotes[j].DeletedAt) {
+			return quotes[i].DeletedAt.After(quotes[j].DeletedAt)
+		}
+		return quotes[i].QuoteID > quotes[j].QuoteID
+	})
+	return limitQuotes(offsetQuotes(quotes, request.Offset), request.QuoteNb), nil
+}
+
+func (m *MemoryStore) RestoreQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) (QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return QuoteResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.trashIndexOf(request.ChatID, request.QuoteID)
+	if i < 0 {
+		return QuoteResponse{}, ErrNotFound
+	}
+	m.quotes[i].IsActive = true
+	m.quotes[i].DeletedAt = time.Time{}
+	m.quotes[i].DeletedBy = ""
+	return m.withVotes(m.quotes[i]), nil
+}
+
+func (m *MemoryStore) PurgeQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.trashIndexOf(request.ChatID, request.QuoteID) < 0 {
+		return ErrNotFound
+	}
+	m.purge(func(quote QuoteResponse) bool { return quote.QuoteID == request.QuoteID })
+	return nil
+}
+
+func (m *MemoryStore) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := time.Now().UTC().Add(-olderThan)
+	return m.purge(func(quote QuoteResponse) bool { return quote.DeletedAt.Before(before) }), nil
+}
+
+func (m *MemoryStore) EditQuote(ctx context.Context, request EditQuoteRequest) (QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return QuoteResponse{}, err
+	}
+	if !checkContext(request.QuoteContext) {
+		return QuoteResponse{}, ErrForbiddenContext
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.editQuote(request)
+}
+
+// RollbackQuote restores the content and context of a revision as a new revision
+func (m *MemoryStore) RollbackQuote(ctx context.Context, request RollbackQuoteRequest) (QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return QuoteResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, revision := range m.revisions[request.QuoteID] {
+		if revision.Revision == request.Revision {
+			return m.editQuote(EditQuoteRequest{
+				ChatID:       request.ChatID,
+				QuoteID:      request.QuoteID,
+				Content:      revision.Content,
+				QuoteContext: revision.QuoteContext,
+				Editor:       request.Editor,
+			})
+		}
+	}
+	return QuoteResponse{}, ErrNotFound
+}
+
+func (m *MemoryStore) GetRevisions(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]RevisionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.indexOf(request.ChatID, request.QuoteID) < 0 {
+		return nil, ErrNotFound
+	}
+	return append([]RevisionResponse(nil), m.revisions[request.QuoteID]...), nil
+}
+
+func (m *MemoryStore) GetQuotes(ctx context.Context, request MultipleSpecifiedQuotesRequest) ([]QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[int]bool, len(request.QuoteIDs))
+	for _, quoteID := range request.QuoteIDs {
+		id, err := strconv.Atoi(quoteID)
+		if err != nil {
+			continue
+		}
+		wanted[id] = true
+	}
+
+	var value []QuoteResponse
+	for _, quote := range m.activeQuotes(request.ChatID) {
+		if wanted[quote.QuoteID] {
+			value = append(value, quote)
+		}
+	}
+	return value, nil
+}
+
+func (m *MemoryStore) GetLastQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	quotes, err := m.filteredQuotes(request)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].QuoteID > quotes[j].QuoteID
+	})
+	return limitQuotes(offsetQuotes(quotes, request.Offset), request.QuoteNb), nil
+}
+
+func (m *MemoryStore) GetRandomQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	quotes, err := m.filteredQuotes(request)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(quotes), func(i, j int) {
+		quotes[i], quotes[j] = quotes[j], quotes[i]
+	})
+	return limitQuotes(offsetQuotes(quotes, request.Offset), request.QuoteNb), nil
+}
+
+func (m *MemoryStore) GetTopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filtered, err := m.filteredQuotes(request)
+	if err != nil {
+		return nil, err
+	}
+	var quotes []QuoteResponse
+	for _, quote := range filtered {
+		if len(m.votes[quote.QuoteID]) > 0 && quote.Votes >= 0 {
+			quotes = append(quotes, quote)
+		}
+	}
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].Votes > quotes[j].Votes
+	})
+	return limitQuotes(offsetQuotes(quotes, request.Offset), request.QuoteNb), nil
+}
+
+func (m *MemoryStore) GetFlopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filtered, err := m.filteredQuotes(request)
+	if err != nil {
+		return nil, err
+	}
+	var quotes []QuoteResponse
+	for _, quote := range filtered {
+		if len(m.votes[quote.QuoteID]) > 0 && quote.Votes <= 0 {
+			quotes = append(quotes, quote)
+		}
+	}
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].Votes < quotes[j].Votes
+	})
+	return limitQuotes(offsetQuotes(quotes, request.Offset), request.QuoteNb), nil
+}
+
+func (m *MemoryStore) UnVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexOf(request.ChatID, request.QuoteID) < 0 {
+		return ErrNotFound
+	}
+	delete(m.votes[request.QuoteID], request.Voter)
+	return nil
+}
+
+func (m *MemoryStore) UpVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	return m.vote(ctx, request, 1)
+}
+
+func (m *MemoryStore) DownVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	return m.vote(ctx, request, -1)
+}
+
+// ReindexScores has nothing to do, scores are computed from the votes on every read
+func (m *MemoryStore) ReindexScores(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// SearchWord matches every word of the expression as a word prefix of the
+// content or context, diacritics folded like the full-text indexes
+func (m *MemoryStore) SearchWord(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := searchTerms(foldText(request.Expression))
+	if len(terms) == 0 {
+		return []QuoteResponse{}, nil
+	}
+
+	var quotes []QuoteResponse
+	relevance := make(map[int]int)
+	for _, quote := range m.activeQuotes(request.ChatID) {
+		content := searchTerms(foldText(quote.Content))
+		quoteContext := searchTerms(foldText(quote.QuoteContext))
+		score := 0
+		for _, term := range terms {
+			matches := 2*countPrefixed(content, term) + countPrefixed(quoteContext, term)
+			if matches == 0 {
+				score = 0
+				break
+			}
+			score += matches
+		}
+		if score > 0 {
+			quotes = append(quotes, quote)
+			relevance[quote.QuoteID] = score
+		}
+	}
+	sort.SliceStable(quotes, func(i, j int) bool {
+		if relevance[quotes[i].QuoteID] != relevance[quotes[j].QuoteID] {
+			return relevance[quotes[i].QuoteID] > relevance[quotes[j].QuoteID]
+		}
+		return quotes[i].QuoteID > quotes[j].QuoteID
+	})
+	return limitQuotes(offsetQuotes(quotes, request.Offset), request.QuoteNb), nil
+}
+
+func (m *MemoryStore) SearchExpression(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	index, err := loadIndex(ctx, m, request.ChatID, search.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return searchIndex(ctx, m, index, request)
+}
+
+func (m *MemoryStore) GetContents(ctx context.Context, chatID int64) (map[int]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	quoteArray := make(map[int]string)
+	for _, quote := range m.activeQuotes(chatID) {
+		quoteArray[quote.QuoteID] = quote.Content
+	}
+	return quoteArray, nil
+}
+
+func (m *MemoryStore) AdoptQuotes(ctx context.Context, chatID int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	adopted := 0
+	for i := range m.quotes {
+		if m.quotes[i].ChatID == 0 {
+			m.quotes[i].ChatID = chatID
+			adopted++
+		}
+	}
+	for i := range m.speakers {
+		if m.speakers[i].ChatID == 0 {
+			m.speakers[i].ChatID = chatID
+		}
+	}
+	return adopted, nil
+}
+
+func (m *MemoryStore) TagQuote(ctx context.Context, request TagQuoteRequest) (QuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return QuoteResponse{}, err
+	}
+
+	add, err := tagNames(request.Add)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	remove, err := tagNames(request.Remove)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(request.ChatID, request.QuoteID)
+	if i < 0 {
+		return QuoteResponse{}, ErrNotFound
+	}
+	removed := make(map[string]bool)
+	for _, tag := range remove {
+		removed[tag] = true
+	}
+	var tags []string
+	for _, tag := range append(append([]string(nil), m.quotes[i].Tags...), add...) {
+		if !removed[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	// The slice is replaced rather than changed, copies of the quote keep the old one
+	m.quotes[i].Tags = sortedTags(tags)
+	return m.withVotes(m.quotes[i]), nil
+}
+
+func (m *MemoryStore) GetTags(ctx context.Context, chatID int64) ([]TagResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, quote := range m.activeQuotes(chatID) {
+		for _, tag := range quote.Tags {
+			counts[tag]++
+		}
+	}
+	var tags []TagResponse
+	for tag, quotes := range counts {
+		tags = append(tags, TagResponse{Tag: tag, Quotes: quotes})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Quotes != tags[j].Quotes {
+			return tags[i].Quotes > tags[j].Quotes
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
+
+func (m *MemoryStore) AddPost(ctx context.Context, request AddPostRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	posts := m.posts[:0]
+	for _, post := range m.posts {
+		if post.PostChatID != request.PostChatID || post.MessageID != request.MessageID {
+			posts = append(posts, post)
+		}
+	}
+	m.posts = posts
+	post := PostResponse{PostChatID: request.PostChatID, MessageID: request.MessageID, Caption: request.Caption}
+	for _, quoteID := range request.QuoteIDs {
+		if m.groupOf(quoteID) == request.ChatID {
+			post.QuoteIDs = append(post.QuoteIDs, quoteID)
+		}
+	}
+	if len(post.QuoteIDs) > 0 {
+		m.posts = append(m.posts, post)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetPosts(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]PostResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var posts []PostResponse
+	if m.groupOf(request.QuoteID) != request.ChatID {
+		return posts, nil
+	}
+	for i := len(m.posts) - 1; i >= 0 && len(posts) < maxPosts; i-- {
+		post := m.posts[i]
+		for _, quoteID := range post.QuoteIDs {
+			if quoteID == request.QuoteID {
+				post.QuoteIDs = append([]int(nil), post.QuoteIDs...)
+				posts = append(posts, post)
+				break
+			}
+		}
+	}
+	return posts, nil
+}
+
+// groupOf returns the group of the quote with the given ID, trashed or not,
+// -1 when there is none, m.mu must be held
+func (m *MemoryStore) groupOf(quoteID int) int64 {
+	for _, quote := range m.quotes {
+		if quote.QuoteID == quoteID {
+			return quote.ChatID
+		}
+	}
+	return -1
+}
+
+func (m *MemoryStore) GetSpeakers(ctx context.Context, chatID int64) ([]SpeakerResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var speakers []SpeakerResponse
+	for _, speaker := range m.speakers {
+		if speaker.ChatID == chatID {
+			speakers = append(speakers, m.withQuotes(speaker))
+		}
+	}
+	sort.SliceStable(speakers, func(i, j int) bool {
+		if speakers[i].Quotes != speakers[j].Quotes {
+			return speakers[i].Quotes > speakers[j].Quotes
+		}
+		return speakers[i].Name < speakers[j].Name
+	})
+	return speakers, nil
+}
+
+func (m *MemoryStore) AliasSpeaker(ctx context.Context, request AliasSpeakerRequest) (SpeakerResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return SpeakerResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.speakerIndexOf(request.ChatID, request.Speaker)
+	alias := speakerName(request.Alias)
+	if i < 0 || alias == "" {
+		return SpeakerResponse{}, ErrSpeakerNotFound
+	}
+	switch owner := m.speakerIndexOf(request.ChatID, alias); {
+	case owner < 0:
+		m.speakers[i].Aliases = append(m.speakers[i].Aliases, alias)
+		sort.Strings(m.speakers[i].Aliases)
+	case owner != i:
+		return SpeakerResponse{}, ErrAliasTaken
+	}
+	return m.withQuotes(m.speakers[i]), nil
+}
+
+func (m *MemoryStore) MergeSpeakers(ctx context.Context, request MergeSpeakersRequest) (SpeakerResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return SpeakerResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from := m.speakerIndexOf(request.ChatID, request.From)
+	into := m.speakerIndexOf(request.ChatID, request.Into)
+	if from < 0 || into < 0 {
+		return SpeakerResponse{}, ErrSpeakerNotFound
+	}
+	if from == into {
+		return m.withQuotes(m.speakers[into]), nil
+	}
+
+	merged := &m.speakers[into]
+	removed := m.speakers[from]
+	merged.Aliases = append(merged.Aliases, removed.Name)
+	merged.Aliases = append(merged.Aliases, removed.Aliases...)
+	sort.Strings(merged.Aliases)
+	if merged.TelegramID == 0 {
+		merged.TelegramID = removed.TelegramID
+	}
+	for i := range m.quotes {
+		if m.quotes[i].SpeakerID == removed.SpeakerID {
+			m.quotes[i].SpeakerID = merged.SpeakerID
+			m.quotes[i].Speaker = merged.Name
+		}
+		if m.quotes[i].Lines == nil {
+			continue
+		}
+		lines := append([]QuoteLine(nil), m.quotes[i].Lines...)
+		for j := range lines {
+			if lines[j].SpeakerID == removed.SpeakerID {
+				lines[j].SpeakerID = merged.SpeakerID
+				lines[j].Speaker = merged.Name
+			}
+		}
+		m.quotes[i].Lines = lines
+	}
+
+	speaker := *merged
+	m.speakers = append(m.speakers[:from], m.speakers[from+1:]...)
+	return m.withQuotes(speaker), nil
+}
+
+//============================
+//helpers, appendice functions
+
+func (m *MemoryStore) vote(ctx context.Context, request VoteQuoteRequest, value int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexOf(request.ChatID, request.QuoteID) < 0 {
+		return ErrNotFound
+	}
+	if m.votes[request.QuoteID] == nil {
+		m.votes[request.QuoteID] = make(map[int64]int)
+	}
+	m.votes[request.QuoteID][request.Voter] = value
+	return nil
+}
+
+// editQuote records the new version of the quote, m.mu must be held
+func (m *MemoryStore) editQuote(request EditQuoteRequest) (QuoteResponse, error) {
+	i := m.indexOf(request.ChatID, request.QuoteID)
+	if i < 0 {
+		return QuoteResponse{}, ErrNotFound
+	}
+
+	quote := &m.quotes[i]
+	diff := revisionDiff(quote.Content, quote.QuoteContext, request.Content, request.QuoteContext)
+	if diff != "" {
+		quote.Content = request.Content
+		quote.QuoteContext = request.QuoteContext
+		quote.SpeakerID, quote.Speaker, quote.Lines = m.speakersOf(request.ChatID, request.Content, request.QuoteContext, nil)
+		m.revisions[quote.QuoteID] = append(m.revisions[quote.QuoteID], RevisionResponse{
+			QuoteID:      quote.QuoteID,
+			Revision:     len(m.revisions[quote.QuoteID]) + 1,
+			Content:      request.Content,
+			QuoteContext: request.QuoteContext,
+			Editor:       request.Editor,
+			EditedAt:     time.Now().UTC().Truncate(time.Second),
+			Diff:         diff,
+		})
+	}
+
+	for _, active := range m.activeQuotes(request.ChatID) {
+		if active.QuoteID == quote.QuoteID {
+			return active, nil
+		}
+	}
+	return QuoteResponse{}, ErrNotFound
+}
+
+// purge deletes the trashed quotes matching the condition with their votes,
+// revisions and posts and returns how many there were, m.mu must be held
+func (m *MemoryStore) purge(condition func(QuoteResponse) bool) int {
+	kept := m.quotes[:0]
+	purged := 0
+	for _, quote := range m.quotes {
+		if quote.IsActive || !condition(quote) {
+			kept = append(kept, quote)
+			continue
+		}
+		delete(m.votes, quote.QuoteID)
+		delete(m.revisions, quote.QuoteID)
+		m.unpost(quote.QuoteID)
+		purged++
+	}
+	m.quotes = kept
+	return purged
+}
+
+// unpost takes the quote off the posts, dropping the posts left empty, m.mu must be held
+func (m *MemoryStore) unpost(quoteID int) {
+	kept := m.posts[:0]
+	for _, post := range m.posts {
+		quoteIDs := make([]int, 0, len(post.QuoteIDs))
+		for _, id := range post.QuoteIDs {
+			if id != quoteID {
+				quoteIDs = append(quoteIDs, id)
+			}
+		}
+		if len(quoteIDs) > 0 {
+			post.QuoteIDs = quoteIDs
+			kept = append(kept, post)
+		}
+	}
+	m.posts = kept
+}
+
+// trashIndexOf returns the position of the trashed quote of the group with the given ID, or -1
+func (m *MemoryStore) trashIndexOf(chatID int64, quoteID int) int {
+	for i := range m.quotes {
+		if m.quotes[i].QuoteID == quoteID && m.quotes[i].ChatID == chatID && !m.quotes[i].IsActive {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOf returns the position of the available quote of the group with the given ID, or -1
+func (m *MemoryStore) indexOf(chatID int64, quoteID int) int {
+	for i := range m.quotes {
+		if m.quotes[i].QuoteID == quoteID && m.quotes[i].ChatID == chatID && m.quotes[i].IsActive {
+			return i
+		}
+	}
+	return -1
+}
+
+// activeQuotes returns a copy of the available quotes of the group, ordered by
+// ID, with their votes
+func (m *MemoryStore) activeQuotes(chatID int64) []QuoteResponse {
+	quotes := make([]QuoteResponse, 0, len(m.quotes))
+	for _, quote := range m.quotes {
+		if quote.IsActive && quote.ChatID == chatID {
+			quotes = append(quotes, m.withVotes(quote))
+		}
+	}
+	return quotes
+}
+
+// filteredQuotes returns the available quotes of the group matching the
+// filter of the request, ordered by ID, with their votes
+func (m *MemoryStore) filteredQuotes(request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	quotes := m.activeQuotes(request.ChatID)
+	if request.Filter.Tag == "" {
+		return quotes, nil
+	}
+	tag, err := tagName(request.Filter.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := quotes[:0]
+	for _, quote := range quotes {
+		i := sort.SearchStrings(quote.Tags, tag)
+		if i < len(quote.Tags) && quote.Tags[i] == tag {
+			filtered = append(filtered, quote)
+		}
+	}
+	return filtered, nil
+}
+
+// withVotes sets the vote counts of the quote
+func (m *MemoryStore) withVotes(quote QuoteResponse) QuoteResponse {
+	quote.Votes, quote.UpVotes, quote.DownVotes = 0, 0, 0
+	for _, value := range m.votes[quote.QuoteID] {
+		quote.Votes += value
+		if value > 0 {
+			quote.UpVotes++
+		} else {
+			quote.DownVotes++
+		}
+	}
+	return quote
+}
+
+// speakerFor returns the ID and name of the speaker matching the context,
+// created if unknown, or nothing when the context names nobody. A Telegram
+// user, when known, is linked to the speaker and matches it first, the context
+// becoming one of its aliases if free. m.mu must be held.
+func (m *MemoryStore) speakerFor(chatID int64, quoteContext string, telegramID int64) (int, string) {
+	name := speakerName(quoteContext)
+	if name == "" {
+		return 0, ""
+	}
+	if telegramID != 0 {
+		for i, speaker := range m.speakers {
+			if speaker.ChatID != chatID || speaker.TelegramID != telegramID {
+				continue
+			}
+			if m.speakerIndexOf(chatID, name) < 0 {
+				m.speakers[i].Aliases = append(m.speakers[i].Aliases, name)
+				sort.Strings(m.speakers[i].Aliases)
+			}
+			return speaker.SpeakerID, speaker.Name
+		}
+	}
+
+	i := m.speakerIndexOf(chatID, name)
+	if i < 0 {
+		m.speakers = append(m.speakers, SpeakerResponse{SpeakerID: m.nextSpeakerID, ChatID: chatID, Name: name})
+		m.nextSpeakerID++
+		i = len(m.speakers) - 1
+	}
+	if m.speakers[i].TelegramID == 0 {
+		m.speakers[i].TelegramID = telegramID
+	}
+	return m.speakers[i].SpeakerID, m.speakers[i].Name
+}
+
+// speakersOf returns the ID and name of the speaker of a quote, none for the
+// dialogues, and the lines of the dialogues with their speakers
+func (m *MemoryStore) speakersOf(chatID int64, content string, quoteContext string, telegramIDs map[string]int64) (int, string, []QuoteLine) {
+	lines, ok := ParseDialogue(content)
+	if !ok {
+		speakerID, speaker := m.speakerFor(chatID, quoteContext, telegramIDs[speakerName(quoteContext)])
+		return speakerID, speaker, nil
+	}
+	for i := range lines {
+		lines[i].SpeakerID, lines[i].Speaker = m.speakerFor(chatID, lines[i].Speaker, telegramIDs[lines[i].Speaker])
+	}
+	return 0, "", lines
+}
+
+// speakerIndexOf returns the position of the speaker of the group whose name or
+// an alias matches whatever the case, or -1
+func (m *MemoryStore) speakerIndexOf(chatID int64, name string) int {
+	name = strings.ToLower(speakerName(name))
+	for i, speaker := range m.speakers {
+		if speaker.ChatID != chatID {
+			continue
+		}
+		if strings.ToLower(speaker.Name) == name {
+			return i
+		}
+		for _, alias := range speaker.Aliases {
+			if strings.ToLower(alias) == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// withQuotes counts the available quotes of the speaker, the dialogues with
+// one of their lines
+func (m *MemoryStore) withQuotes(speaker SpeakerResponse) SpeakerResponse {
+	speaker.Aliases = append([]string(nil), speaker.Aliases...)
+	speaker.Quotes = 0
+	for _, quote := range m.quotes {
+		if quote.IsActive && (quote.SpeakerID == speaker.SpeakerID || speaksIn(speaker.SpeakerID, quote.Lines)) {
+			speaker.Quotes++
+		}
+	}
+	return speaker
+}
+
+// speaksIn tells whether the speaker has one of the lines
+func speaksIn(speakerID int, lines []QuoteLine) bool {
+	for _, line := range lines {
+		if line.SpeakerID == speakerID {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedTags returns the tags sorted without duplicates, nil when there are
+// none as the SQL backends do
+func sortedTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	unique := sorted[:1]
+	for _, tag := range sorted[1:] {
+		if tag != unique[len(unique)-1] {
+			unique = append(unique, tag)
+		}
+	}
+	return unique
+}
+
+// offsetQuotes skips the first quotes, nil when there are no more
+func offsetQuotes(quotes []QuoteResponse, offset int) []QuoteResponse {
+	if offset >= len(quotes) {
+		return nil
+	}
+	if offset > 0 {
+		return quotes[offset:]
+	}
+	return quotes
+}
+
+func limitQuotes(quotes []QuoteResponse, n int) []QuoteResponse {
+	if n >= 0 && len(quotes) > n {
+		return quotes[:n]
+	}
+	return quotes
+}
+
+func countPrefixed(words []string, prefix string) int {
+	count := 0
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,279 @@
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUnknownVersion = errors.New("unknown schema version")
+	ErrIrreversible   = errors.New("migration cannot be reverted")
+
+	regexMigrationFile = regexp.MustCompile(`^([0-9]{4})_(\w+)\.(up|down)\.sql$`)
+
+	//go:embed sqlite/*.sql
+	sqliteFiles embed.FS
+	//go:embed postgres/*.sql
+	postgresFiles embed.FS
+)
+
+// Migration is a numbered schema change, read from a pair of
+// <version>_<name>.up.sql and <version>_<name>.down.sql files
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status tells whether a migration has been applied to the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// NewSqliteMigrator returns a migrator holding the SQLite schema migrations
+func NewSqliteMigrator(db *sql.DB) (*Migrator, error) {
+	return NewMigrator(db, sqliteFiles, "sqlite")
+}
+
+// NewPostgresMigrator returns a migrator holding the PostgreSQL schema migrations
+func NewPostgresMigrator(db *sql.DB) (*Migrator, error) {
+	return NewMigrator(db, postgresFiles, "postgres")
+}
+
+// NewMigrator loads the migrations stored in the dir folder of fsys
+func NewMigrator(db *sql.DB, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:         db,
+		Migrations: migrations,
+	}, nil
+}
+
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		matches := regexMigrationFile.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has several names: %q and %q", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Init creates the schema_version table if it does not exist yet
+func (m *Migrator) Init() error {
+	_, err := m.DB.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY, name VARCHAR(255) NOT NULL, appliedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	return err
+}
+
+// Latest returns the highest known migration version
+func (m *Migrator) Latest() int {
+	return len(m.Migrations)
+}
+
+// Version returns the version the database schema is currently at
+func (m *Migrator) Version() (int, error) {
+	err := m.Init()
+	if err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	err = m.DB.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status() ([]Status, error) {
+	err := m.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := m.DB.Query("SELECT version, appliedAt FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	applied := make(map[int]time.Time)
+	for results.Next() {
+		var version int
+		var appliedAt sql.NullTime
+		err = results.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt.Time
+	}
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up() error {
+	return m.To(m.Latest())
+}
+
+// To applies or reverts migrations until the schema is at the given version
+func (m *Migrator) To(version int) error {
+	if version < 0 || version > m.Latest() {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	for current < version {
+		err = m.apply(m.Migrations[current])
+		if err != nil {
+			return err
+		}
+		current++
+	}
+
+	for current > version {
+		err = m.revert(m.Migrations[current-1])
+		if err != nil {
+			return err
+		}
+		current--
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(migration Migration) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(migration.Up)
+	if err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_version (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) revert(migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("%w: %d (%s)", ErrIrreversible, migration.Version, migration.Name)
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(migration.Down)
+	if err != nil {
+		return fmt.Errorf("reverting migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = tx.Exec("DELETE FROM schema_version WHERE version = $1", migration.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,704 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// skipWithoutFullText skips the tests reaching the search_index migration when
+// go-sqlite3 was built without the sqlite_fts5 tag
+func skipWithoutFullText(t *testing.T, db *sql.DB) {
+	t.Helper()
+	var enabled bool
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if !enabled {
+		t.Skip("built without -tags sqlite_fts5")
+	}
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	return count == 1
+}
+
+func TestLoadMigrations(t *testing.T) {
+	samples := []struct {
+		Input         fstest.MapFS
+		ErrorExpected bool
+		Expected      int
+	}{
+		{
+			Input: fstest.MapFS{
+				"m/0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER)")},
+				"m/0001_first.down.sql":  {Data: []byte("DROP TABLE a")},
+				"m/0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER)")},
+				"m/0002_second.down.sql": {Data: []byte("DROP TABLE b")},
+			},
+			Expected: 2,
+		}, {
+			Input: fstest.MapFS{
+				"m/0001_first.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER)")},
+				"m/0003_third.up.sql": {Data: []byte("CREATE TABLE c (id INTEGER)")},
+			},
+			ErrorExpected: true,
+		}, {
+			Input: fstest.MapFS{
+				"m/0001_first.down.sql": {Data: []byte("DROP TABLE a")},
+			},
+			ErrorExpected: true,
+		}, {
+			Input: fstest.MapFS{
+				"m/first.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER)")},
+			},
+			ErrorExpected: true,
+		},
+	}
+
+	for _, sample := range samples {
+		migrations, err := LoadMigrations(sample.Input, "m")
+		if (err != nil) != sample.ErrorExpected {
+			t.Errorf("got error %v, expected an error: %t", err, sample.ErrorExpected)
+			continue
+		}
+		if len(migrations) != sample.Expected {
+			t.Errorf("got %d migrations, wanted %d", len(migrations), sample.Expected)
+		}
+	}
+}
+
+func TestSqliteMigrations(t *testing.T) {
+	db := newTestDB(t)
+	skipWithoutFullText(t, db)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.Up()
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	version, err := m.Version()
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if version != m.Latest() {
+		t.Errorf("got version %d, wanted %d", version, m.Latest())
+	}
+	for _, table := range []string{"Quotes", "Votes"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("table %s should exist", table)
+		}
+	}
+
+	// Running it twice must be a no-op
+	err = m.Up()
+	if err != nil {
+		t.Errorf("error %v should not have occured", err)
+	}
+
+	err = m.To(0)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	for _, table := range []string{"Quotes", "Votes"} {
+		if tableExists(t, db, table) {
+			t.Errorf("table %s should have been dropped", table)
+		}
+	}
+
+	err = m.To(m.Latest() + 1)
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("got %v instead of %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestMigrationAdoptsLegacySchema(t *testing.T) {
+	db := newTestDB(t)
+	skipWithoutFullText(t, db)
+	_, err := db.Exec("CREATE TABLE Quotes (quoteID INTEGER PRIMARY KEY AUTOINCREMENT, `content` VARCHAR(512) NOT NULL, `context` VARCHAR(255) NOT NULL, `author` VARCHAR(255) NOT NULL, `createdAt` DATETIME DEFAULT CURRENT_TIMESTAMP, `deletedAt` DATETIME DEFAULT NULL, `isAvailable` BOOLEAN NOT NULL); INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('content', 'context', 'author', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.Up()
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM Quotes").Scan(&count)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if count != 1 {
+		t.Errorf("got %d quotes, wanted 1", count)
+	}
+}
+
+func TestUniqueVotesMigration(t *testing.T) {
+	db := newTestDB(t)
+	skipWithoutFullText(t, db)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(1)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	// Duplicated votes and a vote on a missing quote, as the old voting code could store them
+	_, err = db.Exec(`INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('content', 'context', 'author', 1);
+		INSERT INTO Votes (quoteID, voter, value) VALUES (101, 1, 1), (101, 1, 1), (101, 1, -1), (101, 2, 1), (999, 1, 1);`)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.Up()
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	var count, sum int
+	err = db.QueryRow("SELECT COUNT(*), SUM(value) FROM Votes").Scan(&count, &sum)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if count != 2 || sum != 0 {
+		t.Errorf("got %d votes summing to %d, wanted 2 votes summing to 0", count, sum)
+	}
+
+	_, err = db.Exec("INSERT INTO Votes (quoteID, voter, value) VALUES (101, 2, 1)")
+	if err == nil {
+		t.Errorf("a second vote of the same voter should be rejected")
+	}
+}
+
+func TestVoteScoresMigration(t *testing.T) {
+	db := newTestDB(t)
+	skipWithoutFullText(t, db)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(2)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('content', 'context', 'author', 1);
+		INSERT INTO Votes (quoteID, voter, value) VALUES (101, 1, 1), (101, 2, 1), (101, 3, -1);`)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.Up()
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	scores := func() (score, upvotes, downvotes int) {
+		t.Helper()
+		err := db.QueryRow("SELECT score, upvotes, downvotes FROM Quotes WHERE quoteID=101").Scan(&score, &upvotes, &downvotes)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		return
+	}
+
+	steps := []struct {
+		Statement string
+		Expected  [3]int
+	}{
+		{Statement: "", Expected: [3]int{1, 2, 1}},
+		{Statement: "INSERT INTO Votes (quoteID, voter, value) VALUES (101, 4, -1)", Expected: [3]int{0, 2, 2}},
+		{Statement: "UPDATE Votes SET value=1 WHERE voter=3", Expected: [3]int{2, 3, 1}},
+		{Statement: "DELETE FROM Votes WHERE voter=1", Expected: [3]int{1, 2, 1}},
+	}
+	for i, step := range steps {
+		if step.Statement != "" {
+			_, err = db.Exec(step.Statement)
+			if err != nil {
+				t.Fatalf("error %v should not have occured at step %d", err, i)
+			}
+		}
+		score, upvotes, downvotes := scores()
+		if got := [3]int{score, upvotes, downvotes}; got != step.Expected {
+			t.Errorf("got score, upvotes, downvotes %v at step %d, wanted %v", got, i, step.Expected)
+		}
+	}
+
+	err = m.To(2)
+	if err != nil {
+		t.Errorf("error %v should not have occured", err)
+	}
+}
+
+func TestQuoteRevisionsMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(3)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('old content', 'old context', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.To(4)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('new content', 'new context', 'bob', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	// Both the existing and the new quotes have their first revision
+	for quoteID, expected := range map[int][3]string{101: {"old content", "old context", "alice"}, 102: {"new content", "new context", "bob"}} {
+		var got [3]string
+		var revision int
+		err = db.QueryRow("SELECT revision, content, context, editor FROM QuoteRevisions WHERE quoteID=?", quoteID).Scan(&revision, &got[0], &got[1], &got[2])
+		if err != nil {
+			t.Fatalf("error %v should not have occured for quote %d", err, quoteID)
+		}
+		if revision != 1 || got != expected {
+			t.Errorf("got revision %d %v for quote %d, wanted revision 1 %v", revision, got, quoteID, expected)
+		}
+	}
+
+	err = m.To(3)
+	if err != nil {
+		t.Errorf("error %v should not have occured", err)
+	}
+}
+
+func TestTrashMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(4)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable, deletedAt) VALUES ('deleted', 'context', 'alice', 0, CURRENT_TIMESTAMP)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.To(5)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// Quotes deleted before the migration have no known deleter
+	var deletedBy sql.NullString
+	err = db.QueryRow("SELECT deletedBy FROM Quotes WHERE quoteID=101").Scan(&deletedBy)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if deletedBy.Valid {
+		t.Errorf("got deleter %q, wanted NULL", deletedBy.String)
+	}
+
+	err = m.To(4)
+	if err != nil {
+		t.Errorf("error %v should not have occured", err)
+	}
+}
+
+func TestChatsMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(5)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('content', 'context', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.To(6)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// Quotes added before the migration wait in chat 0 to be adopted
+	var chatID int64
+	err = db.QueryRow("SELECT chatID FROM Quotes WHERE quoteID=101").Scan(&chatID)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if chatID != 0 {
+		t.Errorf("got chat %d, wanted 0", chatID)
+	}
+
+	err = m.To(5)
+	if err != nil {
+		t.Errorf("error %v should not have occured", err)
+	}
+}
+
+func TestSpeakersMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(6)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	for _, quote := range [][2]interface{}{{"Bob", 1}, {"@bob", 1}, {" bob ", 1}, {"Bobby", 1}, {"bob", 2}, {"", 1}} {
+		_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable, chatID) VALUES ('content', ?, 'alice', 1, ?)", quote[0], quote[1])
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+	}
+
+	err = m.To(7)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// The contexts matching whatever the case and the @ are the same speaker
+	expected := []string{"1 Bob", "1 Bob", "1 Bob", "1 Bobby", "2 bob", ""}
+	rows, err := db.Query("SELECT Speakers.chatID, Speakers.name FROM Quotes LEFT JOIN Speakers ON Speakers.speakerID = Quotes.speakerID ORDER BY Quotes.quoteID")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var chatID sql.NullInt64
+		var name sql.NullString
+		err = rows.Scan(&chatID, &name)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if !name.Valid {
+			got = append(got, "")
+			continue
+		}
+		got = append(got, fmt.Sprintf("%d %s", chatID.Int64, name.String))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("got speakers %q, wanted %q", got, expected)
+	}
+
+	err = m.To(6)
+	if err != nil {
+		t.Errorf("error %v should not have occured", err)
+	}
+}
+
+func TestTagsMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(8)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('content', 'context', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	_, err = db.Exec("INSERT INTO QuoteTags (quoteID, tag) VALUES (101, 'work')")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// A quote has each tag once
+	_, err = db.Exec("INSERT INTO QuoteTags (quoteID, tag) VALUES (101, 'work')")
+	if err == nil {
+		t.Errorf("the same tag should not be filed twice on a quote")
+	}
+
+	err = m.To(7)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if tableExists(t, db, "QuoteTags") {
+		t.Errorf("table QuoteTags should have been dropped")
+	}
+}
+
+func TestDialoguesMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(9)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('Alice: hi\nBob: hello', 'Alice, Bob', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	_, err = db.Exec("INSERT INTO QuoteLines (quoteID, position, content) VALUES (101, 1, 'hi'), (101, 2, 'hello')")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// A position holds one line
+	_, err = db.Exec("INSERT INTO QuoteLines (quoteID, position, content) VALUES (101, 2, 'hey')")
+	if err == nil {
+		t.Errorf("two lines should not share a position")
+	}
+
+	err = m.To(8)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if tableExists(t, db, "QuoteLines") {
+		t.Errorf("table QuoteLines should have been dropped")
+	}
+}
+
+func TestRepliesMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(9)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('typed in', 'Bob', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.To(10)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// Quotes typed in by hand were taken from no message
+	var saidAt sql.NullTime
+	var messageID sql.NullInt64
+	err = db.QueryRow("SELECT saidAt, messageID FROM Quotes WHERE quoteID=101").Scan(&saidAt, &messageID)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if saidAt.Valid || messageID.Valid {
+		t.Errorf("got %v and %v, wanted NULL", saidAt, messageID)
+	}
+
+	err = m.To(9)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	_, err = db.Exec("SELECT saidAt FROM Quotes")
+	if err == nil {
+		t.Errorf("column saidAt should have been dropped")
+	}
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewMigrator(db, fstest.MapFS{
+		"m/0001_first.up.sql":  {Data: []byte("CREATE TABLE a (id INTEGER)")},
+		"m/0002_broken.up.sql": {Data: []byte("CREATE TABLE b (id INTEGER); INSERT INTO missing VALUES (1)")},
+	}, "m")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.Up()
+	if err == nil {
+		t.Fatalf("the broken migration should have failed")
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if version != 1 {
+		t.Errorf("got version %d, wanted 1", version)
+	}
+	if tableExists(t, db, "b") {
+		t.Errorf("table b should have been rolled back")
+	}
+
+	err = m.To(0)
+	if !errors.Is(err, ErrIrreversible) {
+		t.Errorf("got %v instead of %v", err, ErrIrreversible)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+}
+
+func TestMediaMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(10)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('typed in', 'Bob', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	err = m.To(11)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// The quotes stored before are text quotes
+	var mediaType sql.NullString
+	var fileID sql.NullString
+	err = db.QueryRow("SELECT mediaType, fileID FROM Quotes WHERE quoteID=101").Scan(&mediaType, &fileID)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if mediaType.Valid || fileID.Valid {
+		t.Errorf("got %v and %v, wanted NULL", mediaType, fileID)
+	}
+
+	err = m.To(10)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	_, err = db.Exec("SELECT fileID FROM Quotes")
+	if err == nil {
+		t.Errorf("column fileID should have been dropped")
+	}
+}
+
+func TestPostsMigration(t *testing.T) {
+	db := newTestDB(t)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(12)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('typed in', 'Bob', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	_, err = db.Exec("INSERT INTO QuotePosts (postChatID, messageID, position, quoteID) VALUES (-100, 500, 0, 101)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	// A position of a message holds one quote
+	_, err = db.Exec("INSERT INTO QuotePosts (postChatID, messageID, position, quoteID) VALUES (-100, 500, 0, 101)")
+	if err == nil {
+		t.Errorf("the same position of a post should not be recorded twice")
+	}
+
+	err = m.To(11)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	_, err = db.Exec("SELECT * FROM QuotePosts")
+	if err == nil {
+		t.Errorf("table QuotePosts should have been dropped")
+	}
+}
+
+func TestSearchIndexMigration(t *testing.T) {
+	db := newTestDB(t)
+	skipWithoutFullText(t, db)
+	m, err := NewSqliteMigrator(db)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(12)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('Le café est prêt', 'Bob', 'alice', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = m.To(13)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	// The quotes added before are indexed, the new ones by the triggers
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('Un autre café', 'Carol', 'bob', 1)")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM QuotesFTS WHERE QuotesFTS MATCH 'cafe'").Scan(&count)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if count != 2 {
+		t.Errorf("got %d quotes matching, wanted 2", count)
+	}
+
+	err = m.To(12)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if tableExists(t, db, "QuotesFTS") {
+		t.Errorf("table QuotesFTS should have been dropped")
+	}
+	_, err = db.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES ('Sans index', 'Dave', 'carol', 1)")
+	if err != nil {
+		t.Errorf("error %v should not have occured once the triggers are dropped", err)
+	}
+}
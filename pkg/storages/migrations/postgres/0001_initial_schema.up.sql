@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS Quotes (quoteID INTEGER GENERATED BY DEFAULT AS IDENTITY (START WITH 101) PRIMARY KEY, content VARCHAR(512) NOT NULL, context VARCHAR(255) NOT NULL, author VARCHAR(255) NOT NULL, createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP, deletedAt TIMESTAMP DEFAULT NULL, isAvailable BOOLEAN NOT NULL);
+CREATE TABLE IF NOT EXISTS Votes (voteID BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY, quoteID INTEGER NOT NULL REFERENCES Quotes(quoteID), voter BIGINT NOT NULL, value INTEGER NOT NULL);
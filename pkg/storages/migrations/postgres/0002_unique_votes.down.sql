@@ -0,0 +1 @@
+DROP INDEX IF EXISTS Votes_quoteID_voter;
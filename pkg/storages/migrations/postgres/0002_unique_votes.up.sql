@@ -0,0 +1,7 @@
+-- Votes on quotes that never existed, accepted while foreign keys were not enforced
+DELETE FROM Votes WHERE quoteID NOT IN (SELECT quoteID FROM Quotes);
+
+-- Two fast taps could store the same vote twice, keep the most recent one
+DELETE FROM Votes WHERE voteID NOT IN (SELECT MAX(voteID) FROM Votes GROUP BY quoteID, voter);
+
+CREATE UNIQUE INDEX IF NOT EXISTS Votes_quoteID_voter ON Votes (quoteID, voter);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS Votes_score ON Votes;
+DROP FUNCTION IF EXISTS votes_update_score();
+DROP INDEX IF EXISTS Quotes_available_score;
+ALTER TABLE Quotes DROP COLUMN downvotes, DROP COLUMN upvotes, DROP COLUMN score;
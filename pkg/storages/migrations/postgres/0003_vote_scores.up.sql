@@ -0,0 +1,28 @@
+-- Vote counts kept on each quote, so that reads never aggregate Votes
+ALTER TABLE Quotes
+	ADD COLUMN score INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;
+
+UPDATE Quotes SET
+	score = COALESCE((SELECT SUM(value) FROM Votes WHERE Votes.quoteID = Quotes.quoteID), 0),
+	upvotes = (SELECT COUNT(*) FROM Votes WHERE Votes.quoteID = Quotes.quoteID AND value > 0),
+	downvotes = (SELECT COUNT(*) FROM Votes WHERE Votes.quoteID = Quotes.quoteID AND value < 0);
+
+-- Rankings walk this index instead of sorting the whole table
+CREATE INDEX IF NOT EXISTS Quotes_available_score ON Quotes (score) WHERE isAvailable=true;
+
+-- The counts are updated by the statement changing Votes, in the same transaction
+CREATE OR REPLACE FUNCTION votes_update_score() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		UPDATE Quotes SET score = score - OLD.value, upvotes = upvotes - (OLD.value > 0)::INTEGER, downvotes = downvotes - (OLD.value < 0)::INTEGER WHERE quoteID = OLD.quoteID;
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		UPDATE Quotes SET score = score + NEW.value, upvotes = upvotes + (NEW.value > 0)::INTEGER, downvotes = downvotes + (NEW.value < 0)::INTEGER WHERE quoteID = NEW.quoteID;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER Votes_score AFTER INSERT OR UPDATE OF value OR DELETE ON Votes FOR EACH ROW EXECUTE FUNCTION votes_update_score();
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS Quotes_search;
@@ -0,0 +1,2 @@
+-- Full-text index used by SearchWord, the expression must match postgresSearchVector
+CREATE INDEX IF NOT EXISTS Quotes_search ON Quotes USING GIN ((setweight(to_tsvector('simple', content), 'A') || setweight(to_tsvector('simple', context), 'B')));
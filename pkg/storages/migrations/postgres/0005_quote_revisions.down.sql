@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS Quotes_first_revision ON Quotes;
+DROP FUNCTION IF EXISTS quotes_first_revision();
+DROP INDEX IF EXISTS QuoteRevisions_quoteID_revision;
+DROP TABLE IF EXISTS QuoteRevisions;
@@ -0,0 +1,18 @@
+-- Every version of a quote, the first one being the quote as it was added.
+-- diff is a word diff from the previous revision, empty for the first one.
+CREATE TABLE IF NOT EXISTS QuoteRevisions (revisionID BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY, quoteID INTEGER NOT NULL REFERENCES Quotes(quoteID), revision INTEGER NOT NULL, content VARCHAR(512) NOT NULL, context VARCHAR(255) NOT NULL, editor VARCHAR(255) NOT NULL, editedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP, diff TEXT NOT NULL DEFAULT '');
+CREATE UNIQUE INDEX IF NOT EXISTS QuoteRevisions_quoteID_revision ON QuoteRevisions (quoteID, revision);
+
+INSERT INTO QuoteRevisions (quoteID, revision, content, context, editor, editedAt)
+	SELECT quoteID, 1, content, context, author, createdAt FROM Quotes
+	WHERE NOT EXISTS (SELECT 1 FROM QuoteRevisions WHERE QuoteRevisions.quoteID = Quotes.quoteID);
+
+-- The edits insert their revision themselves, as they know the editor and the diff
+CREATE OR REPLACE FUNCTION quotes_first_revision() RETURNS TRIGGER AS $$
+BEGIN
+	INSERT INTO QuoteRevisions (quoteID, revision, content, context, editor, editedAt) VALUES (NEW.quoteID, 1, NEW.content, NEW.context, NEW.author, NEW.createdAt);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER Quotes_first_revision AFTER INSERT ON Quotes FOR EACH ROW EXECUTE FUNCTION quotes_first_revision();
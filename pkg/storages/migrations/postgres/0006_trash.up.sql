@@ -0,0 +1,5 @@
+-- Who moved a quote to the trash, NULL for the quotes deleted before it was recorded
+ALTER TABLE Quotes ADD COLUMN deletedBy VARCHAR(255) DEFAULT NULL;
+
+-- The trash is listed and purged by deletion date
+CREATE INDEX IF NOT EXISTS Quotes_trash ON Quotes (deletedAt) WHERE isAvailable=false;
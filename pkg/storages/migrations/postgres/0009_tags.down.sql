@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS QuoteTags_tag;
+DROP TABLE IF EXISTS QuoteTags;
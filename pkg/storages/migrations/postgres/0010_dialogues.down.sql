@@ -0,0 +1,4 @@
+ALTER TABLE QuoteRevisions ALTER COLUMN content TYPE VARCHAR(512);
+ALTER TABLE Quotes ALTER COLUMN content TYPE VARCHAR(512);
+DROP INDEX IF EXISTS QuoteLines_speaker;
+DROP TABLE IF EXISTS QuoteLines;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS Speakers_telegram;
+ALTER TABLE Quotes DROP COLUMN messageID;
+ALTER TABLE Quotes DROP COLUMN saidAt;
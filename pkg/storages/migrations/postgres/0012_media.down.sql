@@ -0,0 +1,2 @@
+ALTER TABLE Quotes DROP COLUMN fileID;
+ALTER TABLE Quotes DROP COLUMN mediaType;
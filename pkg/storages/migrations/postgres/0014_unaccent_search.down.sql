@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS Quotes_search;
+CREATE INDEX IF NOT EXISTS Quotes_search ON Quotes USING GIN ((setweight(to_tsvector('simple', content), 'A') || setweight(to_tsvector('simple', context), 'B')));
+DROP TEXT SEARCH CONFIGURATION IF EXISTS quotes_search;
+-- The unaccent extension is kept, other schemas may use it
@@ -0,0 +1,10 @@
+-- The simple configuration with diacritics folded, so that SearchWord matches
+-- "café" and "cafe" like the SQLite index. unaccent is a trusted extension
+-- since PostgreSQL 13, older servers need a superuser to create it.
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE TEXT SEARCH CONFIGURATION quotes_search (COPY = simple);
+ALTER TEXT SEARCH CONFIGURATION quotes_search ALTER MAPPING FOR asciiword, asciihword, hword_asciipart, word, hword, hword_part WITH unaccent, simple;
+
+-- Full-text index used by SearchWord, the expression must match postgresSearchVector
+DROP INDEX IF EXISTS Quotes_search;
+CREATE INDEX IF NOT EXISTS Quotes_search ON Quotes USING GIN ((setweight(to_tsvector('quotes_search', content), 'A') || setweight(to_tsvector('quotes_search', context), 'B')));
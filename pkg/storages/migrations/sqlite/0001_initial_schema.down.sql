@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS Votes;
+DROP TABLE IF EXISTS Quotes;
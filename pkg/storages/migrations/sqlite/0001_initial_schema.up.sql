@@ -0,0 +1,8 @@
+-- Schema as it was created by CreateQuotesTable and CreateVotesTable before
+-- migrations existed. IF NOT EXISTS lets older databases adopt it as-is.
+CREATE TABLE IF NOT EXISTS Quotes (quoteID INTEGER PRIMARY KEY AUTOINCREMENT, `content` VARCHAR(512) NOT NULL, `context` VARCHAR(255) NOT NULL, `author` VARCHAR(255) NOT NULL, `createdAt` DATETIME DEFAULT CURRENT_TIMESTAMP, `deletedAt` DATETIME DEFAULT NULL, `isAvailable` BOOLEAN NOT NULL);
+CREATE TABLE IF NOT EXISTS Votes (`voteID` INTEGER PRIMARY KEY AUTOINCREMENT, `quoteID` INTEGER NOT NULL, `voter` sqlite3_int64 NOT NULL, `value` INTEGER NOT NULL, FOREIGN KEY(`quoteID`) REFERENCES Quotes(`quoteID`));
+
+-- Quote IDs start after 100
+INSERT INTO SQLITE_SEQUENCE (name, seq) SELECT 'Quotes', 100 WHERE NOT EXISTS (SELECT 1 FROM SQLITE_SEQUENCE WHERE name='Quotes');
+UPDATE SQLITE_SEQUENCE SET seq=100 WHERE name='Quotes' AND seq < 100;
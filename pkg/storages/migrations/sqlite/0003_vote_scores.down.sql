@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS Votes_score_delete;
+DROP TRIGGER IF EXISTS Votes_score_update;
+DROP TRIGGER IF EXISTS Votes_score_insert;
+DROP INDEX IF EXISTS Quotes_available_score;
+ALTER TABLE Quotes DROP COLUMN downvotes;
+ALTER TABLE Quotes DROP COLUMN upvotes;
+ALTER TABLE Quotes DROP COLUMN score;
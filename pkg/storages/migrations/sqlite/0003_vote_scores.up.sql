@@ -0,0 +1,25 @@
+-- Vote counts kept on each quote, so that reads never aggregate Votes
+ALTER TABLE Quotes ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Quotes ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Quotes ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;
+
+UPDATE Quotes SET
+	score = COALESCE((SELECT SUM(value) FROM Votes WHERE Votes.quoteID = Quotes.quoteID), 0),
+	upvotes = (SELECT COUNT(*) FROM Votes WHERE Votes.quoteID = Quotes.quoteID AND value > 0),
+	downvotes = (SELECT COUNT(*) FROM Votes WHERE Votes.quoteID = Quotes.quoteID AND value < 0);
+
+-- Rankings walk this index instead of sorting the whole table
+CREATE INDEX IF NOT EXISTS Quotes_available_score ON Quotes (score) WHERE isAvailable=true;
+
+-- The counts are updated by the statement changing Votes, in the same transaction
+CREATE TRIGGER IF NOT EXISTS Votes_score_insert AFTER INSERT ON Votes BEGIN
+	UPDATE Quotes SET score = score + NEW.value, upvotes = upvotes + (NEW.value > 0), downvotes = downvotes + (NEW.value < 0) WHERE quoteID = NEW.quoteID;
+END;
+
+CREATE TRIGGER IF NOT EXISTS Votes_score_update AFTER UPDATE OF value ON Votes BEGIN
+	UPDATE Quotes SET score = score - OLD.value + NEW.value, upvotes = upvotes - (OLD.value > 0) + (NEW.value > 0), downvotes = downvotes - (OLD.value < 0) + (NEW.value < 0) WHERE quoteID = NEW.quoteID;
+END;
+
+CREATE TRIGGER IF NOT EXISTS Votes_score_delete AFTER DELETE ON Votes BEGIN
+	UPDATE Quotes SET score = score - OLD.value, upvotes = upvotes - (OLD.value > 0), downvotes = downvotes - (OLD.value < 0) WHERE quoteID = OLD.quoteID;
+END;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS Quotes_first_revision;
+DROP INDEX IF EXISTS QuoteRevisions_quoteID_revision;
+DROP TABLE IF EXISTS QuoteRevisions;
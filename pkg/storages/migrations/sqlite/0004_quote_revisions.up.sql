@@ -0,0 +1,13 @@
+-- Every version of a quote, the first one being the quote as it was added.
+-- diff is a word diff from the previous revision, empty for the first one.
+CREATE TABLE IF NOT EXISTS QuoteRevisions (`revisionID` INTEGER PRIMARY KEY AUTOINCREMENT, `quoteID` INTEGER NOT NULL, `revision` INTEGER NOT NULL, `content` VARCHAR(512) NOT NULL, `context` VARCHAR(255) NOT NULL, `editor` VARCHAR(255) NOT NULL, `editedAt` DATETIME DEFAULT CURRENT_TIMESTAMP, `diff` TEXT NOT NULL DEFAULT '', FOREIGN KEY(`quoteID`) REFERENCES Quotes(`quoteID`));
+CREATE UNIQUE INDEX IF NOT EXISTS QuoteRevisions_quoteID_revision ON QuoteRevisions (quoteID, revision);
+
+INSERT INTO QuoteRevisions (quoteID, revision, content, context, editor, editedAt)
+	SELECT quoteID, 1, content, context, author, createdAt FROM Quotes
+	WHERE NOT EXISTS (SELECT 1 FROM QuoteRevisions WHERE QuoteRevisions.quoteID = Quotes.quoteID);
+
+-- The edits insert their revision themselves, as they know the editor and the diff
+CREATE TRIGGER IF NOT EXISTS Quotes_first_revision AFTER INSERT ON Quotes BEGIN
+	INSERT INTO QuoteRevisions (quoteID, revision, content, context, editor, editedAt) VALUES (NEW.quoteID, 1, NEW.content, NEW.context, NEW.author, NEW.createdAt);
+END;
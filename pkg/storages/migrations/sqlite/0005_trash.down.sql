@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS Quotes_trash;
+ALTER TABLE Quotes DROP COLUMN deletedBy;
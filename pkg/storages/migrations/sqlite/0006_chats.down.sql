@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS Quotes_available_chat_score;
+DROP INDEX IF EXISTS Quotes_available_chat;
+CREATE INDEX IF NOT EXISTS Quotes_available_score ON Quotes (score) WHERE isAvailable=true;
+ALTER TABLE Votes DROP COLUMN chatID;
+ALTER TABLE Quotes DROP COLUMN chatID;
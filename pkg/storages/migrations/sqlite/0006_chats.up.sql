@@ -0,0 +1,9 @@
+-- Every quote and vote belongs to the Telegram group it was added in, the
+-- existing ones are in chat 0 until AdoptQuotes moves them to their group
+ALTER TABLE Quotes ADD COLUMN chatID BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE Votes ADD COLUMN chatID BIGINT NOT NULL DEFAULT 0;
+
+-- Listings and rankings are read per group
+DROP INDEX IF EXISTS Quotes_available_score;
+CREATE INDEX IF NOT EXISTS Quotes_available_chat ON Quotes (chatID, quoteID) WHERE isAvailable=true;
+CREATE INDEX IF NOT EXISTS Quotes_available_chat_score ON Quotes (chatID, score) WHERE isAvailable=true;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS Quotes_speaker;
+ALTER TABLE Quotes DROP COLUMN speakerID;
+DROP INDEX IF EXISTS SpeakerAliases_alias;
+DROP TABLE IF EXISTS SpeakerAliases;
+DROP TABLE IF EXISTS Speakers;
@@ -0,0 +1,12 @@
+-- Quotes are attributed to speakers, matched whatever the case on any of their
+-- aliases, the canonical name being one of them
+CREATE TABLE IF NOT EXISTS Speakers (speakerID INTEGER PRIMARY KEY AUTOINCREMENT, chatID BIGINT NOT NULL DEFAULT 0, name VARCHAR(255) NOT NULL, telegramID BIGINT DEFAULT NULL);
+CREATE TABLE IF NOT EXISTS SpeakerAliases (speakerID INTEGER NOT NULL REFERENCES Speakers(speakerID), chatID BIGINT NOT NULL DEFAULT 0, alias VARCHAR(255) NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS SpeakerAliases_alias ON SpeakerAliases (chatID, lower(alias));
+ALTER TABLE Quotes ADD COLUMN speakerID INTEGER DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS Quotes_speaker ON Quotes (speakerID);
+
+-- The contexts become speakers, "Bob", "bob" and "@bob" being the same one
+INSERT INTO Speakers (chatID, name) SELECT chatID, MIN(trim(ltrim(trim(context), '@'))) FROM Quotes WHERE trim(ltrim(trim(context), '@')) <> '' GROUP BY chatID, lower(trim(ltrim(trim(context), '@')));
+INSERT INTO SpeakerAliases (speakerID, chatID, alias) SELECT speakerID, chatID, name FROM Speakers;
+UPDATE Quotes SET speakerID = (SELECT speakerID FROM SpeakerAliases WHERE SpeakerAliases.chatID = Quotes.chatID AND lower(SpeakerAliases.alias) = lower(trim(ltrim(trim(Quotes.context), '@'))));
@@ -0,0 +1,3 @@
+-- Tags are lowercase words filed on quotes, a quote has each tag at most once
+CREATE TABLE IF NOT EXISTS QuoteTags (quoteID INTEGER NOT NULL REFERENCES Quotes(quoteID), tag VARCHAR(64) NOT NULL, PRIMARY KEY (quoteID, tag));
+CREATE INDEX IF NOT EXISTS QuoteTags_tag ON QuoteTags (tag, quoteID);
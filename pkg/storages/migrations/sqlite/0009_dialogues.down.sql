@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS QuoteLines_speaker;
+DROP TABLE IF EXISTS QuoteLines;
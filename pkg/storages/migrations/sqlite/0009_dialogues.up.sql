@@ -0,0 +1,4 @@
+-- The lines of the dialogue quotes, in order, each one said by a speaker. The
+-- content of a dialogue keeps the whole text for the search and the duplicates.
+CREATE TABLE IF NOT EXISTS QuoteLines (quoteID INTEGER NOT NULL REFERENCES Quotes(quoteID), position INTEGER NOT NULL, speakerID INTEGER REFERENCES Speakers(speakerID), content TEXT NOT NULL, PRIMARY KEY (quoteID, position));
+CREATE INDEX IF NOT EXISTS QuoteLines_speaker ON QuoteLines (speakerID);
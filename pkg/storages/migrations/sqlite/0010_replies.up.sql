@@ -0,0 +1,7 @@
+-- When a quote was said and the Telegram message it was taken from, NULL for
+-- the quotes typed in by hand
+ALTER TABLE Quotes ADD COLUMN saidAt TIMESTAMP DEFAULT NULL;
+ALTER TABLE Quotes ADD COLUMN messageID BIGINT DEFAULT NULL;
+
+-- The speakers of the quoted messages are found by their Telegram user
+CREATE INDEX IF NOT EXISTS Speakers_telegram ON Speakers (chatID, telegramID);
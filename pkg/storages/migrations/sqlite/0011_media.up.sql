@@ -0,0 +1,4 @@
+-- The Telegram file of the photos, voice notes, videos and stickers quoted,
+-- NULL for the text quotes
+ALTER TABLE Quotes ADD COLUMN mediaType VARCHAR(16) DEFAULT NULL;
+ALTER TABLE Quotes ADD COLUMN fileID VARCHAR(255) DEFAULT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS QuotePosts_quote;
+DROP TABLE IF EXISTS QuotePosts;
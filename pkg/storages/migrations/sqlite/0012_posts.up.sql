@@ -0,0 +1,4 @@
+-- The messages the bot posted quotes in, a quote per position, edited when
+-- the votes of their quotes change
+CREATE TABLE IF NOT EXISTS QuotePosts (postChatID BIGINT NOT NULL, messageID BIGINT NOT NULL, position INTEGER NOT NULL, quoteID INTEGER NOT NULL REFERENCES Quotes(quoteID), caption BOOLEAN NOT NULL DEFAULT false, postedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (postChatID, messageID, position));
+CREATE INDEX IF NOT EXISTS QuotePosts_quote ON QuotePosts (quoteID, postedAt);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS QuotesFTS_insert;
+DROP TRIGGER IF EXISTS QuotesFTS_update;
+DROP TRIGGER IF EXISTS QuotesFTS_delete;
+DROP TABLE IF EXISTS QuotesFTS;
@@ -0,0 +1,21 @@
+-- Full-text index used by SearchWord, it needs go-sqlite3 built with the
+-- sqlite_fts5 tag. QuotesFTS indexes the content and context of Quotes and is
+-- kept in sync by triggers, soft-deleted quotes stay indexed and are filtered
+-- when searching.
+CREATE VIRTUAL TABLE IF NOT EXISTS QuotesFTS USING fts5(content, context, content='Quotes', content_rowid='quoteID', tokenize='unicode61 remove_diacritics 2');
+
+CREATE TRIGGER IF NOT EXISTS QuotesFTS_insert AFTER INSERT ON Quotes BEGIN
+	INSERT INTO QuotesFTS (rowid, content, context) VALUES (NEW.quoteID, NEW.content, NEW.context);
+END;
+
+CREATE TRIGGER IF NOT EXISTS QuotesFTS_update AFTER UPDATE OF content, context ON Quotes BEGIN
+	INSERT INTO QuotesFTS (QuotesFTS, rowid, content, context) VALUES ('delete', OLD.quoteID, OLD.content, OLD.context);
+	INSERT INTO QuotesFTS (rowid, content, context) VALUES (NEW.quoteID, NEW.content, NEW.context);
+END;
+
+CREATE TRIGGER IF NOT EXISTS QuotesFTS_delete AFTER DELETE ON Quotes BEGIN
+	INSERT INTO QuotesFTS (QuotesFTS, rowid, content, context) VALUES ('delete', OLD.quoteID, OLD.content, OLD.context);
+END;
+
+-- Index the quotes added before, or while the triggers were missing
+INSERT INTO QuotesFTS (QuotesFTS) VALUES ('rebuild');
@@ -0,0 +1,580 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"goquotebot/pkg/search"
+	"goquotebot/pkg/storages/migrations"
+
+	"github.com/lib/pq"
+)
+
+const postgresQuoteColumns = "Quotes.quoteID, Quotes.content, Quotes.context, Quotes.author, Quotes.createdAt, Quotes.deletedAt, Quotes.isAvailable, Quotes.score, Quotes.upvotes, Quotes.downvotes, Quotes.deletedBy, Quotes.chatID, Quotes.speakerID, (SELECT name FROM Speakers WHERE Speakers.speakerID = Quotes.speakerID), (SELECT string_agg(tag, ',') FROM QuoteTags WHERE QuoteTags.quoteID = Quotes.quoteID), Quotes.saidAt, Quotes.messageID, Quotes.mediaType, Quotes.fileID"
+
+// postgresSearchVector must stay identical to the expression of the Quotes_search index
+const postgresSearchVector = "(setweight(to_tsvector('quotes_search', Quotes.content), 'A') || setweight(to_tsvector('quotes_search', Quotes.context), 'B'))"
+
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresStore(cfg PostgresConfig) (DB, error) {
+	db, err := OpenPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migrations.NewPostgresMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	err = migrator.Up()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresStore{
+		DB: db,
+	}, nil
+}
+
+// OpenPostgres connects to the server described by cfg, without touching the schema
+func OpenPostgres(cfg PostgresConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (p *PostgresStore) Close() error {
+	return p.DB.Close()
+}
+
+func (p *PostgresStore) AddQuote(ctx context.Context, request AddQuoteRequest) (QuoteResponse, error) {
+	contextIsAllowed := checkContext(request.QuoteContext)
+	if !contextIsAllowed {
+		return QuoteResponse{}, ErrForbiddenContext
+	}
+
+	tags, err := tagNames(request.Tags)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = checkMedia(request.Media)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+
+	err = checkStoredDuplicate(ctx, p, request)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	defer tx.Rollback()
+
+	speakerID, err := quoteSpeaker(ctx, tx, postgresSpeakerQueries, request.ChatID, request.Content, request.QuoteContext, request.TelegramIDs)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	var quoteID int
+	mediaType, fileID := mediaColumns(request.Media)
+	query := "INSERT INTO Quotes (chatID, content, context, author, createdAt, isAvailable, speakerID, saidAt, messageID, mediaType, fileID) VALUES ($1,$2,$3,$4,CURRENT_TIMESTAMP,$5,$6,$7,$8,$9,$10) RETURNING quoteID"
+	err = tx.QueryRowContext(ctx, query, request.ChatID, request.Content, request.QuoteContext, request.Author, true, speakerID, saidAt(request.SaidAt), messageID(request.MessageID), mediaType, fileID).Scan(&quoteID)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = addTags(ctx, tx, postgresTagQueries, quoteID, tags)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = addLines(ctx, tx, postgresDialogueQueries, postgresSpeakerQueries, request.ChatID, quoteID, request.Content, request.TelegramIDs)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	return p.getQuote(ctx, request.ChatID, quoteID)
+}
+
+func (p *PostgresStore) DeleteQuote(ctx context.Context, request DeleteQuoteRequest) error {
+	query := "UPDATE Quotes SET isAvailable=false, deletedAt=CURRENT_TIMESTAMP, deletedBy=$1 WHERE quoteID=$2 AND chatID=$3 AND isAvailable=true"
+	result, err := p.DB.ExecContext(ctx, query, request.Deleter, request.QuoteID, request.ChatID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (p *PostgresStore) GetTrash(ctx context.Context, request TrashRequest) ([]QuoteResponse, error) {
+	query := "SELECT " + postgresQuoteColumns + " FROM Quotes WHERE Quotes.isAvailable=false AND Quotes.chatID=$1 ORDER BY Quotes.deletedAt DESC, Quotes.quoteID DESC LIMIT $2 OFFSET $3"
+	return p.getQuotes(ctx, query, request.ChatID, request.QuoteNb, request.Offset)
+}
+
+func (p *PostgresStore) RestoreQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) (QuoteResponse, error) {
+	query := "UPDATE Quotes SET isAvailable=true, deletedAt=NULL, deletedBy=NULL WHERE quoteID=$1 AND chatID=$2 AND isAvailable=false RETURNING " + postgresQuoteColumns
+	quotes, err := p.getQuotes(ctx, query, request.QuoteID, request.ChatID)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	if len(quotes) == 0 {
+		return QuoteResponse{}, ErrNotFound
+	}
+	return quotes[0], nil
+}
+
+func (p *PostgresStore) PurgeQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) error {
+	purged, err := p.purge(ctx, "quoteID=$1 AND chatID=$2", request.QuoteID, request.ChatID)
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	return p.purge(ctx, "deletedAt < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'", int64(olderThan.Seconds()))
+}
+
+func (p *PostgresStore) EditQuote(ctx context.Context, request EditQuoteRequest) (QuoteResponse, error) {
+	if !checkContext(request.QuoteContext) {
+		return QuoteResponse{}, ErrForbiddenContext
+	}
+
+	err := p.editQuote(ctx, request)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	return p.getQuote(ctx, request.ChatID, request.QuoteID)
+}
+
+// RollbackQuote restores the content and context of a revision as a new revision
+func (p *PostgresStore) RollbackQuote(ctx context.Context, request RollbackQuoteRequest) (QuoteResponse, error) {
+	edit := EditQuoteRequest{ChatID: request.ChatID, QuoteID: request.QuoteID, Editor: request.Editor}
+	query := "SELECT content, context FROM QuoteRevisions WHERE quoteID=$1 AND revision=$2"
+	err := p.DB.QueryRowContext(ctx, query, request.QuoteID, request.Revision).Scan(&edit.Content, &edit.QuoteContext)
+	if errors.Is(err, sql.ErrNoRows) {
+		return QuoteResponse{}, ErrNotFound
+	}
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+
+	err = p.editQuote(ctx, edit)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	return p.getQuote(ctx, request.ChatID, request.QuoteID)
+}
+
+func (p *PostgresStore) GetRevisions(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]RevisionResponse, error) {
+	err := p.checkAvailable(ctx, request.ChatID, request.QuoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT quoteID, revision, content, context, editor, editedAt, diff FROM QuoteRevisions WHERE quoteID=$1 ORDER BY revision"
+	results, err := p.DB.QueryContext(ctx, query, request.QuoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var revisions []RevisionResponse
+	for results.Next() {
+		var revision RevisionResponse
+		var editedAt sql.NullTime
+		err := results.Scan(&revision.QuoteID, &revision.Revision, &revision.Content, &revision.QuoteContext, &revision.Editor, &editedAt, &revision.Diff)
+		if err != nil {
+			return revisions, err
+		}
+		revision.EditedAt = editedAt.Time
+		revisions = append(revisions, revision)
+	}
+	return revisions, results.Err()
+}
+
+func (p *PostgresStore) GetQuotes(ctx context.Context, request MultipleSpecifiedQuotesRequest) ([]QuoteResponse, error) {
+	ids := make([]int64, 0, len(request.QuoteIDs))
+	for _, quoteID := range request.QuoteIDs {
+		id, err := strconv.ParseInt(quoteID, 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return []QuoteResponse{}, nil
+	}
+
+	query := "SELECT " + postgresQuoteColumns + " FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=$1 AND Quotes.quoteID = ANY($2) ORDER BY Quotes.quoteID"
+	return p.getQuotes(ctx, query, request.ChatID, pq.Array(ids))
+}
+
+func (p *PostgresStore) GetLastQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return p.listQuotes(ctx, request, "", "Quotes.quoteID DESC")
+}
+
+func (p *PostgresStore) GetRandomQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return p.listQuotes(ctx, request, "", "RANDOM()")
+}
+
+func (p *PostgresStore) GetTopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return p.listQuotes(ctx, request, " AND Quotes.score >= 0 AND Quotes.upvotes + Quotes.downvotes > 0", "Quotes.score DESC, Quotes.quoteID")
+}
+
+func (p *PostgresStore) GetFlopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return p.listQuotes(ctx, request, " AND Quotes.score <= 0 AND Quotes.upvotes + Quotes.downvotes > 0", "Quotes.score ASC, Quotes.quoteID")
+}
+
+func (p *PostgresStore) UnVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	err := p.checkAvailable(ctx, request.ChatID, request.QuoteID)
+	if err != nil {
+		return err
+	}
+
+	query := "DELETE FROM Votes WHERE quoteID=$1 AND voter=$2"
+	_, err = p.DB.ExecContext(ctx, query, request.QuoteID, request.Voter)
+	return err
+}
+
+func (p *PostgresStore) UpVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	return p.vote(ctx, request, 1)
+}
+
+func (p *PostgresStore) DownVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	return p.vote(ctx, request, -1)
+}
+
+func (p *PostgresStore) AddPost(ctx context.Context, request AddPostRequest) error {
+	return addPost(ctx, p.DB, postgresPostQueries, request)
+}
+
+func (p *PostgresStore) GetPosts(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]PostResponse, error) {
+	return getPosts(ctx, p.DB, postgresPostQueries, request)
+}
+
+func (p *PostgresStore) GetSpeakers(ctx context.Context, chatID int64) ([]SpeakerResponse, error) {
+	return getSpeakers(ctx, p.DB, postgresSpeakerQueries, chatID)
+}
+
+func (p *PostgresStore) AliasSpeaker(ctx context.Context, request AliasSpeakerRequest) (SpeakerResponse, error) {
+	return aliasSpeaker(ctx, p.DB, postgresSpeakerQueries, request)
+}
+
+func (p *PostgresStore) MergeSpeakers(ctx context.Context, request MergeSpeakersRequest) (SpeakerResponse, error) {
+	return mergeSpeakers(ctx, p.DB, postgresSpeakerQueries, request)
+}
+
+func (p *PostgresStore) TagQuote(ctx context.Context, request TagQuoteRequest) (QuoteResponse, error) {
+	err := tagQuote(ctx, p.DB, postgresTagQueries, request)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	return p.getQuote(ctx, request.ChatID, request.QuoteID)
+}
+
+func (p *PostgresStore) GetTags(ctx context.Context, chatID int64) ([]TagResponse, error) {
+	return getTags(ctx, p.DB, postgresTagQueries, chatID)
+}
+
+func (p *PostgresStore) ReindexScores(ctx context.Context) error {
+	_, err := p.DB.ExecContext(ctx, reindexScoresQuery)
+	return err
+}
+
+// SearchWord matches every word of the expression as a word prefix of the
+// content or context, ranked with the content weighing more than the context.
+// The quotes_search configuration folds diacritics like the SQLite index.
+func (p *PostgresStore) SearchWord(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	terms := searchTerms(request.Expression)
+	if len(terms) == 0 {
+		return []QuoteResponse{}, nil
+	}
+
+	query := "SELECT " + postgresQuoteColumns + " FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=$3 AND " + postgresSearchVector + " @@ to_tsquery('quotes_search', $1) ORDER BY ts_rank(" + postgresSearchVector + ", to_tsquery('quotes_search', $1)) DESC, Quotes.quoteID DESC LIMIT $2 OFFSET $4"
+	return p.getQuotes(ctx, query, tsQuery(terms), request.QuoteNb, request.ChatID, request.Offset)
+}
+
+func (p *PostgresStore) SearchExpression(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	index, err := loadIndex(ctx, p, request.ChatID, search.Config{})
+	if err != nil {
+		return []QuoteResponse{}, err
+	}
+	return searchIndex(ctx, p, index, request)
+}
+
+func (p *PostgresStore) GetContents(ctx context.Context, chatID int64) (map[int]string, error) {
+	return p.getContents(ctx, "SELECT quoteID, content FROM Quotes WHERE isAvailable=true AND chatID=$1", chatID)
+}
+
+func (p *PostgresStore) AdoptQuotes(ctx context.Context, chatID int64) (int, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	adopted, err := adoptQuotes(ctx, tx, chatID, "UPDATE Quotes SET chatID=$1 WHERE chatID=0", "UPDATE Votes SET chatID=$1 WHERE chatID=0", "UPDATE Speakers SET chatID=$1 WHERE chatID=0", "UPDATE SpeakerAliases SET chatID=$1 WHERE chatID=0")
+	if err != nil {
+		return 0, err
+	}
+	return adopted, tx.Commit()
+}
+
+//============================
+//helpers, appendice functions
+
+// vote stores or replaces the vote of the voter in a single statement, the
+// unique (quoteID, voter) index makes concurrent votes from the same voter safe
+func (p *PostgresStore) vote(ctx context.Context, request VoteQuoteRequest, value int) error {
+	query := "INSERT INTO Votes (quoteID, chatID, voter, value) SELECT quoteID, chatID, $1::BIGINT, $2::INTEGER FROM Quotes WHERE quoteID=$3 AND chatID=$4 AND isAvailable=true ON CONFLICT (quoteID, voter) DO UPDATE SET value=EXCLUDED.value"
+	result, err := p.DB.ExecContext(ctx, query, request.Voter, value, request.QuoteID, request.ChatID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// editQuote updates the quote and records the new revision in one transaction,
+// nothing is recorded when neither the content nor the context change
+func (p *PostgresStore) editQuote(ctx context.Context, request EditQuoteRequest) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldContent, oldContext string
+	err = tx.QueryRowContext(ctx, "SELECT content, context FROM Quotes WHERE quoteID=$1 AND chatID=$2 AND isAvailable=true FOR UPDATE", request.QuoteID, request.ChatID).Scan(&oldContent, &oldContext)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	diff := revisionDiff(oldContent, oldContext, request.Content, request.QuoteContext)
+	if diff == "" {
+		return nil
+	}
+
+	speakerID, err := quoteSpeaker(ctx, tx, postgresSpeakerQueries, request.ChatID, request.Content, request.QuoteContext, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE Quotes SET content=$1, context=$2, speakerID=$3 WHERE quoteID=$4", request.Content, request.QuoteContext, speakerID, request.QuoteID)
+	if err != nil {
+		return err
+	}
+	err = replaceLines(ctx, tx, postgresDialogueQueries, postgresSpeakerQueries, request.ChatID, request.QuoteID, oldContent, request.Content)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO QuoteRevisions (quoteID, revision, content, context, editor, editedAt, diff) SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, CURRENT_TIMESTAMP, $5 FROM QuoteRevisions WHERE quoteID=$1"
+	_, err = tx.ExecContext(ctx, query, request.QuoteID, request.Content, request.QuoteContext, request.Editor, diff)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// purge deletes the trashed quotes matching the condition, with their votes,
+// revisions, tags, lines and posts, in one transaction
+func (p *PostgresStore) purge(ctx context.Context, condition string, args ...interface{}) (int, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	results, err := tx.QueryContext(ctx, "SELECT quoteID FROM Quotes WHERE isAvailable=false AND "+condition+" FOR UPDATE", args...)
+	if err != nil {
+		return 0, err
+	}
+	var quoteIDs []int64
+	for results.Next() {
+		var quoteID int64
+		err = results.Scan(&quoteID)
+		if err != nil {
+			results.Close()
+			return 0, err
+		}
+		quoteIDs = append(quoteIDs, quoteID)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		return 0, err
+	}
+	if len(quoteIDs) == 0 {
+		return 0, nil
+	}
+
+	for _, table := range []string{"Votes", "QuoteRevisions", "QuoteTags", "QuoteLines", "QuotePosts", "Quotes"} {
+		_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE quoteID = ANY($1)", pq.Array(quoteIDs))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(quoteIDs), tx.Commit()
+}
+
+// listQuotes returns the available quotes of the group matching the filter of
+// the request and the conditions, sorted by order
+func (p *PostgresStore) listQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest, conditions string, order string) ([]QuoteResponse, error) {
+	query := "SELECT " + postgresQuoteColumns + " FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=$1" + conditions
+	args := []interface{}{request.ChatID}
+	if request.Filter.Tag != "" {
+		tag, err := tagName(request.Filter.Tag)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, tag)
+		query += " AND Quotes.quoteID IN (SELECT quoteID FROM QuoteTags WHERE tag=$" + strconv.Itoa(len(args)) + ")"
+	}
+	args = append(args, request.QuoteNb, request.Offset)
+	query += " ORDER BY " + order + " LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+	return p.getQuotes(ctx, query, args...)
+}
+
+// getQuote returns the available quote of the group with the given ID, or ErrNotFound
+func (p *PostgresStore) getQuote(ctx context.Context, chatID int64, quoteID int) (QuoteResponse, error) {
+	quotes, err := p.getQuotes(ctx, "SELECT "+postgresQuoteColumns+" FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.quoteID=$1 AND Quotes.chatID=$2", quoteID, chatID)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	if len(quotes) == 0 {
+		return QuoteResponse{}, ErrNotFound
+	}
+	return quotes[0], nil
+}
+
+// checkAvailable returns ErrNotFound if the quote does not exist in the group or has been deleted
+func (p *PostgresStore) checkAvailable(ctx context.Context, chatID int64, quoteID int) error {
+	var count int
+	err := p.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM Quotes WHERE quoteID=$1 AND chatID=$2 AND isAvailable=true", quoteID, chatID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// getQuotes runs a query selecting postgresQuoteColumns, the lines of the
+// dialogues being loaded next
+func (p *PostgresStore) getQuotes(ctx context.Context, query string, args ...interface{}) ([]QuoteResponse, error) {
+	results, err := p.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var value []QuoteResponse
+	for results.Next() {
+		quote, err := scanPostgresQuote(results)
+		if err != nil {
+			results.Close()
+			return value, err
+		}
+		value = append(value, quote)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		return value, err
+	}
+
+	var ids []int64
+	for _, id := range dialogueIDs(value) {
+		ids = append(ids, int64(id.(int)))
+	}
+	if len(ids) == 0 {
+		return value, nil
+	}
+	query = "SELECT QuoteLines.quoteID, QuoteLines.speakerID, Speakers.name, QuoteLines.content FROM QuoteLines LEFT JOIN Speakers ON Speakers.speakerID = QuoteLines.speakerID WHERE QuoteLines.quoteID = ANY($1) ORDER BY QuoteLines.quoteID, QuoteLines.position"
+	results, err = p.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return value, err
+	}
+	defer results.Close()
+	return value, scanLines(results, value)
+}
+
+func (p *PostgresStore) getContents(ctx context.Context, query string, args ...interface{}) (map[int]string, error) {
+	quoteArray := make(map[int]string)
+	results, err := p.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return quoteArray, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var quoteID int
+		var content string
+		err := results.Scan(&quoteID, &content)
+		if err != nil {
+			return quoteArray, err
+		}
+		quoteArray[quoteID] = content
+	}
+	return quoteArray, results.Err()
+}
+
+func scanPostgresQuote(results *sql.Rows) (QuoteResponse, error) {
+	var quote QuoteResponse
+	var createdAt sql.NullTime
+	var deletedAt sql.NullTime
+	var deletedBy sql.NullString
+	var speakerID sql.NullInt32
+	var speaker sql.NullString
+	var tags sql.NullString
+	var saidDate sql.NullTime
+	var message sql.NullInt64
+	var mediaType sql.NullString
+	var fileID sql.NullString
+	err := results.Scan(&quote.QuoteID, &quote.Content, &quote.QuoteContext, &quote.Author, &createdAt, &deletedAt, &quote.IsActive, &quote.Votes, &quote.UpVotes, &quote.DownVotes, &deletedBy, &quote.ChatID, &speakerID, &speaker, &tags, &saidDate, &message, &mediaType, &fileID)
+	if err != nil {
+		return quote, err
+	}
+	quote.CreatedAt = createdAt.Time
+	quote.DeletedAt = deletedAt.Time
+	quote.DeletedBy = deletedBy.String
+	quote.SpeakerID = int(speakerID.Int32)
+	quote.Speaker = speaker.String
+	quote.Tags = splitTags(tags)
+	quote.SaidAt = saidDate.Time
+	quote.MessageID = int(message.Int64)
+	quote.Media = Media{Type: MediaType(mediaType.String), FileID: fileID.String}
+	return quote, nil
+}
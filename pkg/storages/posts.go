@@ -0,0 +1,113 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+)
+
+// maxPosts is the number of posts of a quote GetPosts returns at most, the
+// older ones are no longer edited
+const maxPosts = 10
+
+// postQueries are the statements behind the posts, SQLite and PostgreSQL share
+// the logic but not the placeholders
+type postQueries struct {
+	// clear forgets the quotes of the post (postChatID, messageID)
+	clear string
+	// add records the quote at a position of a post (postChatID, messageID,
+	// position, caption, quoteID, chatID) when it is a quote of the group
+	add string
+	// latest returns the posts (postChatID, messageID) of (quoteID, chatID),
+	// the latest first, at most (limit)
+	latest string
+	// quotes returns the quotes of the post (postChatID, messageID) in order,
+	// and whether they are a caption
+	quotes string
+}
+
+var sqlitePostQueries = postQueries{
+	clear:  "DELETE FROM QuotePosts WHERE postChatID=? AND messageID=?",
+	add:    "INSERT INTO QuotePosts (postChatID, messageID, position, caption, quoteID) SELECT ?,?,?,?,quoteID FROM Quotes WHERE quoteID=? AND chatID=? ON CONFLICT DO NOTHING",
+	latest: "SELECT QuotePosts.postChatID, QuotePosts.messageID FROM QuotePosts JOIN Quotes ON Quotes.quoteID = QuotePosts.quoteID WHERE QuotePosts.quoteID=? AND Quotes.chatID=? ORDER BY QuotePosts.postedAt DESC, QuotePosts.messageID DESC LIMIT ?",
+	quotes: "SELECT quoteID, caption FROM QuotePosts WHERE postChatID=? AND messageID=? ORDER BY position",
+}
+
+var postgresPostQueries = postQueries{
+	clear:  "DELETE FROM QuotePosts WHERE postChatID=$1 AND messageID=$2",
+	add:    "INSERT INTO QuotePosts (postChatID, messageID, position, caption, quoteID) SELECT $1,$2,$3,$4,quoteID FROM Quotes WHERE quoteID=$5 AND chatID=$6 ON CONFLICT DO NOTHING",
+	latest: "SELECT QuotePosts.postChatID, QuotePosts.messageID FROM QuotePosts JOIN Quotes ON Quotes.quoteID = QuotePosts.quoteID WHERE QuotePosts.quoteID=$1 AND Quotes.chatID=$2 ORDER BY QuotePosts.postedAt DESC, QuotePosts.messageID DESC LIMIT $3",
+	quotes: "SELECT quoteID, caption FROM QuotePosts WHERE postChatID=$1 AND messageID=$2 ORDER BY position",
+}
+
+// addPost records the quotes of the group posted in the message, in order,
+// in place of the ones it showed before being edited
+func addPost(ctx context.Context, db *sql.DB, q postQueries, request AddPostRequest) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, q.clear, request.PostChatID, request.MessageID)
+	if err != nil {
+		return err
+	}
+	for position, quoteID := range request.QuoteIDs {
+		_, err = tx.ExecContext(ctx, q.add, request.PostChatID, request.MessageID, position, request.Caption, quoteID, request.ChatID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// getPosts returns the latest posts of the quote of the group with all their quotes
+func getPosts(ctx context.Context, db querier, q postQueries, request UniqueSpecifiedQuoteRequest) ([]PostResponse, error) {
+	results, err := db.QueryContext(ctx, q.latest, request.QuoteID, request.ChatID, maxPosts)
+	if err != nil {
+		return nil, err
+	}
+	var posts []PostResponse
+	for results.Next() {
+		var post PostResponse
+		err = results.Scan(&post.PostChatID, &post.MessageID)
+		if err != nil {
+			results.Close()
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range posts {
+		posts[i].QuoteIDs, posts[i].Caption, err = postQuotes(ctx, db, q, posts[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return posts, nil
+}
+
+// postQuotes returns the quotes of the post in order and whether they are a caption
+func postQuotes(ctx context.Context, db querier, q postQueries, post PostResponse) ([]int, bool, error) {
+	results, err := db.QueryContext(ctx, q.quotes, post.PostChatID, post.MessageID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer results.Close()
+
+	var quoteIDs []int
+	var caption bool
+	for results.Next() {
+		var quoteID int
+		err = results.Scan(&quoteID, &caption)
+		if err != nil {
+			return nil, false, err
+		}
+		quoteIDs = append(quoteIDs, quoteID)
+	}
+	return quoteIDs, caption, results.Err()
+}
@@ -0,0 +1,19 @@
+package storages
+
+import (
+	"database/sql"
+	"time"
+)
+
+// saidAt is the date a quote was said as stored, NULL when unknown
+func saidAt(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC().Truncate(time.Second), Valid: true}
+}
+
+// messageID is the ID of the message a quote was taken from as stored, NULL when unknown
+func messageID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
@@ -0,0 +1,272 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// speakerQueries are the statements behind the speakers, SQLite and PostgreSQL
+// share the logic but not the placeholders
+type speakerQueries struct {
+	// find returns the speakerID of the alias (chatID, alias), whatever its case
+	find string
+	// findTelegram returns the speakerID linked to the user (chatID, telegramID)
+	findTelegram string
+	// create inserts the speaker (chatID, name) and returns its speakerID
+	create string
+	// alias inserts the alias (speakerID, chatID, alias)
+	alias string
+	// link links the speaker (telegramID, speakerID) not linked yet
+	link string
+	// list returns speakerID, chatID, name, telegramID and the number of
+	// available quotes, dialogues included, of the speakers of (chatID), the
+	// most quoted first
+	list string
+	// aliases returns speakerID and alias of the aliases of (chatID)
+	aliases string
+	// moveQuotes, moveLines, moveAliases and linkTelegram hand (from) over to (into, from)
+	moveQuotes   string
+	moveLines    string
+	moveAliases  string
+	linkTelegram string
+	// delete removes the speaker (speakerID)
+	delete string
+}
+
+var sqliteSpeakerQueries = speakerQueries{
+	find:         "SELECT speakerID FROM SpeakerAliases WHERE chatID=? AND lower(alias)=lower(?)",
+	findTelegram: "SELECT speakerID FROM Speakers WHERE chatID=? AND telegramID=? ORDER BY speakerID LIMIT 1",
+	create:       "INSERT INTO Speakers (chatID, name) VALUES (?,?) RETURNING speakerID",
+	alias:        "INSERT INTO SpeakerAliases (speakerID, chatID, alias) VALUES (?,?,?)",
+	link:         "UPDATE Speakers SET telegramID=? WHERE speakerID=? AND telegramID IS NULL",
+	list:         "SELECT speakerID, chatID, name, telegramID, (SELECT COUNT(*) FROM Quotes WHERE (Quotes.speakerID = Speakers.speakerID OR Quotes.quoteID IN (SELECT quoteID FROM QuoteLines WHERE QuoteLines.speakerID = Speakers.speakerID)) AND Quotes.isAvailable=true) AS quotes FROM Speakers WHERE chatID=? ORDER BY quotes DESC, name, speakerID",
+	aliases:      "SELECT speakerID, alias FROM SpeakerAliases WHERE chatID=? ORDER BY alias",
+	moveQuotes:   "UPDATE Quotes SET speakerID=? WHERE speakerID=?",
+	moveLines:    "UPDATE QuoteLines SET speakerID=? WHERE speakerID=?",
+	moveAliases:  "UPDATE SpeakerAliases SET speakerID=? WHERE speakerID=?",
+	linkTelegram: "UPDATE Speakers SET telegramID=COALESCE(telegramID, (SELECT telegramID FROM Speakers WHERE speakerID=?2)) WHERE speakerID=?1",
+	delete:       "DELETE FROM Speakers WHERE speakerID=?",
+}
+
+var postgresSpeakerQueries = speakerQueries{
+	find:         "SELECT speakerID FROM SpeakerAliases WHERE chatID=$1 AND lower(alias)=lower($2)",
+	findTelegram: "SELECT speakerID FROM Speakers WHERE chatID=$1 AND telegramID=$2 ORDER BY speakerID LIMIT 1",
+	create:       "INSERT INTO Speakers (chatID, name) VALUES ($1,$2) RETURNING speakerID",
+	alias:        "INSERT INTO SpeakerAliases (speakerID, chatID, alias) VALUES ($1,$2,$3)",
+	link:         "UPDATE Speakers SET telegramID=$1 WHERE speakerID=$2 AND telegramID IS NULL",
+	list:         "SELECT speakerID, chatID, name, telegramID, (SELECT COUNT(*) FROM Quotes WHERE (Quotes.speakerID = Speakers.speakerID OR Quotes.quoteID IN (SELECT quoteID FROM QuoteLines WHERE QuoteLines.speakerID = Speakers.speakerID)) AND Quotes.isAvailable=true) AS quotes FROM Speakers WHERE chatID=$1 ORDER BY quotes DESC, name, speakerID",
+	aliases:      "SELECT speakerID, alias FROM SpeakerAliases WHERE chatID=$1 ORDER BY alias",
+	moveQuotes:   "UPDATE Quotes SET speakerID=$1 WHERE speakerID=$2",
+	moveLines:    "UPDATE QuoteLines SET speakerID=$1 WHERE speakerID=$2",
+	moveAliases:  "UPDATE SpeakerAliases SET speakerID=$1 WHERE speakerID=$2",
+	linkTelegram: "UPDATE Speakers SET telegramID=COALESCE(telegramID, (SELECT telegramID FROM Speakers WHERE speakerID=$2)) WHERE speakerID=$1",
+	delete:       "DELETE FROM Speakers WHERE speakerID=$1",
+}
+
+// querier runs statements on a database or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// speakerName is the name a context is matched with, "@bob" being "bob". The
+// migration of the contexts to speakers trims them the same way.
+func speakerName(quoteContext string) string {
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(quoteContext), "@"))
+}
+
+// findSpeaker returns the ID of the speaker of the group matching the name, or ErrSpeakerNotFound
+func findSpeaker(ctx context.Context, db querier, q speakerQueries, chatID int64, name string) (int, error) {
+	var speakerID int
+	err := db.QueryRowContext(ctx, q.find, chatID, speakerName(name)).Scan(&speakerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSpeakerNotFound
+	}
+	return speakerID, err
+}
+
+// speakerFor returns the ID of the speaker matching the context, created if
+// unknown, or NULL when the context names nobody. A Telegram user, when known,
+// is linked to the speaker and matches it first, the context becoming one of
+// its aliases if free.
+func speakerFor(ctx context.Context, db querier, q speakerQueries, chatID int64, quoteContext string, telegramID int64) (sql.NullInt64, error) {
+	name := speakerName(quoteContext)
+	if name == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	if telegramID != 0 {
+		var speakerID int
+		err := db.QueryRowContext(ctx, q.findTelegram, chatID, telegramID).Scan(&speakerID)
+		switch {
+		case err == nil:
+			_, err = findSpeaker(ctx, db, q, chatID, name)
+			if errors.Is(err, ErrSpeakerNotFound) {
+				_, err = db.ExecContext(ctx, q.alias, speakerID, chatID, name)
+			}
+			if err != nil {
+				return sql.NullInt64{}, err
+			}
+			return sql.NullInt64{Int64: int64(speakerID), Valid: true}, nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return sql.NullInt64{}, err
+		}
+	}
+
+	speakerID, err := findSpeaker(ctx, db, q, chatID, name)
+	if errors.Is(err, ErrSpeakerNotFound) {
+		err = db.QueryRowContext(ctx, q.create, chatID, name).Scan(&speakerID)
+		if err != nil {
+			return sql.NullInt64{}, err
+		}
+		_, err = db.ExecContext(ctx, q.alias, speakerID, chatID, name)
+	}
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	if telegramID != 0 {
+		_, err = db.ExecContext(ctx, q.link, telegramID, speakerID)
+		if err != nil {
+			return sql.NullInt64{}, err
+		}
+	}
+	return sql.NullInt64{Int64: int64(speakerID), Valid: true}, nil
+}
+
+// getSpeakers returns the speakers of the group with their aliases
+func getSpeakers(ctx context.Context, db querier, q speakerQueries, chatID int64) ([]SpeakerResponse, error) {
+	results, err := db.QueryContext(ctx, q.list, chatID)
+	if err != nil {
+		return nil, err
+	}
+	var speakers []SpeakerResponse
+	positions := make(map[int]int)
+	for results.Next() {
+		var speaker SpeakerResponse
+		var telegramID sql.NullInt64
+		err = results.Scan(&speaker.SpeakerID, &speaker.ChatID, &speaker.Name, &telegramID, &speaker.Quotes)
+		if err != nil {
+			results.Close()
+			return nil, err
+		}
+		speaker.TelegramID = telegramID.Int64
+		positions[speaker.SpeakerID] = len(speakers)
+		speakers = append(speakers, speaker)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+
+	results, err = db.QueryContext(ctx, q.aliases, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	for results.Next() {
+		var speakerID int
+		var alias string
+		err = results.Scan(&speakerID, &alias)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := positions[speakerID]
+		if ok && alias != speakers[i].Name {
+			speakers[i].Aliases = append(speakers[i].Aliases, alias)
+		}
+	}
+	return speakers, results.Err()
+}
+
+// getSpeaker returns the speaker of the group with the given ID
+func getSpeaker(ctx context.Context, db querier, q speakerQueries, chatID int64, speakerID int) (SpeakerResponse, error) {
+	speakers, err := getSpeakers(ctx, db, q, chatID)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+	for _, speaker := range speakers {
+		if speaker.SpeakerID == speakerID {
+			return speaker, nil
+		}
+	}
+	return SpeakerResponse{}, ErrSpeakerNotFound
+}
+
+// aliasSpeaker adds the alias to the speaker in one transaction, an alias the
+// speaker already has is left as is
+func aliasSpeaker(ctx context.Context, db *sql.DB, q speakerQueries, request AliasSpeakerRequest) (SpeakerResponse, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+	defer tx.Rollback()
+
+	speakerID, err := findSpeaker(ctx, tx, q, request.ChatID, request.Speaker)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+	alias := speakerName(request.Alias)
+	if alias == "" {
+		return SpeakerResponse{}, ErrSpeakerNotFound
+	}
+
+	owner, err := findSpeaker(ctx, tx, q, request.ChatID, alias)
+	switch {
+	case err == nil && owner != speakerID:
+		return SpeakerResponse{}, ErrAliasTaken
+	case errors.Is(err, ErrSpeakerNotFound):
+		_, err = tx.ExecContext(ctx, q.alias, speakerID, request.ChatID, alias)
+		if err != nil {
+			return SpeakerResponse{}, err
+		}
+	case err != nil:
+		return SpeakerResponse{}, err
+	}
+
+	speaker, err := getSpeaker(ctx, tx, q, request.ChatID, speakerID)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+	return speaker, tx.Commit()
+}
+
+// mergeSpeakers hands the quotes, the aliases and the Telegram user of a
+// speaker over to another one and deletes it, in one transaction
+func mergeSpeakers(ctx context.Context, db *sql.DB, q speakerQueries, request MergeSpeakersRequest) (SpeakerResponse, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+	defer tx.Rollback()
+
+	from, err := findSpeaker(ctx, tx, q, request.ChatID, request.From)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+	into, err := findSpeaker(ctx, tx, q, request.ChatID, request.Into)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+
+	if from != into {
+		for _, query := range []string{q.moveQuotes, q.moveLines, q.moveAliases, q.linkTelegram} {
+			_, err = tx.ExecContext(ctx, query, into, from)
+			if err != nil {
+				return SpeakerResponse{}, err
+			}
+		}
+		_, err = tx.ExecContext(ctx, q.delete, from)
+		if err != nil {
+			return SpeakerResponse{}, err
+		}
+	}
+
+	speaker, err := getSpeaker(ctx, tx, q, request.ChatID, into)
+	if err != nil {
+		return SpeakerResponse{}, err
+	}
+	return speaker, tx.Commit()
+}
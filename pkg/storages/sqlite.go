@@ -3,252 +3,294 @@ package storages
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
-	"sort"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/adrg/strutil"
-	"github.com/adrg/strutil/metrics"
+	"goquotebot/pkg/search"
+	"goquotebot/pkg/storages/migrations"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
-type Pair struct {
-	Key   int
-	Value float64
-}
+const sqliteQuoteColumns = "Quotes.quoteID, Quotes.content, Quotes.context, Quotes.author, Quotes.createdAt, Quotes.deletedAt, Quotes.isAvailable, Quotes.score, Quotes.upvotes, Quotes.downvotes, Quotes.deletedBy, Quotes.chatID, Quotes.speakerID, (SELECT name FROM Speakers WHERE Speakers.speakerID = Quotes.speakerID), (SELECT group_concat(tag) FROM QuoteTags WHERE QuoteTags.quoteID = Quotes.quoteID), Quotes.saidAt, Quotes.messageID, Quotes.mediaType, Quotes.fileID"
 
-type PairList []Pair
+// reindexScoresQuery recomputes the vote counts kept on Quotes from Votes,
+// it is valid for both SQLite and PostgreSQL
+const reindexScoresQuery = `UPDATE Quotes SET
+	score = COALESCE((SELECT SUM(value) FROM Votes WHERE Votes.quoteID = Quotes.quoteID), 0),
+	upvotes = (SELECT COUNT(*) FROM Votes WHERE Votes.quoteID = Quotes.quoteID AND value > 0),
+	downvotes = (SELECT COUNT(*) FROM Votes WHERE Votes.quoteID = Quotes.quoteID AND value < 0)`
 
 type SqliteWrapper struct {
 	DB *sql.DB
 }
 
-func NewSqliteWrapper(pathDB string) (DB, error) {
-	if !fileExists(pathDB) {
-		fmt.Println("db does not exist, attempting to create it")
-		file, err := os.Create(pathDB) // Create SQLite file
-		if err != nil {
-			return nil, err
-		}
-		file.Close()
-	}
-	db, err := sql.Open("sqlite3", pathDB)
+func NewSqliteWrapper(cfg SqliteConfig) (DB, error) {
+	db, err := OpenSqlite(cfg)
 	if err != nil {
 		return nil, err
 	}
-	wrapper := SqliteWrapper{
-		DB: db,
-	}
-	err = wrapper.CreateQuotesTable()
+
+	migrator, err := migrations.NewSqliteMigrator(db)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	err = wrapper.CreateVotesTable()
+	err = migrator.Up()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
+
+	wrapper := SqliteWrapper{
+		DB: db,
+	}
 	return &wrapper, nil
 }
 
-func (w *SqliteWrapper) Close() error {
-	return w.DB.Close()
-}
+// OpenSqlite opens the SQLite file described by cfg, creating it and its folder if needed, without touching the schema
+func OpenSqlite(cfg SqliteConfig) (*sql.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("storage.sqlite.path must be set")
+	}
 
-//to authorize foreing keys (if needed) : PRAGMA foreign_keys = ON;
-func (w *SqliteWrapper) CreateQuotesTable() error {
-	_, err := w.DB.Exec("CREATE TABLE IF NOT EXISTS Quotes (quoteID INTEGER PRIMARY KEY AUTOINCREMENT, `content` VARCHAR(512) NOT NULL, `context` VARCHAR(255) NOT NULL, `author` VARCHAR(255) NOT NULL, `createdAt` DATETIME DEFAULT CURRENT_TIMESTAMP, `deletedAt` DATETIME DEFAULT NULL, `isAvailable` BOOLEAN NOT NULL) ; UPDATE SQLITE_SEQUENCE SET seq=100 WHERE name='Quotes'")
-	return err
-}
+	dir := filepath.Dir(cfg.Path)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the folder %q of the sqlite database: %w", dir, err)
+	}
 
-func (w *SqliteWrapper) CreateVotesTable() error {
-	_, err := w.DB.Exec("CREATE TABLE IF NOT EXISTS Votes (`voteID` INTEGER PRIMARY KEY AUTOINCREMENT, `quoteID` INTEGER NOT NULL, `voter` sqlite3_int64 NOT NULL, `value` INTEGER NOT NULL, FOREIGN KEY(`quoteID`) REFERENCES Quotes(`quoteID`))")
-	return err
-}
+	db, err := sql.Open("sqlite3", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
 
-func (w *SqliteWrapper) DeleteQuotesTable() error {
-	_, err := w.DB.Exec("DROP TABLE IF EXISTS Quotes;")
-	return err
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot open the sqlite database %q: %w", cfg.Path, err)
+	}
+	err = checkFullText(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
 }
 
-func (w *SqliteWrapper) DeleteVotesTable() error {
-	_, err := w.DB.Exec("DROP TABLE IF EXISTS Votes;")
-	return err
+func (w *SqliteWrapper) Close() error {
+	return w.DB.Close()
 }
 
-func (w *SqliteWrapper) AddQuote(request AddQuoteRequest) (string, error) {
+func (w *SqliteWrapper) AddQuote(ctx context.Context, request AddQuoteRequest) (QuoteResponse, error) {
 	contextIsAllowed := checkContext(request.QuoteContext)
 	if !contextIsAllowed {
-		message := fmt.Sprintf("🚫 Quote not added 🚫 \n Your context:\n *%s* \n\nis forbidden \n", request.QuoteContext)
-		return message, nil
+		return QuoteResponse{}, ErrForbiddenContext
 	}
 
-	isProbablyStored, _, quoteIdOfMax, err := w.checkIfExists(request)
+	tags, err := tagNames(request.Tags)
 	if err != nil {
-		return "", err
+		return QuoteResponse{}, err
 	}
-	if isProbablyStored {
-		message := fmt.Sprintf("🚫 Quote not added 🚫 \n Your quote:\n *%s* \n\nis very similar to quote #Q%d \n", request.Content, quoteIdOfMax)
-		return message, nil
+	err = checkMedia(request.Media)
+	if err != nil {
+		return QuoteResponse{}, err
 	}
 
-	query := "INSERT INTO Quotes (content, context, author, createdAt, isAvailable) VALUES (?,?,?,CURRENT_TIMESTAMP,?)"
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	err = checkStoredDuplicate(ctx, w, request)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
 
-	stmt, err := w.DB.PrepareContext(ctx, query)
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return "", err
+		return QuoteResponse{}, err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	_, err = stmt.ExecContext(ctx, request.Content, request.QuoteContext, request.Author, 1)
-	return "", err
-}
+	speakerID, err := quoteSpeaker(ctx, tx, sqliteSpeakerQueries, request.ChatID, request.Content, request.QuoteContext, request.TelegramIDs)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	mediaType, fileID := mediaColumns(request.Media)
+	query := "INSERT INTO Quotes (chatID, content, context, author, createdAt, isAvailable, speakerID, saidAt, messageID, mediaType, fileID) VALUES (?,?,?,?,CURRENT_TIMESTAMP,?,?,?,?,?,?)"
+	result, err := tx.ExecContext(ctx, query, request.ChatID, request.Content, request.QuoteContext, request.Author, 1, speakerID, saidAt(request.SaidAt), messageID(request.MessageID), mediaType, fileID)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	quoteID, err := result.LastInsertId()
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = addTags(ctx, tx, sqliteTagQueries, int(quoteID), tags)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = addLines(ctx, tx, sqliteDialogueQueries, sqliteSpeakerQueries, request.ChatID, int(quoteID), request.Content, request.TelegramIDs)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return QuoteResponse{}, err
+	}
 
-func (w *SqliteWrapper) DeleteQuote(request UniqueSpecifiedQuoteRequest) error {
-	query := "UPDATE Quotes SET isAvailable=false, deletedAt=CURRENT_TIMESTAMP WHERE quoteID=?"
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	return w.getQuote(ctx, request.ChatID, int(quoteID))
+}
 
+func (w *SqliteWrapper) DeleteQuote(ctx context.Context, request DeleteQuoteRequest) error {
+	query := "UPDATE Quotes SET isAvailable=false, deletedAt=CURRENT_TIMESTAMP, deletedBy=? WHERE quoteID=? AND chatID=? AND isAvailable=true"
 	stmt, err := w.DB.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, request.QuoteID)
-	return err
-}
-
-func (w *SqliteWrapper) GetQuotes(request MultipleSpecifiedQuotesRequest) ([]QuoteResponse, error) {
-	if len(request.QuoteIDs) == 0 {
-		return []QuoteResponse{}, nil
+	result, err := stmt.ExecContext(ctx, request.Deleter, request.QuoteID, request.ChatID)
+	if err != nil {
+		return err
 	}
+	return checkAffected(result)
+}
 
-	args := make([]interface{}, len(request.QuoteIDs))
-	for i, quoteId := range request.QuoteIDs {
-		args[i] = quoteId
-	}
-	query := "SELECT Quotes.*,SUM(Votes.value) FROM Quotes LEFT JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true AND Quotes.quoteID IN ( ?" + strings.Repeat(",?", len(args)-1) + " ) GROUP BY Quotes.quoteID"
+func (w *SqliteWrapper) GetTrash(ctx context.Context, request TrashRequest) ([]QuoteResponse, error) {
+	query := "SELECT " + sqliteQuoteColumns + " FROM Quotes WHERE Quotes.isAvailable=false AND Quotes.chatID=? ORDER BY Quotes.deletedAt DESC, Quotes.quoteID DESC LIMIT ? OFFSET ?"
+	return w.queryQuotes(ctx, query, request.ChatID, request.QuoteNb, request.Offset)
+}
 
-	var value []QuoteResponse
-	results, err := w.DB.Query(query, args...)
+func (w *SqliteWrapper) RestoreQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) (QuoteResponse, error) {
+	query := "UPDATE Quotes SET isAvailable=true, deletedAt=NULL, deletedBy=NULL WHERE quoteID=? AND chatID=? AND isAvailable=false"
+	result, err := w.DB.ExecContext(ctx, query, request.QuoteID, request.ChatID)
 	if err != nil {
-		return value, err
+		return QuoteResponse{}, err
 	}
-
-	defer results.Close()
-	for results.Next() {
-		quote, err := ScanFromResults(results)
-		if err != nil {
-			panic(err.Error())
-		}
-		value = append(value, quote)
+	err = checkAffected(result)
+	if err != nil {
+		return QuoteResponse{}, err
 	}
-	return value, err
+	return w.getQuote(ctx, request.ChatID, request.QuoteID)
 }
 
-func (w *SqliteWrapper) GetLastQuotes(request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
-	query := "SELECT Quotes.*, SUM(Votes.value) FROM Quotes LEFT OUTER JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID ORDER BY Quotes.quoteID DESC LIMIT ? "
-	results, err := w.DB.Query(query, request.QuoteNb)
+func (w *SqliteWrapper) PurgeQuote(ctx context.Context, request UniqueSpecifiedQuoteRequest) error {
+	purged, err := w.purge(ctx, "quoteID=? AND chatID=?", request.QuoteID, request.ChatID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer results.Close()
-	var value []QuoteResponse
-	for results.Next() {
-		quote, err := ScanFromResults(results)
-		if err != nil {
-			panic(err.Error())
-		}
-		value = append(value, quote)
+	if purged == 0 {
+		return ErrNotFound
 	}
-	return value, err
+	return nil
 }
 
-func (w *SqliteWrapper) GetRandomQuotes(request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
-	query := "SELECT Quotes.*,SUM(Votes.value) FROM Quotes LEFT JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID ORDER BY RANDOM() LIMIT ? "
-	var value []QuoteResponse
-	results, err := w.DB.Query(query, request.QuoteNb)
-	if err != nil {
-		return value, err
+func (w *SqliteWrapper) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	return w.purge(ctx, "deletedAt < datetime('now', ?)", fmt.Sprintf("%+d seconds", -int64(olderThan.Seconds())))
+}
+
+func (w *SqliteWrapper) EditQuote(ctx context.Context, request EditQuoteRequest) (QuoteResponse, error) {
+	if !checkContext(request.QuoteContext) {
+		return QuoteResponse{}, ErrForbiddenContext
 	}
-	defer results.Close()
 
-	for results.Next() {
-		quote, err := ScanFromResults(results)
-		if err != nil {
-			panic(err.Error())
-		}
-		value = append(value, quote)
+	err := w.editQuote(ctx, request)
+	if err != nil {
+		return QuoteResponse{}, err
 	}
-	return value, err
+	return w.getQuote(ctx, request.ChatID, request.QuoteID)
 }
 
-func (w *SqliteWrapper) GetTopQuotes(request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
-	query := "SELECT Quotes.*,SUM(Votes.value) FROM Quotes JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID HAVING SUM(Votes.value) >= 0 ORDER BY SUM(Votes.value) DESC LIMIT ? "
-	var value []QuoteResponse
-	results, err := w.DB.Query(query, request.QuoteNb)
+// RollbackQuote restores the content and context of a revision as a new revision
+func (w *SqliteWrapper) RollbackQuote(ctx context.Context, request RollbackQuoteRequest) (QuoteResponse, error) {
+	edit := EditQuoteRequest{ChatID: request.ChatID, QuoteID: request.QuoteID, Editor: request.Editor}
+	query := "SELECT content, context FROM QuoteRevisions WHERE quoteID=? AND revision=?"
+	err := w.DB.QueryRowContext(ctx, query, request.QuoteID, request.Revision).Scan(&edit.Content, &edit.QuoteContext)
+	if errors.Is(err, sql.ErrNoRows) {
+		return QuoteResponse{}, ErrNotFound
+	}
 	if err != nil {
-		return value, err
+		return QuoteResponse{}, err
 	}
-	defer results.Close()
 
-	for results.Next() {
-		quote, err := ScanFromResults(results)
-		if err != nil {
-			panic(err.Error())
-		}
-		value = append(value, quote)
+	err = w.editQuote(ctx, edit)
+	if err != nil {
+		return QuoteResponse{}, err
 	}
-	return value, err
+	return w.getQuote(ctx, request.ChatID, request.QuoteID)
 }
 
-func (w *SqliteWrapper) GetFlopQuotes(request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
-	query := "SELECT Quotes.*,SUM(Votes.value) FROM Quotes JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID HAVING SUM(Votes.value) <= 0 ORDER BY SUM(Votes.value) ASC LIMIT ? "
-	var value []QuoteResponse
-	results, err := w.DB.Query(query, request.QuoteNb)
+func (w *SqliteWrapper) GetRevisions(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]RevisionResponse, error) {
+	err := w.checkAvailable(ctx, request.ChatID, request.QuoteID)
 	if err != nil {
-		return value, err
+		return nil, err
+	}
+
+	query := "SELECT quoteID, revision, content, context, editor, editedAt, diff FROM QuoteRevisions WHERE quoteID=? ORDER BY revision"
+	results, err := w.DB.QueryContext(ctx, query, request.QuoteID)
+	if err != nil {
+		return nil, err
 	}
 	defer results.Close()
 
+	var revisions []RevisionResponse
 	for results.Next() {
-		quote, err := ScanFromResults(results)
+		var revision RevisionResponse
+		var editedAt sql.NullString
+		err := results.Scan(&revision.QuoteID, &revision.Revision, &revision.Content, &revision.QuoteContext, &revision.Editor, &editedAt, &revision.Diff)
 		if err != nil {
-			panic(err.Error())
+			return revisions, err
 		}
-		value = append(value, quote)
+		revision.EditedAt, err = sqliteTsToTime(editedAt)
+		if err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, revision)
 	}
-	return value, err
+	return revisions, results.Err()
 }
 
-func (w *SqliteWrapper) UnVoteQuote(request VoteQuoteRequest) error {
-	query := "DELETE FROM Votes WHERE quoteID=? AND voter=?"
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (w *SqliteWrapper) GetQuotes(ctx context.Context, request MultipleSpecifiedQuotesRequest) ([]QuoteResponse, error) {
+	if len(request.QuoteIDs) == 0 {
+		return []QuoteResponse{}, nil
+	}
 
-	stmt, err := w.DB.PrepareContext(ctx, query)
-	if err != nil {
-		return err
+	args := make([]interface{}, 0, len(request.QuoteIDs)+1)
+	args = append(args, request.ChatID)
+	for _, quoteId := range request.QuoteIDs {
+		args = append(args, quoteId)
 	}
-	defer stmt.Close()
+	query := "SELECT " + sqliteQuoteColumns + " FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=? AND Quotes.quoteID IN ( ?" + strings.Repeat(",?", len(request.QuoteIDs)-1) + " )"
+	return w.queryQuotes(ctx, query, args...)
+}
 
-	_, err = stmt.ExecContext(ctx, request.QuoteID, request.Voter)
-	return err
+func (w *SqliteWrapper) GetLastQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return w.listQuotes(ctx, request, "", "Quotes.quoteID DESC")
+}
+
+func (w *SqliteWrapper) GetRandomQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return w.listQuotes(ctx, request, "", "RANDOM()")
 }
 
-func (w *SqliteWrapper) UpVoteQuote(request VoteQuoteRequest) error {
-	err := w.UnVoteQuote(request)
+func (w *SqliteWrapper) GetTopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return w.listQuotes(ctx, request, " AND Quotes.score >= 0 AND Quotes.upvotes + Quotes.downvotes > 0", "Quotes.score DESC, Quotes.quoteID")
+}
+
+func (w *SqliteWrapper) GetFlopQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error) {
+	return w.listQuotes(ctx, request, " AND Quotes.score <= 0 AND Quotes.upvotes + Quotes.downvotes > 0", "Quotes.score ASC, Quotes.quoteID")
+}
+
+func (w *SqliteWrapper) UnVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	err := w.checkAvailable(ctx, request.ChatID, request.QuoteID)
 	if err != nil {
 		return err
 	}
-	query := "INSERT INTO Votes (quoteID, voter, value) VALUES (?,?,1)"
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
+	query := "DELETE FROM Votes WHERE quoteID=? AND voter=?"
 	stmt, err := w.DB.PrepareContext(ctx, query)
 	if err != nil {
 		return err
@@ -259,176 +301,328 @@ func (w *SqliteWrapper) UpVoteQuote(request VoteQuoteRequest) error {
 	return err
 }
 
-func (w *SqliteWrapper) DownVoteQuote(request VoteQuoteRequest) error {
-	err := w.UnVoteQuote(request)
+func (w *SqliteWrapper) UpVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	return w.vote(ctx, request, 1)
+}
+
+func (w *SqliteWrapper) DownVoteQuote(ctx context.Context, request VoteQuoteRequest) error {
+	return w.vote(ctx, request, -1)
+}
+
+func (w *SqliteWrapper) AdoptQuotes(ctx context.Context, chatID int64) (int, error) {
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	query := "INSERT INTO Votes (quoteID, voter, value) VALUES (?,?,-1)"
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	defer tx.Rollback()
 
-	stmt, err := w.DB.PrepareContext(ctx, query)
+	adopted, err := adoptQuotes(ctx, tx, chatID, "UPDATE Quotes SET chatID=? WHERE chatID=0", "UPDATE Votes SET chatID=? WHERE chatID=0", "UPDATE Speakers SET chatID=? WHERE chatID=0", "UPDATE SpeakerAliases SET chatID=? WHERE chatID=0")
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer stmt.Close()
+	return adopted, tx.Commit()
+}
 
-	_, err = stmt.ExecContext(ctx, request.QuoteID, request.Voter)
+func (w *SqliteWrapper) AddPost(ctx context.Context, request AddPostRequest) error {
+	return addPost(ctx, w.DB, sqlitePostQueries, request)
+}
+
+func (w *SqliteWrapper) GetPosts(ctx context.Context, request UniqueSpecifiedQuoteRequest) ([]PostResponse, error) {
+	return getPosts(ctx, w.DB, sqlitePostQueries, request)
+}
+
+func (w *SqliteWrapper) GetSpeakers(ctx context.Context, chatID int64) ([]SpeakerResponse, error) {
+	return getSpeakers(ctx, w.DB, sqliteSpeakerQueries, chatID)
+}
+
+func (w *SqliteWrapper) AliasSpeaker(ctx context.Context, request AliasSpeakerRequest) (SpeakerResponse, error) {
+	return aliasSpeaker(ctx, w.DB, sqliteSpeakerQueries, request)
+}
+
+func (w *SqliteWrapper) MergeSpeakers(ctx context.Context, request MergeSpeakersRequest) (SpeakerResponse, error) {
+	return mergeSpeakers(ctx, w.DB, sqliteSpeakerQueries, request)
+}
+
+func (w *SqliteWrapper) TagQuote(ctx context.Context, request TagQuoteRequest) (QuoteResponse, error) {
+	err := tagQuote(ctx, w.DB, sqliteTagQueries, request)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	return w.getQuote(ctx, request.ChatID, request.QuoteID)
+}
+
+func (w *SqliteWrapper) GetTags(ctx context.Context, chatID int64) ([]TagResponse, error) {
+	return getTags(ctx, w.DB, sqliteTagQueries, chatID)
+}
+
+func (w *SqliteWrapper) ReindexScores(ctx context.Context) error {
+	_, err := w.DB.ExecContext(ctx, reindexScoresQuery)
 	return err
 }
 
-func (w *SqliteWrapper) SearchWord(request SearchExpressionRequest) ([]QuoteResponse, error) {
-	query := `SELECT Quotes.*,SUM(Votes.value) FROM Quotes LEFT JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true AND Quotes.content LIKE ? GROUP BY Quotes.quoteID ORDER BY RANDOM() LIMIT ?`
-	var value []QuoteResponse
-	results, err := w.DB.Query(query, "%"+request.Expression+"%", request.QuoteNb)
+func (w *SqliteWrapper) GetContents(ctx context.Context, chatID int64) (map[int]string, error) {
+	quoteArray := make(map[int]string)
+	results, err := w.DB.QueryContext(ctx, "SELECT quoteID, content FROM Quotes WHERE isAvailable=true AND chatID=?", chatID)
 	if err != nil {
-		return value, err
+		return quoteArray, err
 	}
 	defer results.Close()
 
 	for results.Next() {
-		quote, err := ScanFromResults(results)
+		var quoteID int
+		var content string
+		err := results.Scan(&quoteID, &content)
 		if err != nil {
-			panic(err.Error())
+			return quoteArray, err
 		}
-		value = append(value, quote)
+		quoteArray[quoteID] = content
+	}
+	return quoteArray, results.Err()
+}
+
+// SearchWord returns the quotes whose content or context has every word of the
+// expression as a word prefix, the most relevant first
+func (w *SqliteWrapper) SearchWord(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	terms := searchTerms(request.Expression)
+	if len(terms) == 0 {
+		return []QuoteResponse{}, nil
 	}
-	return value, err
+
+	// bm25 is lower for better matches, the content weighs more than the context
+	query := "SELECT " + sqliteQuoteColumns + " FROM QuotesFTS JOIN Quotes ON Quotes.quoteID = QuotesFTS.rowid WHERE QuotesFTS MATCH ? AND Quotes.isAvailable=true AND Quotes.chatID=? ORDER BY bm25(QuotesFTS, 2.0, 1.0), Quotes.quoteID DESC LIMIT ? OFFSET ?"
+	return w.queryQuotes(ctx, query, fts5Query(terms), request.ChatID, request.QuoteNb, request.Offset)
 }
 
-func (w *SqliteWrapper) SearchExpression(request SearchExpressionRequest) ([]QuoteResponse, error) {
-	quoteArray, err := w.getAllDBContent()
+// SearchExpression scores every available quote, NewDB wraps the store in an
+// IndexedDB to keep the index between searches
+func (w *SqliteWrapper) SearchExpression(ctx context.Context, request SearchExpressionRequest) ([]QuoteResponse, error) {
+	index, err := loadIndex(ctx, w, request.ChatID, search.Config{})
 	if err != nil {
 		return []QuoteResponse{}, err
 	}
-	threshold := 0.1
-	_, similarQuotes, _ := measureIndex(request.Expression, quoteArray, threshold)
-	topMatchQuotes := topMatch(similarQuotes, request.QuoteNb, threshold)
-	resultQuoteIDs := make([]string, 0)
-	for _, quoteID := range topMatchQuotes {
-		resultQuoteIDs = append(resultQuoteIDs, fmt.Sprint(quoteID))
-	}
-	fmt.Println("quoteId", resultQuoteIDs)
-	results, err := w.GetQuotes(MultipleSpecifiedQuotesRequest{
-		QuoteIDs: resultQuoteIDs,
-	})
-	return results, err
+	return searchIndex(ctx, w, index, request)
 }
 
 //============================
 //helpers, appendice functions
 
-func checkContext(context string) bool {
-	blacklist := []string{"Anonyme", "anonyme", "Anonymous"} //en attendant de faire une regex
-	for _, forbiddenWord := range blacklist {
-		if context == forbiddenWord {
-			return false
-		}
+// vote stores or replaces the vote of the voter in a single statement, the
+// unique (quoteID, voter) index makes concurrent votes from the same voter safe
+func (w *SqliteWrapper) vote(ctx context.Context, request VoteQuoteRequest, value int) error {
+	query := "INSERT INTO Votes (quoteID, chatID, voter, value) SELECT quoteID, chatID, ?, ? FROM Quotes WHERE quoteID=? AND chatID=? AND isAvailable=true ON CONFLICT (quoteID, voter) DO UPDATE SET value=excluded.value"
+	stmt, err := w.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return err
 	}
-	return true
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, request.Voter, value, request.QuoteID, request.ChatID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
 }
 
-func topMatch(similarQuotes map[int]float64, max int, threshold float64) []int {
-	tops := []int{}
-	p := make(PairList, len(similarQuotes))
+// listQuotes returns the available quotes of the group matching the filter of
+// the request and the conditions, sorted by order
+func (w *SqliteWrapper) listQuotes(ctx context.Context, request MultipleUnspecifiedQuotesRequest, conditions string, order string) ([]QuoteResponse, error) {
+	query := "SELECT " + sqliteQuoteColumns + " FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=?" + conditions
+	args := []interface{}{request.ChatID}
+	if request.Filter.Tag != "" {
+		tag, err := tagName(request.Filter.Tag)
+		if err != nil {
+			return nil, err
+		}
+		query += " AND Quotes.quoteID IN (SELECT quoteID FROM QuoteTags WHERE tag=?)"
+		args = append(args, tag)
+	}
+	query += " ORDER BY " + order + " LIMIT ? OFFSET ?"
+	args = append(args, request.QuoteNb, request.Offset)
+	return w.queryQuotes(ctx, query, args...)
+}
 
-	i := 0
-	for k, v := range similarQuotes {
-		p[i] = Pair{k, v}
-		i++
+// queryQuotes runs a query selecting sqliteQuoteColumns, the lines of the
+// dialogues being loaded next
+func (w *SqliteWrapper) queryQuotes(ctx context.Context, query string, args ...interface{}) ([]QuoteResponse, error) {
+	results, err := w.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
-	sort.SliceStable(p, func(i, j int) bool {
-		return p[i].Value > p[j].Value
-	})
-	for _, k := range p {
-		if k.Value > threshold {
-			tops = append(tops, k.Key)
+	var value []QuoteResponse
+	for results.Next() {
+		quote, err := ScanFromResults(results)
+		if err != nil {
+			results.Close()
+			return value, err
 		}
+		value = append(value, quote)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		return value, err
 	}
-	return tops
-}
 
-func (w *SqliteWrapper) getAllDBContent() (map[int]string, error) {
-	quoteArray := make(map[int]string, 0)
-	query := "SELECT Quotes.quoteID,content FROM Quotes WHERE isAvailable=true "
-	results, err := w.DB.Query(query)
+	ids := dialogueIDs(value)
+	if len(ids) == 0 {
+		return value, nil
+	}
+	query = "SELECT QuoteLines.quoteID, QuoteLines.speakerID, Speakers.name, QuoteLines.content FROM QuoteLines LEFT JOIN Speakers ON Speakers.speakerID = QuoteLines.speakerID WHERE QuoteLines.quoteID IN (?" + strings.Repeat(",?", len(ids)-1) + ") ORDER BY QuoteLines.quoteID, QuoteLines.position"
+	results, err = w.DB.QueryContext(ctx, query, ids...)
 	if err != nil {
-		return quoteArray, err
+		return value, err
 	}
 	defer results.Close()
+	return value, scanLines(results, value)
+}
+
+// editQuote updates the quote and records the new revision in one transaction,
+// nothing is recorded when neither the content nor the context change
+func (w *SqliteWrapper) editQuote(ctx context.Context, request EditQuoteRequest) error {
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldContent, oldContext string
+	err = tx.QueryRowContext(ctx, "SELECT content, context FROM Quotes WHERE quoteID=? AND chatID=? AND isAvailable=true", request.QuoteID, request.ChatID).Scan(&oldContent, &oldContext)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	diff := revisionDiff(oldContent, oldContext, request.Content, request.QuoteContext)
+	if diff == "" {
+		return nil
+	}
+
+	speakerID, err := quoteSpeaker(ctx, tx, sqliteSpeakerQueries, request.ChatID, request.Content, request.QuoteContext, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE Quotes SET content=?, context=?, speakerID=? WHERE quoteID=?", request.Content, request.QuoteContext, speakerID, request.QuoteID)
+	if err != nil {
+		return err
+	}
+	err = replaceLines(ctx, tx, sqliteDialogueQueries, sqliteSpeakerQueries, request.ChatID, request.QuoteID, oldContent, request.Content)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO QuoteRevisions (quoteID, revision, content, context, editor, editedAt, diff) SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, CURRENT_TIMESTAMP, ? FROM QuoteRevisions WHERE quoteID=?"
+	_, err = tx.ExecContext(ctx, query, request.QuoteID, request.Content, request.QuoteContext, request.Editor, diff, request.QuoteID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// purge deletes the trashed quotes matching the condition, with their votes,
+// revisions, tags, lines and posts, in one transaction
+func (w *SqliteWrapper) purge(ctx context.Context, condition string, args ...interface{}) (int, error) {
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	results, err := tx.QueryContext(ctx, "SELECT quoteID FROM Quotes WHERE isAvailable=false AND "+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	var quoteIDs []interface{}
 	for results.Next() {
-		var quote QuoteResponse
-		var quoteID sql.NullInt32
-		var content sql.NullString
-		err := results.Scan(&quoteID, &content)
+		var quoteID int
+		err = results.Scan(&quoteID)
 		if err != nil {
-			return quoteArray, err
-		}
-		if !quoteID.Valid {
-			return quoteArray, nil
-		} else {
-			quote = QuoteResponse{
-				QuoteID: int(quoteID.Int32),
-				Content: content.String,
-			}
+			results.Close()
+			return 0, err
 		}
+		quoteIDs = append(quoteIDs, quoteID)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		return 0, err
+	}
+	if len(quoteIDs) == 0 {
+		return 0, nil
+	}
+
+	in := "IN (?" + strings.Repeat(",?", len(quoteIDs)-1) + ")"
+	for _, table := range []string{"Votes", "QuoteRevisions", "QuoteTags", "QuoteLines", "QuotePosts", "Quotes"} {
+		_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE quoteID "+in, quoteIDs...)
 		if err != nil {
-			return quoteArray, err
+			return 0, err
 		}
-		quoteArray[quote.QuoteID] = quote.Content
 	}
-	return quoteArray, nil
+	return len(quoteIDs), tx.Commit()
 }
 
-func (w *SqliteWrapper) checkIfExists(request AddQuoteRequest) (bool, map[int]float64, int, error) {
-	similarQuotes := make(map[int]float64, 5)
-	quoteArray, err := w.getLast5Contents()
+// getQuote returns the available quote of the group with the given ID, or ErrNotFound
+func (w *SqliteWrapper) getQuote(ctx context.Context, chatID int64, quoteID int) (QuoteResponse, error) {
+	quotes, err := w.GetQuotes(ctx, MultipleSpecifiedQuotesRequest{ChatID: chatID, QuoteIDs: []string{fmt.Sprint(quoteID)}})
 	if err != nil {
-		return false, similarQuotes, 0, err
+		return QuoteResponse{}, err
+	}
+	if len(quotes) == 0 {
+		return QuoteResponse{}, ErrNotFound
 	}
-	//check if stored in the 5 last quotes:
-	isStored, similarQuotes, max := measureIndex(request.Content, quoteArray, 0.45)
-	return isStored, similarQuotes, max, nil
+	return quotes[0], nil
 }
 
-func (w *SqliteWrapper) getLast5Contents() (map[int]string, error) {
-	query := "SELECT *,0 FROM Quotes WHERE Quotes.isAvailable=true ORDER BY Quotes.quoteID DESC LIMIT 5 "
-	results, err := w.DB.Query(query)
-	quoteArray := make(map[int]string, 0)
+// checkAvailable returns ErrNotFound if the quote does not exist in the group or has been deleted
+func (w *SqliteWrapper) checkAvailable(ctx context.Context, chatID int64, quoteID int) error {
+	var count int
+	err := w.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM Quotes WHERE quoteID=? AND chatID=? AND isAvailable=true", quoteID, chatID).Scan(&count)
 	if err != nil {
-		return quoteArray, err
+		return err
 	}
-	defer results.Close()
-	for results.Next() {
-		quote, err := ScanFromResults(results)
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// adoptQuotes runs the statements moving the quotes of chat 0 and what
+// belongs to them to the group, it is shared by SQLite and PostgreSQL
+func adoptQuotes(ctx context.Context, tx *sql.Tx, chatID int64, quotesQuery string, otherQueries ...string) (int, error) {
+	result, err := tx.ExecContext(ctx, quotesQuery, chatID)
+	if err != nil {
+		return 0, err
+	}
+	adopted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	for _, query := range otherQueries {
+		_, err = tx.ExecContext(ctx, query, chatID)
 		if err != nil {
-			return quoteArray, err
+			return 0, err
 		}
-		quoteArray[quote.QuoteID] = quote.Content
-	}
-	return quoteArray, nil
-
-}
-
-func measureIndex(quote string, quoteArray map[int]string, threshold float64) (bool, map[int]float64, int) {
-	results := make(map[int]float64, 5)
-	isProbablyStored := false
-	QuoteIdOfMax, val := 0, 0.0
-	for quoteID, storedQuote := range quoteArray {
-		sd := metrics.NewSorensenDice()
-		similarity := strutil.Similarity(quote, storedQuote, sd)
-		results[quoteID] = similarity
-		if similarity >= threshold {
-			results[quoteID] = similarity
-			isProbablyStored = true
-			if similarity > val {
-				val = similarity
-				QuoteIdOfMax = quoteID
-			}
+	}
+	return int(adopted), nil
+}
+
+// checkAffected returns ErrNotFound if the statement did not change any row
+func checkAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func checkContext(context string) bool {
+	blacklist := []string{"Anonyme", "anonyme", "Anonymous"} //en attendant de faire une regex
+	for _, forbiddenWord := range blacklist {
+		if context == forbiddenWord {
+			return false
 		}
 	}
-	return isProbablyStored, results, QuoteIdOfMax
+	return true
 }
 
 func sqliteTsToTime(val sql.NullString) (time.Time, error) {
@@ -446,12 +640,23 @@ func ScanFromResults(results *sql.Rows) (QuoteResponse, error) {
 	var deletionDate sql.NullString
 	var creationDate sql.NullString
 	var votes sql.NullInt32
+	var upVotes sql.NullInt32
+	var downVotes sql.NullInt32
 	var quoteID sql.NullInt32
 	var content sql.NullString
 	var quoteContext sql.NullString
 	var author sql.NullString
 	var isActive sql.NullBool
-	err := results.Scan(&quoteID, &content, &quoteContext, &author, &creationDate, &deletionDate, &isActive, &votes)
+	var deletedBy sql.NullString
+	var chatID sql.NullInt64
+	var speakerID sql.NullInt32
+	var speaker sql.NullString
+	var tags sql.NullString
+	var saidDate sql.NullString
+	var message sql.NullInt64
+	var mediaType sql.NullString
+	var fileID sql.NullString
+	err := results.Scan(&quoteID, &content, &quoteContext, &author, &creationDate, &deletionDate, &isActive, &votes, &upVotes, &downVotes, &deletedBy, &chatID, &speakerID, &speaker, &tags, &saidDate, &message, &mediaType, &fileID)
 	if err != nil {
 		return quote, err
 	}
@@ -460,10 +665,19 @@ func ScanFromResults(results *sql.Rows) (QuoteResponse, error) {
 	} else {
 		quote = QuoteResponse{
 			QuoteID:      int(quoteID.Int32),
+			ChatID:       chatID.Int64,
 			Content:      content.String,
 			QuoteContext: quoteContext.String,
 			Author:       author.String,
+			DeletedBy:    deletedBy.String,
+			SpeakerID:    int(speakerID.Int32),
+			Speaker:      speaker.String,
+			Tags:         splitTags(tags),
+			MessageID:    int(message.Int64),
+			Media:        Media{Type: MediaType(mediaType.String), FileID: fileID.String},
 			IsActive:     isActive.Bool,
+			UpVotes:      int(upVotes.Int32),
+			DownVotes:    int(downVotes.Int32),
 		}
 		quote.CreatedAt, err = sqliteTsToTime(creationDate)
 		if err != nil {
@@ -473,6 +687,10 @@ func ScanFromResults(results *sql.Rows) (QuoteResponse, error) {
 		if err != nil {
 			return quote, err
 		}
+		quote.SaidAt, err = sqliteTsToTime(saidDate)
+		if err != nil {
+			return quote, err
+		}
 		if !votes.Valid {
 			quote.Votes = 0
 		} else {
@@ -481,11 +699,3 @@ func ScanFromResults(results *sql.Rows) (QuoteResponse, error) {
 		return quote, err
 	}
 }
-
-func fileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		return false
-	}
-	return !info.IsDir()
-}
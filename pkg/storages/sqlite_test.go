@@ -1,13 +1,19 @@
 package storages
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"goquotebot/pkg/search"
+
 	"github.com/DATA-DOG/go-sqlmock"
 )
 
@@ -20,11 +26,21 @@ func NewMock() (*sql.DB, sqlmock.Sqlmock) {
 	return db, mock
 }
 
+// skipWithoutFullText skips the tests of the SQLite store when go-sqlite3 was
+// built without the sqlite_fts5 tag, which the store requires
+func skipWithoutFullText(t testing.TB, err error) {
+	t.Helper()
+	if errors.Is(err, ErrNoFullText) {
+		t.Skip("built without -tags sqlite_fts5")
+	}
+}
+
 func TestNewSqliteWrapper(t *testing.T) {
 	fmt.Println("TestNewSqliteWrapper")
-	server, err := NewSqliteWrapper("/tmp/test.db")
+	server, err := NewSqliteWrapper(SqliteConfig{Path: filepath.Join(t.TempDir(), "test.db")})
 	if err != nil {
-		t.Errorf("error %v should not have occured", err)
+		skipWithoutFullText(t, err)
+		t.Fatalf("error %v should not have occured", err)
 	}
 	err = server.Close()
 	if err != nil {
@@ -32,7 +48,7 @@ func TestNewSqliteWrapper(t *testing.T) {
 	}
 }
 
-func TestMeasureIndex(t *testing.T) {
+func TestCheckDuplicate(t *testing.T) {
 	threshold := 0.6
 	samples := []struct {
 		Input            string
@@ -116,45 +132,56 @@ func TestMeasureIndex(t *testing.T) {
 	}
 
 	for _, sample := range samples {
-		isProbablyStored, _, _ := measureIndex(sample.Input, sample.ExistingContents, threshold)
+		index, err := search.NewIndex(search.Config{Threshold: threshold})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		for quoteID, content := range sample.ExistingContents {
+			index.Add(quoteID, content)
+		}
+		err = checkDuplicate(index, AddQuoteRequest{Content: sample.Input})
+		isProbablyStored := errors.As(err, &ErrProbableDuplicate{})
 		if isProbablyStored != sample.ExpectedBool {
-			t.Errorf("error during measureIndex for %s, expecting %t", sample.Input, sample.ExpectedBool)
+			t.Errorf("error during checkDuplicate for %s, expecting %t", sample.Input, sample.ExpectedBool)
 		}
 	}
 }
 
-func TestCheckIfExists(t *testing.T) {
+func TestCheckStoredDuplicate(t *testing.T) {
 	db, mock := NewMock()
 	defer db.Close()
 	w := SqliteWrapper{
 		DB: db,
 	}
 	request := AddQuoteRequest{
+		ChatID:       7,
 		Author:       "author",
 		Content:      "content",
 		QuoteContext: "context",
 	}
-	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes"})
-	for i := 0; i < 5; i++ {
-		u := QuoteResponse{
-			QuoteID:      i,
-			Author:       "a",
-			Content:      "b",
-			QuoteContext: "c",
-			CreatedAt:    time.Time{},
-			DeletedAt:    time.Time{},
-			IsActive:     true,
-			Votes:        1,
-		}
-		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes)
+	rows := sqlmock.NewRows([]string{"quoteID", "content"})
+	for i := 0; i < 20; i++ {
+		rows = rows.AddRow(i, fmt.Sprintf("quote n°%d", i))
 	}
-	query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true ORDER BY Quotes.quoteID DESC LIMIT 5 "
-	mock.ExpectQuery(query).WillReturnRows(rows)
-	isStored, similarQuotes, _, err := w.checkIfExists(request)
+	rows = rows.AddRow(20, "Content")
+	query := "SELECT quoteID, content FROM Quotes WHERE isAvailable=true AND chatID=\\?"
+	mock.ExpectQuery(query).WithArgs(request.ChatID).WillReturnRows(rows)
+
+	err := checkStoredDuplicate(context.Background(), &w, request)
+	var duplicate ErrProbableDuplicate
+	if !errors.As(err, &duplicate) || duplicate.Matches[0].QuoteID != 20 {
+		t.Errorf("got %v, wanted a duplicate of quote 20", err)
+	}
+
+	// IndexedDB has already looked for duplicates
+	request.checked = true
+	err = checkStoredDuplicate(context.Background(), &w, request)
 	if err != nil {
-		t.Errorf("Error in CheckIfExists: %v", err)
+		t.Errorf("error %v should not have occured", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
-	_, _ = isStored, similarQuotes
 }
 
 func TestAddQuote(t *testing.T) {
@@ -167,36 +194,38 @@ func TestAddQuote(t *testing.T) {
 
 	for i := 0; i < 20; i++ {
 		quote := AddQuoteRequest{
+			ChatID:       7,
 			Author:       fmt.Sprintf("author%d", rand.Intn(10)+1),
 			Content:      fmt.Sprintf("blabla content n°%d", rand.Intn(10)+1),
 			QuoteContext: fmt.Sprintf("context%d", rand.Intn(10)+1),
 		}
 
-		rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes"})
+		rows := sqlmock.NewRows([]string{"quoteID", "content"})
 		for i := 0; i < 5; i++ {
-			u := QuoteResponse{
-				QuoteID:      i,
-				Author:       "a",
-				Content:      "b",
-				QuoteContext: "c",
-				CreatedAt:    time.Time{},
-				DeletedAt:    time.Time{},
-				IsActive:     true,
-				Votes:        1,
-			}
-			rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes)
+			rows = rows.AddRow(i, "b")
 		}
-		query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true ORDER BY Quotes.quoteID DESC LIMIT 5 "
-		mock.ExpectQuery(query).WillReturnRows(rows)
-
-		query = "INSERT INTO Quotes \\(content, context, author, createdAt, isAvailable\\) VALUES \\(.*?,.*?,.*?,CURRENT_TIMESTAMP,.*?\\)"
-		prep := mock.ExpectPrepare(query)
-		prep.ExpectExec().WithArgs(quote.Content, quote.QuoteContext, quote.Author, 1).WillReturnResult(sqlmock.NewResult(0, 1))
-
-		_, err := w.AddQuote(quote)
+		query := "SELECT quoteID, content FROM Quotes WHERE isAvailable=true AND chatID=\\?"
+		mock.ExpectQuery(query).WithArgs(quote.ChatID).WillReturnRows(rows)
+
+		mock.ExpectBegin()
+		query = "SELECT speakerID FROM SpeakerAliases WHERE chatID=\\? AND lower\\(alias\\)=lower\\(\\?\\)"
+		mock.ExpectQuery(query).WithArgs(quote.ChatID, quote.QuoteContext).WillReturnRows(sqlmock.NewRows([]string{"speakerID"}).AddRow(3))
+		query = "INSERT INTO Quotes \\(chatID, content, context, author, createdAt, isAvailable, speakerID, saidAt, messageID, mediaType, fileID\\) VALUES \\(.*?,.*?,.*?,.*?,CURRENT_TIMESTAMP,.*?,.*?,.*?,.*?,.*?,.*?\\)"
+		mock.ExpectExec(query).WithArgs(quote.ChatID, quote.Content, quote.QuoteContext, quote.Author, 1, 3, nil, nil, nil, nil).WillReturnResult(sqlmock.NewResult(101, 1))
+		mock.ExpectCommit()
+
+		rows = sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"}).
+			AddRow(101, quote.Content, quote.QuoteContext, quote.Author, time.Time{}, time.Time{}, true, 0, 0, 0, nil, quote.ChatID, 3, quote.QuoteContext, nil, nil, nil, nil, nil)
+		query = "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=.*? AND Quotes.quoteID IN \\(.*?\\)"
+		mock.ExpectQuery(query).WithArgs(quote.ChatID, "101").WillReturnRows(rows)
+
+		added, err := w.AddQuote(context.Background(), quote)
 		if err != nil {
 			t.Errorf("Error in AddQuote: %v", err)
 		}
+		if added.QuoteID != 101 || added.Content != quote.Content || added.SpeakerID != 3 {
+			t.Errorf("AddQuote returned %+v", added)
+		}
 	}
 }
 
@@ -208,18 +237,74 @@ func TestDeleteQuote(t *testing.T) {
 	}
 
 	for i := 0; i < 10; i++ {
-		quote := UniqueSpecifiedQuoteRequest{
+		quote := DeleteQuoteRequest{
+			ChatID:  7,
 			QuoteID: rand.Intn(20) - 10,
+			Deleter: "alice",
 		}
-		query := "UPDATE Quotes SET isAvailable=false, deletedAt=CURRENT_TIMESTAMP WHERE quoteID=?"
+		query := `UPDATE Quotes SET isAvailable=false, deletedAt=CURRENT_TIMESTAMP, deletedBy=\? WHERE quoteID=\? AND chatID=\? AND isAvailable=true`
 		prep := mock.ExpectPrepare(query)
-		prep.ExpectExec().WithArgs(quote.QuoteID).WillReturnResult(sqlmock.NewResult(0, 1))
+		prep.ExpectExec().WithArgs(quote.Deleter, quote.QuoteID, quote.ChatID).WillReturnResult(sqlmock.NewResult(0, 1))
 
-		err := w.DeleteQuote(quote)
+		err := w.DeleteQuote(context.Background(), quote)
 		if err != nil {
 			t.Errorf("Error in DeleteQuote: %v", err)
 		}
 	}
+
+	query := `UPDATE Quotes SET isAvailable=false, deletedAt=CURRENT_TIMESTAMP, deletedBy=\? WHERE quoteID=\? AND chatID=\? AND isAvailable=true`
+	prep := mock.ExpectPrepare(query)
+	prep.ExpectExec().WithArgs("alice", 42, int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := w.DeleteQuote(context.Background(), DeleteQuoteRequest{ChatID: 7, QuoteID: 42, Deleter: "alice"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v when deleting an unknown quote, wanted %v", err, ErrNotFound)
+	}
+}
+
+func TestEditQuote(t *testing.T) {
+	db, mock := NewMock()
+	defer db.Close()
+	w := SqliteWrapper{
+		DB: db,
+	}
+
+	request := EditQuoteRequest{ChatID: 7, QuoteID: 101, Content: "new content", QuoteContext: "context", Editor: "editor"}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT content, context FROM Quotes WHERE quoteID=\\? AND chatID=\\? AND isAvailable=true").WithArgs(101, request.ChatID).
+		WillReturnRows(sqlmock.NewRows([]string{"content", "context"}).AddRow("old content", "context"))
+	mock.ExpectQuery("SELECT speakerID FROM SpeakerAliases WHERE chatID=\\? AND lower\\(alias\\)=lower\\(\\?\\)").WithArgs(request.ChatID, "context").
+		WillReturnRows(sqlmock.NewRows([]string{"speakerID"}).AddRow(3))
+	mock.ExpectExec("UPDATE Quotes SET content=\\?, context=\\?, speakerID=\\? WHERE quoteID=\\?").WithArgs("new content", "context", 3, 101).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO QuoteRevisions .*? SELECT \\?, COALESCE\\(MAX\\(revision\\), 0\\) \\+ 1, .*? FROM QuoteRevisions WHERE quoteID=\\?").
+		WithArgs(101, "new content", "context", "editor", "content: [-old-] {+new+} content", 101).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"}).
+		AddRow(101, "new content", "context", "author", time.Time{}, time.Time{}, true, 0, 0, 0, nil, request.ChatID, 3, "context", "work,cats", nil, nil, nil, nil)
+	mock.ExpectQuery("SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=.*? AND Quotes.quoteID IN \\(.*?\\)").WithArgs(request.ChatID, "101").WillReturnRows(rows)
+
+	edited, err := w.EditQuote(context.Background(), request)
+	if err != nil {
+		t.Errorf("Error in EditQuote: %v", err)
+	}
+	if edited.Content != "new content" || fmt.Sprint(edited.Tags) != "[cats work]" {
+		t.Errorf("EditQuote returned %+v", edited)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT content, context FROM Quotes WHERE quoteID=\\? AND chatID=\\? AND isAvailable=true").WithArgs(42, request.ChatID).
+		WillReturnRows(sqlmock.NewRows([]string{"content", "context"}))
+	mock.ExpectRollback()
+
+	_, err = w.EditQuote(context.Background(), EditQuoteRequest{ChatID: 7, QuoteID: 42, Content: "content", QuoteContext: "context"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v when editing an unknown quote, wanted %v", err, ErrNotFound)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
 }
 
 func TestGetQuotes(t *testing.T) {
@@ -229,13 +314,14 @@ func TestGetQuotes(t *testing.T) {
 		DB: db,
 	}
 	request := MultipleSpecifiedQuotesRequest{
+		ChatID:   7,
 		QuoteIDs: []string{"1", "2", "5"},
 	}
 	args := make([]interface{}, len(request.QuoteIDs))
 	for i, quoteId := range request.QuoteIDs {
 		args[i] = quoteId
 	}
-	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes"})
+	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"})
 	for i := 0; i < len(request.QuoteIDs); i++ {
 		u := QuoteResponse{
 			QuoteID:      i,
@@ -246,13 +332,14 @@ func TestGetQuotes(t *testing.T) {
 			DeletedAt:    time.Time{},
 			IsActive:     true,
 			Votes:        1,
+			UpVotes:      1,
 		}
-		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes)
+		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes, u.UpVotes, u.DownVotes, u.DeletedBy, u.ChatID, u.SpeakerID, u.Speaker, nil, nil, nil, nil, nil)
 	}
-	query := "SELECT .*? FROM Quotes LEFT JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true AND Quotes.quoteID IN \\(.*?\\) GROUP BY Quotes.quoteID"
-	mock.ExpectQuery(query).WithArgs(args[0], args[1], args[2]).WillReturnRows(rows)
+	query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=.*? AND Quotes.quoteID IN \\(.*?\\)"
+	mock.ExpectQuery(query).WithArgs(request.ChatID, args[0], args[1], args[2]).WillReturnRows(rows)
 
-	_, err := w.GetQuotes(request)
+	_, err := w.GetQuotes(context.Background(), request)
 	if err != nil {
 		t.Errorf("Error in GetQuotes: %v", err)
 	}
@@ -265,9 +352,10 @@ func TestGetLastQuotes(t *testing.T) {
 		DB: db,
 	}
 	request := MultipleUnspecifiedQuotesRequest{
+		ChatID:  7,
 		QuoteNb: 5,
 	}
-	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes"})
+	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"})
 	for i := 0; i < request.QuoteNb; i++ {
 		u := QuoteResponse{
 			QuoteID:      i,
@@ -278,14 +366,15 @@ func TestGetLastQuotes(t *testing.T) {
 			DeletedAt:    time.Time{},
 			IsActive:     true,
 			Votes:        1,
+			UpVotes:      1,
 		}
-		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes)
+		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes, u.UpVotes, u.DownVotes, u.DeletedBy, u.ChatID, u.SpeakerID, u.Speaker, nil, nil, nil, nil, nil)
 	}
 
-	query := "SELECT .*? FROM Quotes LEFT OUTER JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID ORDER BY Quotes.quoteID DESC LIMIT .*? "
-	mock.ExpectQuery(query).WithArgs(request.QuoteNb).WillReturnRows(rows)
+	query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=.*? ORDER BY Quotes.quoteID DESC LIMIT .*? "
+	mock.ExpectQuery(query).WithArgs(request.ChatID, request.QuoteNb, request.Offset).WillReturnRows(rows)
 
-	_, err := w.GetLastQuotes(request)
+	_, err := w.GetLastQuotes(context.Background(), request)
 	if err != nil {
 		t.Errorf("Error in GetLastQuotes: %v", err)
 	}
@@ -298,9 +387,10 @@ func TestGetRandomQuotes(t *testing.T) {
 		DB: db,
 	}
 	request := MultipleUnspecifiedQuotesRequest{
+		ChatID:  7,
 		QuoteNb: 5,
 	}
-	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes"})
+	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"})
 	for i := 0; i < request.QuoteNb; i++ {
 		u := QuoteResponse{
 			QuoteID:      i,
@@ -311,14 +401,15 @@ func TestGetRandomQuotes(t *testing.T) {
 			DeletedAt:    time.Time{},
 			IsActive:     true,
 			Votes:        1,
+			UpVotes:      1,
 		}
-		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes)
+		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes, u.UpVotes, u.DownVotes, u.DeletedBy, u.ChatID, u.SpeakerID, u.Speaker, nil, nil, nil, nil, nil)
 	}
 
-	query := "SELECT .*? FROM Quotes LEFT JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID ORDER BY RANDOM\\(\\) LIMIT .*? "
-	mock.ExpectQuery(query).WithArgs(request.QuoteNb).WillReturnRows(rows)
+	query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=.*? ORDER BY RANDOM\\(\\) LIMIT .*? "
+	mock.ExpectQuery(query).WithArgs(request.ChatID, request.QuoteNb, request.Offset).WillReturnRows(rows)
 
-	_, err := w.GetRandomQuotes(request)
+	_, err := w.GetRandomQuotes(context.Background(), request)
 	if err != nil {
 		t.Errorf("Error in GetRandomQuotes: %v", err)
 	}
@@ -331,9 +422,10 @@ func TestGetTopQuotes(t *testing.T) {
 		DB: db,
 	}
 	request := MultipleUnspecifiedQuotesRequest{
+		ChatID:  7,
 		QuoteNb: 5,
 	}
-	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes"})
+	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"})
 	for i := 0; i < request.QuoteNb; i++ {
 		u := QuoteResponse{
 			QuoteID:      i,
@@ -344,15 +436,16 @@ func TestGetTopQuotes(t *testing.T) {
 			DeletedAt:    time.Time{},
 			IsActive:     true,
 			Votes:        1,
+			UpVotes:      1,
 		}
-		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes)
+		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes, u.UpVotes, u.DownVotes, u.DeletedBy, u.ChatID, u.SpeakerID, u.Speaker, nil, nil, nil, nil, nil)
 	}
 
-	query := "SELECT .*? FROM Quotes JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID HAVING SUM\\(Votes.value\\) >= 0 ORDER BY SUM\\(Votes.value\\) DESC LIMIT .*? "
+	query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=.*? AND Quotes.score >= 0 AND Quotes.upvotes \\+ Quotes.downvotes > 0 ORDER BY Quotes.score DESC, Quotes.quoteID LIMIT .*? "
 
-	mock.ExpectQuery(query).WithArgs(request.QuoteNb).WillReturnRows(rows)
+	mock.ExpectQuery(query).WithArgs(request.ChatID, request.QuoteNb, request.Offset).WillReturnRows(rows)
 
-	_, err := w.GetTopQuotes(request)
+	_, err := w.GetTopQuotes(context.Background(), request)
 	if err != nil {
 		t.Errorf("Error in GetTopQuotes: %v", err)
 	}
@@ -365,9 +458,10 @@ func TestGetFlopQuotes(t *testing.T) {
 		DB: db,
 	}
 	request := MultipleUnspecifiedQuotesRequest{
+		ChatID:  7,
 		QuoteNb: 5,
 	}
-	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes"})
+	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"})
 	for i := 0; i < request.QuoteNb; i++ {
 		u := QuoteResponse{
 			QuoteID:      i,
@@ -378,19 +472,52 @@ func TestGetFlopQuotes(t *testing.T) {
 			DeletedAt:    time.Time{},
 			IsActive:     true,
 			Votes:        1,
+			UpVotes:      1,
 		}
-		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes)
+		rows = rows.AddRow(u.QuoteID, u.Content, u.QuoteContext, u.Author, u.CreatedAt, u.DeletedAt, u.IsActive, u.Votes, u.UpVotes, u.DownVotes, u.DeletedBy, u.ChatID, u.SpeakerID, u.Speaker, nil, nil, nil, nil, nil)
 	}
 
-	query := "SELECT .*? FROM Quotes JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID HAVING SUM\\(Votes.value\\) <= 0 ORDER BY SUM\\(Votes.value\\) ASC LIMIT .*? "
-	mock.ExpectQuery(query).WithArgs(request.QuoteNb).WillReturnRows(rows)
+	query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=.*? AND Quotes.score <= 0 AND Quotes.upvotes \\+ Quotes.downvotes > 0 ORDER BY Quotes.score ASC, Quotes.quoteID LIMIT .*? "
+	mock.ExpectQuery(query).WithArgs(request.ChatID, request.QuoteNb, request.Offset).WillReturnRows(rows)
 
-	_, err := w.GetFlopQuotes(request)
+	_, err := w.GetFlopQuotes(context.Background(), request)
 	if err != nil {
 		t.Errorf("Error in GetFlopQuotes: %v", err)
 	}
 }
 
+func TestGetQuotesByTag(t *testing.T) {
+	db, mock := NewMock()
+	defer db.Close()
+	w := SqliteWrapper{
+		DB: db,
+	}
+	request := MultipleUnspecifiedQuotesRequest{
+		ChatID:  7,
+		QuoteNb: 5,
+		Filter:  QuoteFilter{Tag: "#Work"},
+	}
+	rows := sqlmock.NewRows([]string{"quoteID", "content", "context", "author", "CreatedAt", "DeletedAt", "IsActive", "Votes", "UpVotes", "DownVotes", "DeletedBy", "ChatID", "SpeakerID", "Speaker", "Tags", "SaidAt", "MessageID", "MediaType", "FileID"}).
+		AddRow(101, "b", "c", "a", time.Time{}, time.Time{}, true, 0, 0, 0, nil, request.ChatID, nil, nil, "work", nil, nil, nil, nil)
+
+	query := "SELECT .*? FROM Quotes WHERE Quotes.isAvailable=true AND Quotes.chatID=\\? AND Quotes.quoteID IN \\(SELECT quoteID FROM QuoteTags WHERE tag=\\?\\) ORDER BY RANDOM\\(\\) LIMIT \\? "
+	mock.ExpectQuery(query).WithArgs(request.ChatID, "work", request.QuoteNb, request.Offset).WillReturnRows(rows)
+
+	quotes, err := w.GetRandomQuotes(context.Background(), request)
+	if err != nil {
+		t.Errorf("Error in GetRandomQuotes: %v", err)
+	}
+	if len(quotes) != 1 || fmt.Sprint(quotes[0].Tags) != "[work]" {
+		t.Errorf("GetRandomQuotes returned %+v", quotes)
+	}
+
+	request.Filter.Tag = "42"
+	_, err = w.GetRandomQuotes(context.Background(), request)
+	if !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("got %v instead of %v", err, ErrInvalidTag)
+	}
+}
+
 func TestUnVoteQuote(t *testing.T) {
 	db, mock := NewMock()
 	defer db.Close()
@@ -400,18 +527,30 @@ func TestUnVoteQuote(t *testing.T) {
 
 	for i := 0; i < 10; i++ {
 		quote := VoteQuoteRequest{
+			ChatID:  7,
 			QuoteID: rand.Intn(10),
 			Voter:   0,
 		}
-		query := "DELETE FROM Votes WHERE quoteID=.*? AND voter=.*?"
+		query := "SELECT COUNT\\(\\*\\) FROM Quotes WHERE quoteID=.*? AND chatID=.*? AND isAvailable=true"
+		mock.ExpectQuery(query).WithArgs(quote.QuoteID, quote.ChatID).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		query = "DELETE FROM Votes WHERE quoteID=.*? AND voter=.*?"
 		prep := mock.ExpectPrepare(query)
 		prep.ExpectExec().WithArgs(quote.QuoteID, quote.Voter).WillReturnResult(sqlmock.NewResult(0, 1))
 
-		err := w.UnVoteQuote(quote)
+		err := w.UnVoteQuote(context.Background(), quote)
 		if err != nil {
 			t.Errorf("Error in UnVote: %v", err)
 		}
 	}
+
+	query := "SELECT COUNT\\(\\*\\) FROM Quotes WHERE quoteID=.*? AND chatID=.*? AND isAvailable=true"
+	mock.ExpectQuery(query).WithArgs(42, 7).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	err := w.UnVoteQuote(context.Background(), VoteQuoteRequest{ChatID: 7, QuoteID: 42})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v when voting for an unknown quote, wanted %v", err, ErrNotFound)
+	}
 }
 
 func TestUpVoteQuote(t *testing.T) {
@@ -423,19 +562,16 @@ func TestUpVoteQuote(t *testing.T) {
 
 	for i := 0; i < 1; i++ {
 		quote := VoteQuoteRequest{
+			ChatID:  7,
 			QuoteID: rand.Intn(10),
 			Voter:   0,
 		}
 
-		query := "DELETE FROM Votes WHERE quoteID=.*? AND voter=.*?"
+		query := "INSERT INTO Votes \\(quoteID, chatID, voter, value\\) SELECT quoteID, chatID, .*?, .*? FROM Quotes WHERE quoteID=.*? AND chatID=.*? AND isAvailable=true ON CONFLICT \\(quoteID, voter\\) DO UPDATE SET value=excluded.value"
 		prep := mock.ExpectPrepare(query)
-		prep.ExpectExec().WithArgs(quote.QuoteID, quote.Voter).WillReturnResult(sqlmock.NewResult(0, 1))
-
-		query = "INSERT INTO Votes \\(quoteID, voter, value\\) VALUES \\(.*?,.*?,1\\)"
-		prep = mock.ExpectPrepare(query)
-		prep.ExpectExec().WithArgs(quote.QuoteID, quote.Voter).WillReturnResult(sqlmock.NewResult(0, 1))
+		prep.ExpectExec().WithArgs(quote.Voter, 1, quote.QuoteID, quote.ChatID).WillReturnResult(sqlmock.NewResult(0, 1))
 
-		err := w.UpVoteQuote(quote)
+		err := w.UpVoteQuote(context.Background(), quote)
 		if err != nil {
 			t.Errorf("Error in UpVote: %v", err)
 		}
@@ -451,19 +587,16 @@ func TestDownVoteQuote(t *testing.T) {
 
 	for i := 0; i < 1; i++ {
 		quote := VoteQuoteRequest{
+			ChatID:  7,
 			QuoteID: rand.Intn(10),
 			Voter:   0,
 		}
 
-		query := "DELETE FROM Votes WHERE quoteID=.*? AND voter=.*?"
+		query := "INSERT INTO Votes \\(quoteID, chatID, voter, value\\) SELECT quoteID, chatID, .*?, .*? FROM Quotes WHERE quoteID=.*? AND chatID=.*? AND isAvailable=true ON CONFLICT \\(quoteID, voter\\) DO UPDATE SET value=excluded.value"
 		prep := mock.ExpectPrepare(query)
-		prep.ExpectExec().WithArgs(quote.QuoteID, quote.Voter).WillReturnResult(sqlmock.NewResult(0, 1))
-
-		query = "INSERT INTO Votes \\(quoteID, voter, value\\) VALUES \\(.*?,.*?,-1\\)"
-		prep = mock.ExpectPrepare(query)
-		prep.ExpectExec().WithArgs(quote.QuoteID, quote.Voter).WillReturnResult(sqlmock.NewResult(0, 1))
+		prep.ExpectExec().WithArgs(quote.Voter, -1, quote.QuoteID, quote.ChatID).WillReturnResult(sqlmock.NewResult(0, 1))
 
-		err := w.DownVoteQuote(quote)
+		err := w.DownVoteQuote(context.Background(), quote)
 		if err != nil {
 			t.Errorf("Error in UpVote: %v", err)
 		}
@@ -496,3 +629,198 @@ func TestCheckContext(t *testing.T) {
 		}
 	}
 }
+
+func TestSqliteConfigDSN(t *testing.T) {
+	samples := []struct {
+		Input    SqliteConfig
+		Expected string
+	}{
+		{
+			Input:    SqliteConfig{Path: "/data/quotes.db"},
+			Expected: "file:/data/quotes.db?_busy_timeout=5000&_foreign_keys=on&_journal_mode=WAL&_synchronous=NORMAL",
+		}, {
+			Input:    SqliteConfig{Path: "quotes.db", JournalMode: "DELETE", BusyTimeout: 200 * time.Millisecond, Synchronous: "FULL"},
+			Expected: "file:quotes.db?_busy_timeout=200&_foreign_keys=on&_journal_mode=DELETE&_synchronous=FULL",
+		}, {
+			Input:    SqliteConfig{Path: "/data/why?#100%.db"},
+			Expected: "file:/data/why%3F%23100%25.db?_busy_timeout=5000&_foreign_keys=on&_journal_mode=WAL&_synchronous=NORMAL",
+		},
+	}
+
+	for _, sample := range samples {
+		dsn := sample.Input.DSN()
+		if dsn != sample.Expected {
+			t.Errorf("got %q, wanted %q", dsn, sample.Expected)
+		}
+	}
+}
+
+func TestOpenSqlite(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenSqlite(SqliteConfig{Path: filepath.Join(dir, "nested", "folder", "quotes.db")})
+	if err != nil {
+		skipWithoutFullText(t, err)
+		t.Fatalf("error %v should not have occured", err)
+	}
+	defer db.Close()
+
+	var journalMode string
+	var foreignKeys, busyTimeout int
+	err = db.QueryRow("PRAGMA journal_mode").Scan(&journalMode)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if journalMode != "wal" || foreignKeys != 1 || busyTimeout != 5000 {
+		t.Errorf("got journal_mode=%s foreign_keys=%d busy_timeout=%d", journalMode, foreignKeys, busyTimeout)
+	}
+
+	// The characters of URIs open the file named with them, with the pragmas
+	path := filepath.Join(dir, "why?#100%.db")
+	uri, err := OpenSqlite(SqliteConfig{Path: path})
+	if err != nil {
+		skipWithoutFullText(t, err)
+		t.Fatalf("error %v should not have occured", err)
+	}
+	defer uri.Close()
+	err = uri.QueryRow("PRAGMA journal_mode").Scan(&journalMode)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if journalMode != "wal" {
+		t.Errorf("got journal_mode=%s for %q", journalMode, path)
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Errorf("error %v should not have occured", err)
+	}
+
+	// A file cannot be used as a folder
+	_, err = OpenSqlite(SqliteConfig{Path: filepath.Join(dir, "nested", "folder", "quotes.db", "quotes.db")})
+	if err == nil {
+		t.Errorf("an error should have occured")
+	}
+
+	_, err = OpenSqlite(SqliteConfig{})
+	if err == nil {
+		t.Errorf("an error should have occured")
+	}
+}
+
+// Queries used before the vote counts were kept on Quotes, they aggregate Votes on every read
+var aggregatedVotesQueries = map[string]string{
+	"Last":   "SELECT Quotes.quoteID, SUM(Votes.value) FROM Quotes LEFT JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID ORDER BY Quotes.quoteID DESC LIMIT 10",
+	"Random": "SELECT Quotes.quoteID, SUM(Votes.value) FROM Quotes LEFT JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID ORDER BY RANDOM() LIMIT 10",
+	"Top":    "SELECT Quotes.quoteID, SUM(Votes.value) FROM Quotes JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID HAVING SUM(Votes.value) >= 0 ORDER BY SUM(Votes.value) DESC LIMIT 10",
+	"Flop":   "SELECT Quotes.quoteID, SUM(Votes.value) FROM Quotes JOIN Votes ON Quotes.quoteID = Votes.quoteID WHERE Quotes.isAvailable=true GROUP BY Quotes.quoteID HAVING SUM(Votes.value) <= 0 ORDER BY SUM(Votes.value) ASC LIMIT 10",
+}
+
+// BenchmarkRankings compares reading the kept vote counts with aggregating
+// Votes, on a 100k quotes corpus: go test -run XXX -bench Rankings ./pkg/storages
+func BenchmarkRankings(b *testing.B) {
+	ctx := context.Background()
+	db, err := NewSqliteWrapper(SqliteConfig{Path: filepath.Join(b.TempDir(), "quotes.db")})
+	if err != nil {
+		skipWithoutFullText(b, err)
+		b.Fatalf("error %v should not have occured", err)
+	}
+	defer db.Close()
+	w := db.(*SqliteWrapper)
+
+	tx, err := w.DB.Begin()
+	if err != nil {
+		b.Fatalf("error %v should not have occured", err)
+	}
+	for i := 0; i < 100000; i++ {
+		_, err = tx.Exec("INSERT INTO Quotes (content, context, author, isAvailable) VALUES (?,?,?,?)", fmt.Sprintf("quote number %d", i), "context", "author", i%20 != 0)
+		if err != nil {
+			b.Fatalf("error %v should not have occured", err)
+		}
+		for voter := 0; voter < i%7; voter++ {
+			_, err = tx.Exec("INSERT INTO Votes (quoteID, voter, value) VALUES (?,?,?)", 101+i, voter, 1-2*rand.Intn(2))
+			if err != nil {
+				b.Fatalf("error %v should not have occured", err)
+			}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		b.Fatalf("error %v should not have occured", err)
+	}
+
+	methods := map[string]func(context.Context, MultipleUnspecifiedQuotesRequest) ([]QuoteResponse, error){
+		"Last":   w.GetLastQuotes,
+		"Random": w.GetRandomQuotes,
+		"Top":    w.GetTopQuotes,
+		"Flop":   w.GetFlopQuotes,
+	}
+	for _, name := range []string{"Last", "Random", "Top", "Flop"} {
+		b.Run(name+"/score", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := methods[name](ctx, MultipleUnspecifiedQuotesRequest{QuoteNb: 10})
+				if err != nil {
+					b.Fatalf("error %v should not have occured", err)
+				}
+			}
+		})
+		b.Run(name+"/aggregated", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rows, err := w.DB.QueryContext(ctx, aggregatedVotesQueries[name])
+				if err != nil {
+					b.Fatalf("error %v should not have occured", err)
+				}
+				for rows.Next() {
+				}
+				rows.Close()
+			}
+		})
+	}
+}
+
+func TestSqliteFullText(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSqliteWrapper(SqliteConfig{Path: filepath.Join(t.TempDir(), "quotes.db")})
+	if err != nil {
+		skipWithoutFullText(t, err)
+		t.Fatalf("error %v should not have occured", err)
+	}
+	defer db.Close()
+	w := db.(*SqliteWrapper)
+
+	added, err := db.AddQuote(ctx, AddQuoteRequest{Author: "alice", Content: "Le café est prêt", QuoteContext: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	search := func(db DB, expression string) []int {
+		t.Helper()
+		quotes, err := db.SearchWord(ctx, SearchExpressionRequest{Expression: expression, QuoteNb: 5})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		return quoteIDs(quotes)
+	}
+
+	// Diacritics are folded
+	if got := search(db, "cafe pret"); !equalIDs(got, []int{added.QuoteID}) {
+		t.Errorf("got %v, wanted %v", got, []int{added.QuoteID})
+	}
+
+	// Edits are indexed by the triggers
+	_, err = w.DB.Exec("UPDATE Quotes SET content='Le thé est prêt' WHERE quoteID=?", added.QuoteID)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if got := search(db, "cafe"); len(got) != 0 {
+		t.Errorf("got %v, the old content should not match", got)
+	}
+	if got := search(db, "the"); !equalIDs(got, []int{added.QuoteID}) {
+		t.Errorf("got %v, wanted %v", got, []int{added.QuoteID})
+	}
+}
@@ -0,0 +1,156 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTagLength is the length of the longest tag, in runes
+const maxTagLength = 32
+
+var (
+	regexTag       = regexp.MustCompile(`^[\p{L}\p{N}-]+$`)
+	regexTagLetter = regexp.MustCompile(`\p{L}`)
+)
+
+// tagQueries are the statements behind the tags, SQLite and PostgreSQL share
+// the logic but not the placeholders
+type tagQueries struct {
+	// available counts the available quotes (quoteID, chatID)
+	available string
+	// add files the tag (quoteID, tag), a tag the quote already has is left as is
+	add string
+	// remove takes the tag (quoteID, tag) off the quote
+	remove string
+	// list returns the tags of the available quotes of (chatID) with their
+	// number of quotes, the most used first
+	list string
+}
+
+var sqliteTagQueries = tagQueries{
+	available: "SELECT COUNT(*) FROM Quotes WHERE quoteID=? AND chatID=? AND isAvailable=true",
+	add:       "INSERT INTO QuoteTags (quoteID, tag) VALUES (?,?) ON CONFLICT DO NOTHING",
+	remove:    "DELETE FROM QuoteTags WHERE quoteID=? AND tag=?",
+	list:      "SELECT QuoteTags.tag, COUNT(*) AS quotes FROM QuoteTags JOIN Quotes ON Quotes.quoteID = QuoteTags.quoteID WHERE Quotes.chatID=? AND Quotes.isAvailable=true GROUP BY QuoteTags.tag ORDER BY quotes DESC, QuoteTags.tag",
+}
+
+var postgresTagQueries = tagQueries{
+	available: "SELECT COUNT(*) FROM Quotes WHERE quoteID=$1 AND chatID=$2 AND isAvailable=true",
+	add:       "INSERT INTO QuoteTags (quoteID, tag) VALUES ($1,$2) ON CONFLICT DO NOTHING",
+	remove:    "DELETE FROM QuoteTags WHERE quoteID=$1 AND tag=$2",
+	list:      "SELECT QuoteTags.tag, COUNT(*) AS quotes FROM QuoteTags JOIN Quotes ON Quotes.quoteID = QuoteTags.quoteID WHERE Quotes.chatID=$1 AND Quotes.isAvailable=true GROUP BY QuoteTags.tag ORDER BY quotes DESC, QuoteTags.tag",
+}
+
+// tagName is the name a tag is stored with, "#Work" being "work". Tags are
+// made of letters, digits and dashes with at least one letter, so that they
+// cannot be mistaken for quote IDs, ErrInvalidTag is returned otherwise.
+func tagName(tag string) (string, error) {
+	name := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if !regexTag.MatchString(name) || !regexTagLetter.MatchString(name) || utf8.RuneCountInString(name) > maxTagLength {
+		return "", ErrInvalidTag
+	}
+	return name, nil
+}
+
+// tagNames returns the names of the tags without duplicates, in order
+func tagNames(tags []string) ([]string, error) {
+	names := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		name, err := tagName(tag)
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// splitTags reads the tags of a quote, aggregated by the backends as a comma
+// separated list in no particular order
+func splitTags(tags sql.NullString) []string {
+	if tags.String == "" {
+		return nil
+	}
+	names := strings.Split(tags.String, ",")
+	sort.Strings(names)
+	return names
+}
+
+// addTags files the tags on the quote
+func addTags(ctx context.Context, db querier, q tagQueries, quoteID int, tags []string) error {
+	for _, tag := range tags {
+		_, err := db.ExecContext(ctx, q.add, quoteID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagQuote files and takes off the tags of the request in one transaction
+func tagQuote(ctx context.Context, db *sql.DB, q tagQueries, request TagQuoteRequest) error {
+	add, err := tagNames(request.Add)
+	if err != nil {
+		return err
+	}
+	remove, err := tagNames(request.Remove)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, q.available, request.QuoteID, request.ChatID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	err = addTags(ctx, tx, q, request.QuoteID, add)
+	if err != nil {
+		return err
+	}
+	for _, tag := range remove {
+		_, err = tx.ExecContext(ctx, q.remove, request.QuoteID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// getTags returns the tags of the group with their number of available quotes
+func getTags(ctx context.Context, db querier, q tagQueries, chatID int64) ([]TagResponse, error) {
+	results, err := db.QueryContext(ctx, q.list, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var tags []TagResponse
+	for results.Next() {
+		var tag TagResponse
+		err = results.Scan(&tag.Tag, &tag.Quotes)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, results.Err()
+}
@@ -2,40 +2,234 @@ package storages
 
 import "time"
 
+// AddQuoteRequest adds a quote, a Content made of "Speaker: words" lines being
+// a dialogue, see ParseDialogue
 type AddQuoteRequest struct {
+	ChatID       int64
 	Author       string
 	Content      string
 	QuoteContext string
+	// Tags are filed on the quote, "#Work" and "work" being the same tag
+	Tags []string
+	// Force adds the quote even if it is similar to stored ones, as long as none is identical
+	Force bool
+	// SaidAt and MessageID are the date and the ID of the Telegram message the
+	// quote was taken from, zero when typed in by hand
+	SaidAt    time.Time
+	MessageID int
+	// TelegramIDs are the Telegram users of the speakers named by the context
+	// or the lines of a dialogue, by name, linked to the matching speakers
+	TelegramIDs map[string]int64
+	// Media is the photo, voice note, video or sticker quoted, Content being
+	// its caption. It is zero for the text quotes.
+	Media Media
+
+	// checked is set by IndexedDB once it has looked for duplicates
+	checked bool
+}
+
+type EditQuoteRequest struct {
+	ChatID       int64
+	QuoteID      int
+	Content      string
+	QuoteContext string
+	Editor       string
+}
+
+type RollbackQuoteRequest struct {
+	ChatID   int64
+	QuoteID  int
+	Revision int
+	Editor   string
 }
 
 type MultipleUnspecifiedQuotesRequest struct {
+	ChatID  int64
 	QuoteNb int
+	// Offset skips the first quotes of the listing, to page through it
+	Offset int
+	Filter QuoteFilter
+}
+
+// QuoteFilter narrows a listing down, the zero value keeps every quote
+type QuoteFilter struct {
+	// Tag keeps the quotes with the tag
+	Tag string
 }
 type QuoteResponse struct {
-	QuoteID      int
+	QuoteID int
+	// ChatID is the Telegram group of the quote, the requests only reach the
+	// quotes of their ChatID
+	ChatID       int64
 	Author       string
 	Content      string
 	QuoteContext string
 	CreatedAt    time.Time
 	DeletedAt    time.Time
-	IsActive     bool
-	Votes        int
+	// DeletedBy is the user who moved the quote to the trash
+	DeletedBy string
+	// SpeakerID and Speaker are the speaker matched from QuoteContext, 0 and
+	// empty for quotes without context
+	SpeakerID int
+	Speaker   string
+	// Tags are the tags of the quote, sorted
+	Tags []string
+	// Lines are the lines of a dialogue, in order, whose Content holds them
+	// as text. They are empty for the other quotes.
+	Lines []QuoteLine
+	// SaidAt and MessageID are the date and the ID of the Telegram message the
+	// quote was taken from, zero when typed in by hand
+	SaidAt    time.Time
+	MessageID int
+	// Media is the photo, voice note, video or sticker quoted, Content being
+	// its caption. It is zero for the text quotes.
+	Media    Media
+	IsActive bool
+	// Votes is the score of the quote, UpVotes - DownVotes
+	Votes     int
+	UpVotes   int
+	DownVotes int
+}
+
+// QuoteLine is a line of a dialogue and its speaker
+type QuoteLine struct {
+	// SpeakerID and Speaker are the speaker matched from the name the line
+	// was written with, Speaker being the canonical name
+	SpeakerID int
+	Speaker   string
+	Content   string
+}
+
+// MediaType is the kind of Telegram file a media quote is
+type MediaType string
+
+const (
+	MediaPhoto   MediaType = "photo"
+	MediaVoice   MediaType = "voice"
+	MediaVideo   MediaType = "video"
+	MediaSticker MediaType = "sticker"
+)
+
+// Media is the Telegram file of a media quote, sent again with its FileID
+type Media struct {
+	Type   MediaType
+	FileID string
+}
+
+// IsZero reports whether the quote has no media
+func (m Media) IsZero() bool {
+	return m.Type == "" && m.FileID == ""
 }
 
 type MultipleSpecifiedQuotesRequest struct {
+	ChatID   int64
 	QuoteIDs []string
 }
 
 type UniqueSpecifiedQuoteRequest struct {
+	ChatID  int64
+	QuoteID int
+}
+
+type DeleteQuoteRequest struct {
+	ChatID  int64
 	QuoteID int
+	Deleter string
+}
+
+// TrashRequest lists the trash from the most recently deleted quote
+type TrashRequest struct {
+	ChatID  int64
+	QuoteNb int
+	Offset  int
+}
+
+// TagQuoteRequest files the tags of Add on the quote and takes the ones of
+// Remove off, in this order
+type TagQuoteRequest struct {
+	ChatID  int64
+	QuoteID int
+	Add     []string
+	Remove  []string
+}
+
+// TagResponse is a tag of a group with its number of available quotes
+type TagResponse struct {
+	Tag    string
+	Quotes int
+}
+
+// AddPostRequest records a message the bot posted quotes of the group in, to
+// edit it when their votes change
+type AddPostRequest struct {
+	ChatID int64
+	// PostChatID and MessageID are the Telegram message of the post, in a
+	// group or in the DM of a user
+	PostChatID int64
+	MessageID  int
+	// QuoteIDs are the quotes of the post, in order
+	QuoteIDs []int
+	// Caption is set when the post is the caption of a media quote
+	Caption bool
+}
+
+// PostResponse is a message the bot posted quotes in
+type PostResponse struct {
+	PostChatID int64
+	MessageID  int
+	QuoteIDs   []int
+	Caption    bool
 }
 
 type VoteQuoteRequest struct {
+	ChatID  int64
 	QuoteID int
 	Voter   int64
 }
 
 type SearchExpressionRequest struct {
+	ChatID     int64
 	Expression string
 	QuoteNb    int
+	// Offset skips the first results, to page through them
+	Offset int
+}
+
+type RevisionResponse struct {
+	QuoteID      int
+	Revision     int
+	Content      string
+	QuoteContext string
+	Editor       string
+	EditedAt     time.Time
+	// Diff is the word diff from the previous revision, empty for the first one
+	Diff string
+}
+
+// SpeakerResponse is a person quotes are attributed to, in a group
+type SpeakerResponse struct {
+	SpeakerID int
+	ChatID    int64
+	// Name is the canonical name, Aliases the other names matching the speaker
+	Name    string
+	Aliases []string
+	// TelegramID is the linked Telegram user, 0 when unknown
+	TelegramID int64
+	// Quotes is the number of available quotes of the speaker
+	Quotes int
+}
+
+// AliasSpeakerRequest makes Alias match the speaker known as Speaker
+type AliasSpeakerRequest struct {
+	ChatID  int64
+	Alias   string
+	Speaker string
+}
+
+// MergeSpeakersRequest moves the quotes and aliases of From to Into, From
+// becoming one of the aliases
+type MergeSpeakersRequest struct {
+	ChatID int64
+	From   string
+	Into   string
 }
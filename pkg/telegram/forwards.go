@@ -0,0 +1,187 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	c "goquotebot/pkg/storages"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// pendingTTL is how long a forwarded quote waits for its confirmation
+const pendingTTL = time.Hour
+
+var (
+	publishButton = tb.InlineButton{Unique: "publish", Text: "✅ Publish"}
+	// publishAnywayButton publishes a quote refused as a near miss of stored ones
+	publishAnywayButton = tb.InlineButton{Unique: "publishanyway", Text: "✅ Publish anyway"}
+	discardButton       = tb.InlineButton{Unique: "discard", Text: "❌ Discard"}
+)
+
+// pendingQuote is a forwarded quote waiting for the confirmation of the user
+// who forwarded it before being published in the group
+type pendingQuote struct {
+	Request c.AddQuoteRequest
+	Group   *tb.Chat
+	UserID  int64
+	expires time.Time
+}
+
+// pendingQuotes holds the forwarded quotes until they are published, discarded
+// or expired
+type pendingQuotes struct {
+	mu     sync.Mutex
+	quotes map[string]pendingQuote
+}
+
+// add keeps the quote for pendingTTL and returns the token confirming it
+func (p *pendingQuotes) add(quote pendingQuote) (string, error) {
+	random := make([]byte, 8)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.quotes == nil {
+		p.quotes = make(map[string]pendingQuote)
+	}
+	now := time.Now()
+	for key, pending := range p.quotes {
+		if now.After(pending.expires) {
+			delete(p.quotes, key)
+		}
+	}
+	quote.expires = now.Add(pendingTTL)
+	p.quotes[token] = quote
+	return token, nil
+}
+
+// get returns the quote of the token if it is still pending for the user
+func (p *pendingQuotes) get(token string, userID int64) (pendingQuote, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	quote, ok := p.quotes[token]
+	if !ok || quote.UserID != userID || time.Now().After(quote.expires) {
+		return pendingQuote{}, false
+	}
+	return quote, true
+}
+
+// remove forgets the quote of the token
+func (p *pendingQuotes) remove(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.quotes, token)
+}
+
+// confirmMarkup returns the buttons publishing or discarding a pending quote,
+// anyway when it was refused as a near miss
+func confirmMarkup(token string, anyway bool) *tb.ReplyMarkup {
+	publish := publishButton.With(token)
+	if anyway {
+		publish = publishAnywayButton.With(token)
+	}
+	return &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{{*publish, *discardButton.With(token)}}}
+}
+
+// ForwardedQuote starts the quote of a message forwarded to the bot in DM, the
+// user confirms it before it is published in the group
+func (s *Server) ForwardedQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	quote, err := ExtractForward(m)
+	if err != nil {
+		s.sendText(m.Sender, "Cannot add this quote, only text, photos, voice notes, videos and stickers can be quoted")
+		return nil, err
+	}
+	quote.ChatID = groupID(ctx)
+	quote.Author = m.Sender.Username
+
+	token, err := s.pending.add(pendingQuote{Request: quote, Group: groupOf(ctx), UserID: m.Sender.ID})
+	if err != nil {
+		s.Logger.Error("failed to keep a forwarded quote", zap.Error(err), zap.Any("quote", quote))
+		return nil, err
+	}
+	message, err := GenerateConfirmQuoteMessage(groupOf(ctx), quote)
+	if err != nil {
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+		return nil, err
+	}
+	return s.sendText(m.Sender, message, confirmMarkup(token, false))
+}
+
+// PublishQuote adds the pending quote of the button and sends it to the group
+func (s *Server) PublishQuote(ctx context.Context, cb *tb.Callback) (*tb.CallbackResponse, error) {
+	return s.publishQuote(ctx, cb, false)
+}
+
+// PublishQuoteAnyway publishes a pending quote refused as a near miss of stored quotes
+func (s *Server) PublishQuoteAnyway(ctx context.Context, cb *tb.Callback) (*tb.CallbackResponse, error) {
+	return s.publishQuote(ctx, cb, true)
+}
+
+func (s *Server) publishQuote(ctx context.Context, cb *tb.Callback, force bool) (*tb.CallbackResponse, error) {
+	pending, ok := s.pending.get(cb.Data, cb.Sender.ID)
+	if !ok {
+		return &tb.CallbackResponse{Text: "This quote is no longer pending, forward the message again", ShowAlert: true}, nil
+	}
+	quote := pending.Request
+	quote.Force = force
+
+	added, err := (*s.DB).AddQuote(ctx, quote)
+	var duplicate c.ErrProbableDuplicate
+	switch {
+	case errors.Is(err, c.ErrForbiddenContext):
+		s.pending.remove(cb.Data)
+		message, err := GenerateForbiddenContextMessage(quote)
+		if err != nil {
+			s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+			return nil, err
+		}
+		_, err = s.editText(cb.Message, message)
+		return nil, err
+	case errors.As(err, &duplicate):
+		message, err := GenerateDuplicateQuoteMessage(quote, duplicate)
+		if err != nil {
+			s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+			return nil, err
+		}
+		if !duplicate.NearMiss() {
+			s.pending.remove(cb.Data)
+			_, err = s.editText(cb.Message, message)
+			return nil, err
+		}
+		_, err = s.editText(cb.Message, message, confirmMarkup(cb.Data, true))
+		return nil, err
+	case err != nil:
+		s.Logger.Error("failed to add a quote", zap.Error(err), zap.Any("quote", quote))
+		return &tb.CallbackResponse{Text: "Cannot add this quote", ShowAlert: true}, err
+	}
+	s.pending.remove(cb.Data)
+
+	response, err := GenerateNewQuoteMessage(added)
+	if err != nil {
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", added))
+		return nil, err
+	}
+	s.sendQuote(ctx, pending.Group, added, response)
+	_, err = s.editText(cb.Message, response)
+	return nil, err
+}
+
+// DiscardQuote forgets the pending quote of the button
+func (s *Server) DiscardQuote(ctx context.Context, cb *tb.Callback) (*tb.CallbackResponse, error) {
+	if _, ok := s.pending.get(cb.Data, cb.Sender.ID); !ok {
+		return &tb.CallbackResponse{Text: "This quote is no longer pending"}, nil
+	}
+	s.pending.remove(cb.Data)
+	_, err := s.editText(cb.Message, "🗑 Quote discarded 🗑")
+	return nil, err
+}
@@ -0,0 +1,50 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	c "goquotebot/pkg/storages"
+)
+
+func TestPendingQuotes(t *testing.T) {
+	var p pendingQuotes
+	token, err := p.add(pendingQuote{Request: c.AddQuoteRequest{Content: "blabla"}, UserID: 1001})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	other, err := p.add(pendingQuote{Request: c.AddQuoteRequest{Content: "other"}, UserID: 1001})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if token == other {
+		t.Fatalf("got the token %q twice", token)
+	}
+
+	quote, ok := p.get(token, 1001)
+	if !ok || quote.Request.Content != "blabla" {
+		t.Errorf("got %+v, wanted the quote of the token", quote)
+	}
+	// Only the user who forwarded the quote confirms it
+	if _, ok = p.get(token, 1002); ok {
+		t.Errorf("another user got the pending quote")
+	}
+
+	p.remove(token)
+	if _, ok = p.get(token, 1001); ok {
+		t.Errorf("got a removed quote")
+	}
+
+	p.quotes[other] = pendingQuote{UserID: 1001, expires: time.Now().Add(-time.Second)}
+	if _, ok = p.get(other, 1001); ok {
+		t.Errorf("got an expired quote")
+	}
+	// Expired quotes are dropped as new ones come
+	_, err = p.add(pendingQuote{UserID: 1001})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if _, ok = p.quotes[other]; ok {
+		t.Errorf("the expired quote should have been dropped")
+	}
+}
@@ -0,0 +1,226 @@
+package telegram
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var groupButton = tb.InlineButton{Unique: "group"}
+
+// groupKey is the context key of the group a request is scoped to
+type groupKey struct{}
+
+func withGroup(ctx context.Context, group *tb.Chat) context.Context {
+	return context.WithValue(ctx, groupKey{}, group)
+}
+
+// groupOf returns the group the request is scoped to, nil when no middleware resolved it
+func groupOf(ctx context.Context) *tb.Chat {
+	group, _ := ctx.Value(groupKey{}).(*tb.Chat)
+	return group
+}
+
+// groupID returns the ID of the group the request is scoped to, the quotes of
+// each group are stored under its ID
+func groupID(ctx context.Context) int64 {
+	group := groupOf(ctx)
+	if group == nil {
+		return 0
+	}
+	return group.ID
+}
+
+// groupChoices holds the group each user picked with /group for their DMs
+type groupChoices struct {
+	mu      sync.Mutex
+	entries map[int64]int64
+}
+
+// set makes the group the one the DMs of the user go to
+func (g *groupChoices) set(userID, chatID int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.entries == nil {
+		g.entries = make(map[int64]int64)
+	}
+	g.entries[userID] = chatID
+}
+
+// get returns the group the user picked, if any
+func (g *groupChoices) get(userID int64) (int64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	chatID, ok := g.entries[userID]
+	return chatID, ok
+}
+
+// resolveGroup finds the group a message is about and the membership of its
+// sender: the group it was sent in, or in DM the group the sender picked with
+// /group, else the first group they are a member of. The group is nil when
+// the message comes from a group the bot does not serve or when the sender is
+// in none of them.
+func (s *Server) resolveGroup(m *tb.Message) (*tb.Chat, *tb.ChatMember, error) {
+	if m.Chat != nil && m.Chat.Type != tb.ChatPrivate {
+		return s.memberOf(m.Chat.ID, m.Sender)
+	}
+
+	if chatID, ok := s.choices.get(m.Sender.ID); ok {
+		group, member, err := s.memberOf(chatID, m.Sender)
+		if err != nil {
+			s.Logger.Warn("failed to check the status of a user", zap.Error(err), zap.Any("Chat", group), zap.Any("user", m.Sender))
+		} else if group != nil && isAtLeastMember(member) {
+			return group, member, nil
+		}
+	}
+
+	var found *tb.Chat
+	var membership *tb.ChatMember
+	err := s.eachMembership(m.Sender, func(group *tb.Chat, member *tb.ChatMember) bool {
+		if isAtLeastMember(member) {
+			found, membership = group, member
+			return false
+		}
+		return true
+	})
+	return found, membership, err
+}
+
+// eachMembership calls visit with the membership of the user in each group,
+// until it returns false. The groups the membership cannot be checked in are
+// logged and skipped, the bot may have been removed from them: the error is
+// only returned when no group could be checked.
+func (s *Server) eachMembership(user *tb.User, visit func(group *tb.Chat, member *tb.ChatMember) bool) error {
+	var err error
+	checked := false
+	for _, group := range s.Chats {
+		member, memberErr := s.Bot.ChatMemberOf(group, user)
+		if memberErr != nil {
+			s.Logger.Warn("failed to check the status of a user", zap.Error(memberErr), zap.Any("Chat", group), zap.Any("user", user))
+			err = memberErr
+			continue
+		}
+		checked = true
+		if !visit(group, member) {
+			return nil
+		}
+	}
+	if checked {
+		return nil
+	}
+	return err
+}
+
+// memberOf returns the group of the ID and the membership of the user in it,
+// the group is nil when the bot does not serve it
+func (s *Server) memberOf(chatID int64, user *tb.User) (*tb.Chat, *tb.ChatMember, error) {
+	for _, group := range s.Chats {
+		if group.ID == chatID {
+			member, err := s.Bot.ChatMemberOf(group, user)
+			if err != nil {
+				return group, nil, err
+			}
+			return group, member, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// memberGroups returns the groups the user is at least a member of
+func (s *Server) memberGroups(user *tb.User) ([]*tb.Chat, error) {
+	var groups []*tb.Chat
+	err := s.eachMembership(user, func(group *tb.Chat, member *tb.ChatMember) bool {
+		if isAtLeastMember(member) {
+			groups = append(groups, group)
+		}
+		return true
+	})
+	return groups, err
+}
+
+// groupMarkup returns a button picking each group but the current one
+func groupMarkup(groups []*tb.Chat, current *tb.Chat) *tb.ReplyMarkup {
+	markup := &tb.ReplyMarkup{}
+	for _, group := range groups {
+		if group.ID == current.ID {
+			continue
+		}
+		button := groupButton.With(strconv.FormatInt(group.ID, 10))
+		button.Text = group.Title
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []tb.InlineButton{*button})
+	}
+	return markup
+}
+
+// Group names the group the commands of the sender go to and, in private,
+// shows a button picking each other group they are a member of
+func (s *Server) Group(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	group := groupOf(ctx)
+	markup := &tb.ReplyMarkup{}
+	private := m.Chat.Type == tb.ChatPrivate
+	if private {
+		groups, err := s.memberGroups(m.Sender)
+		if err != nil {
+			s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("user", m.Sender))
+			return nil, err
+		}
+		markup = groupMarkup(groups, group)
+	}
+
+	response, err := GenerateGroupMessage(group, private, len(markup.InlineKeyboard) > 0)
+	if err != nil {
+		s.Logger.Error("failed to generate group message", zap.Error(err), zap.Any("group", group))
+		return nil, err
+	}
+	return s.sendText(m.Chat, response, markup)
+}
+
+// GroupButton makes the group of the button the one the DMs of the sender go to
+func (s *Server) GroupButton(ctx context.Context, cb *tb.Callback) (*tb.CallbackResponse, error) {
+	chatID, err := strconv.ParseInt(cb.Data, 10, 64)
+	if err != nil {
+		return &tb.CallbackResponse{Text: "Cannot pick this group"}, err
+	}
+	group, member, err := s.memberOf(chatID, cb.Sender)
+	if err != nil {
+		s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", group), zap.Any("user", cb.Sender))
+		return nil, err
+	}
+	if group == nil || !isAtLeastMember(member) {
+		return &tb.CallbackResponse{Text: "You must be at least a registered member to do this.", ShowAlert: true}, nil
+	}
+	s.choices.set(cb.Sender.ID, group.ID)
+
+	response, err := GenerateGroupMessage(group, true, false)
+	if err != nil {
+		s.Logger.Error("failed to generate group message", zap.Error(err), zap.Any("group", group))
+		return nil, err
+	}
+	_, err = s.editText(cb.Message, response)
+	return &tb.CallbackResponse{Text: "Group picked"}, err
+}
+
+// groupChats returns the groups to serve, the legacy group first
+func groupChats(b *tb.Bot, groupID string, groups []string) ([]*tb.Chat, error) {
+	if groupID != "" {
+		groups = append([]string{groupID}, groups...)
+	}
+
+	chats := make([]*tb.Chat, 0, len(groups))
+	seen := make(map[int64]bool)
+	for _, id := range groups {
+		chat, err := b.ChatByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if seen[chat.ID] {
+			continue
+		}
+		seen[chat.ID] = true
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
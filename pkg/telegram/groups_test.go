@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"testing"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestGroupChoices(t *testing.T) {
+	var choices groupChoices
+	if _, ok := choices.get(42); ok {
+		t.Errorf("got a group for a user who picked none")
+	}
+	choices.set(42, -100)
+	choices.set(42, -200)
+	if chatID, ok := choices.get(42); !ok || chatID != -200 {
+		t.Errorf("got %d, %v, wanted the last group picked", chatID, ok)
+	}
+}
+
+func TestGroupMarkup(t *testing.T) {
+	groups := []*tb.Chat{{ID: -100, Title: "Friends"}, {ID: -200, Title: "Family"}, {ID: -300, Title: "Work"}}
+	markup := groupMarkup(groups, groups[1])
+	var got []string
+	for _, row := range markup.InlineKeyboard {
+		got = append(got, row[0].Text+"="+row[0].Data)
+	}
+	if len(got) != 2 || got[0] != "Friends=-100" || got[1] != "Work=-300" {
+		t.Errorf("got %v, wanted a button for each other group", got)
+	}
+	if markup := groupMarkup(groups[:1], groups[0]); len(markup.InlineKeyboard) != 0 {
+		t.Errorf("got %v, wanted no button for a single group", markup.InlineKeyboard)
+	}
+}
@@ -1,6 +1,7 @@
 package telegram
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	c "goquotebot/pkg/storages"
@@ -9,13 +10,24 @@ import (
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
-func (s *Server) Message(m *tb.Message) (*tb.Message, error) {
+// trashPageSize is the number of deleted quotes listed by /trash
+const trashPageSize = 10
+
+func (s *Server) Message(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	// Keep the message for the replies quoting a thread
+	s.history.record(m)
+
+	// A message forwarded in DM is a quote to confirm
+	if m.Chat != nil && m.Chat.Type == tb.ChatPrivate && m.OriginalUnixtime != 0 {
+		return s.ForwardedQuote(ctx, m)
+	}
+
 	IDs := ExtractQuotesID(m.Text)
 	if len(IDs) == 0 {
 		return nil, errors.New("no id provided")
 	}
 
-	quotes, err := (*s.DB).GetQuotes(c.MultipleSpecifiedQuotesRequest{QuoteIDs: IDs})
+	quotes, err := (*s.DB).GetQuotes(ctx, c.MultipleSpecifiedQuotesRequest{ChatID: groupID(ctx), QuoteIDs: IDs})
 	if err != nil {
 		s.Logger.Error("failed to fetch quotes by ids", zap.Error(err), zap.Strings("IDs", IDs))
 		return nil, err
@@ -25,16 +37,19 @@ func (s *Server) Message(m *tb.Message) (*tb.Message, error) {
 		return nil, nil
 	}
 
-	response, err := GenerateQuotesMessage(quotes)
-	if err != nil {
-		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quotes", quotes))
-		return nil, err
-	}
+	return s.sendQuotes(ctx, m.Chat, quotes)
+}
 
-	return s.Bot.Send(m.Chat, response)
+func (s *Server) AddQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	return s.addQuote(ctx, m, false)
 }
 
-func (s *Server) AddQuote(m *tb.Message) (*tb.Message, error) {
+// AddQuoteAnyway adds a quote that was refused as a near miss of stored quotes
+func (s *Server) AddQuoteAnyway(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	return s.addQuote(ctx, m, true)
+}
+
+func (s *Server) addQuote(ctx context.Context, m *tb.Message, force bool) (*tb.Message, error) {
 	var err error
 	if m.FromGroup() {
 		err = s.Bot.Delete(m)
@@ -43,87 +58,236 @@ func (s *Server) AddQuote(m *tb.Message) (*tb.Message, error) {
 		}
 	}
 
+	quote, err := s.newQuote(m)
+	if err != nil {
+		s.sendText(m.Sender, "Cannot add this quote")
+		return nil, err
+	}
+	quote.ChatID = groupID(ctx)
+	quote.Author = m.Sender.Username
+	quote.Force = force
+
+	added, err := (*s.DB).AddQuote(ctx, quote)
+	var duplicate c.ErrProbableDuplicate
+	switch {
+	case errors.Is(err, c.ErrForbiddenContext):
+		message, err := GenerateForbiddenContextMessage(quote)
+		if err != nil {
+			s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+			return nil, err
+		}
+		return s.sendText(m.Sender, message)
+	case errors.Is(err, c.ErrInvalidTag):
+		message, err := GenerateInvalidTagMessage(quote.Tags)
+		if err != nil {
+			s.Logger.Error("failed to generate tag message", zap.Error(err), zap.Any("quote", quote))
+			return nil, err
+		}
+		return s.sendText(m.Sender, message)
+	case errors.As(err, &duplicate):
+		message, err := GenerateDuplicateQuoteMessage(quote, duplicate)
+		if err != nil {
+			s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+			return nil, err
+		}
+		s.sendText(m.Sender, message)
+		senderChat, _ := s.Bot.ChatByID(fmt.Sprint(m.Sender.ID))
+		return s.Message(ctx, &tb.Message{Sender: m.Sender, Chat: senderChat, Text: message})
+	case err != nil:
+		s.Logger.Error("failed to add a quote", zap.Error(err), zap.Any("quote", quote))
+		return nil, errors.New("cannot add the quote to the DB")
+	}
+
+	response, err := GenerateNewQuoteMessage(added)
+	if err != nil {
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", added))
+		return nil, err
+	}
+
+	// Sent the quote to the group chat
+	s.sendQuote(ctx, groupOf(ctx), added, response)
+
+	return s.sendQuote(ctx, m.Sender, added, response)
+}
+
+// newQuote reads the quote of a /add: typed in as quote | context or as a
+// dialogue, taken from the messages it replies to, or the media it captions
+func (s *Server) newQuote(m *tb.Message) (c.AddQuoteRequest, error) {
+	if media, _ := MessageMedia(m); !media.IsZero() {
+		return ExtractMediaQuote(m)
+	}
 	tmp := ExtractQuote(m.Text)
+	if len(tmp) < 2 && m.ReplyTo != nil {
+		n, err := ExtractReplyCount(m.Text)
+		if err != nil {
+			return c.AddQuoteRequest{}, err
+		}
+		return QuoteMessages(s.history.thread(m.ReplyTo, n))
+	}
+	if len(tmp) < 2 {
+		tmp = ExtractDialogue(m.Text)
+	}
 	if len(tmp) < 2 {
-		s.Bot.Send(m.Sender, "Cannot add this quote")
-		return nil, errors.New("not enough argument provided")
+		return c.AddQuoteRequest{}, errors.New("not enough argument provided")
 	}
 
 	quote := c.AddQuoteRequest{
-		Author:       m.Sender.Username,
 		Content:      tmp[0],
 		QuoteContext: tmp[1],
 	}
+	if len(tmp) > 2 {
+		quote.Tags = ExtractTags(tmp[2])
+	}
+	return quote, nil
+}
 
-	message, err := (*s.DB).AddQuote(quote)
+func (s *Server) RandomQuotes(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	res, tag, err := ExtractNumberAndTag(m.Text)
 	if err != nil {
-		s.Logger.Error("failed to add a quote", zap.Error(err), zap.Any("quote", quote))
-		return nil, errors.New("cannot add the quote to the DB")
+		s.Logger.Error("failed to extract number from command", zap.Error(err), zap.String("text", m.Text))
+		return nil, err
 	}
 
-	if message != "" {
-		s.Bot.Send(m.Sender, message)
-		senderChat, _ := s.Bot.ChatByID(fmt.Sprint(m.Sender.ID))
-		s.Message(&tb.Message{Sender: m.Sender, Chat: senderChat, Text: message})
-		return nil, nil
+	quoteResponses, err := (*s.DB).GetRandomQuotes(ctx, c.MultipleUnspecifiedQuotesRequest{ChatID: groupID(ctx), QuoteNb: res, Filter: c.QuoteFilter{Tag: tag}})
+	if err != nil {
+		s.Logger.Error("failed to get random quotes", zap.Error(err), zap.Int("QuoteNb", res), zap.String("tag", tag))
+		return nil, err
 	}
 
-	response, err := GenerateNewQuoteMessage(quote)
+	return s.sendQuotes(ctx, m.Chat, quoteResponses)
+}
+
+func (s *Server) LastQuotes(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	res, tag, err := ExtractNumberAndTag(m.Text)
 	if err != nil {
-		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+		s.Logger.Error("failed to extract number from command", zap.Error(err), zap.String("text", m.Text))
 		return nil, err
 	}
+	request := c.MultipleUnspecifiedQuotesRequest{ChatID: groupID(ctx), Filter: c.QuoteFilter{Tag: tag}}
 
-	// Sent the quote to the group chat
-	s.Bot.Send(s.Chat, response)
+	return s.sendListing(ctx, m.Chat, res, func(ctx context.Context, offset, n int) ([]c.QuoteResponse, error) {
+		request.Offset, request.QuoteNb = offset, n
+		quoteResponses, err := (*s.DB).GetLastQuotes(ctx, request)
+		if err != nil {
+			s.Logger.Error("failed to get last quotes", zap.Error(err), zap.Int("QuoteNb", res), zap.Int("Offset", offset), zap.String("tag", tag))
+		}
+		return quoteResponses, err
+	})
+}
+
+func (s *Server) DeleteQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
+
+	res, err := ExtractID(m.Text)
+	if err != nil {
+		s.Logger.Error("failed to extract ID from command", zap.Error(err), zap.String("text", m.Text))
+		return nil, err
+	}
 
-	return s.Bot.Send(m.Sender, response)
+	err = (*s.DB).DeleteQuote(ctx, c.DeleteQuoteRequest{ChatID: groupID(ctx), QuoteID: res, Deleter: m.Sender.Username})
+	if errors.Is(err, c.ErrNotFound) {
+		return s.QuoteNotFound(m, res)
+	}
+	if err != nil {
+		s.Logger.Error("failed to delete quote", zap.Error(err), zap.Int("QuoteID", res))
+		return nil, err
+	}
+	s.refreshPosts(ctx, groupID(ctx), res)
+
+	response, err := GenerateDeleteQuoteMessage(c.UniqueSpecifiedQuoteRequest{QuoteID: res})
+	if err != nil {
+		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Int("QuoteID", res))
+		return nil, err
+	}
+
+	return s.sendText(m.Sender, response)
 }
 
-func (s *Server) RandomQuotes(m *tb.Message) (*tb.Message, error) {
-	res, err := ExtractNumber(m.Text)
+// TrashQuotes lists the deleted quotes, the last deleted first, /trash <n>
+// shows the page <n>
+func (s *Server) TrashQuotes(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
+
+	page, err := ExtractNumber(m.Text)
 	if err != nil {
 		s.Logger.Error("failed to extract number from command", zap.Error(err), zap.String("text", m.Text))
 		return nil, err
 	}
+	if page < 1 {
+		page = 1
+	}
 
-	quoteResponses, err := (*s.DB).GetRandomQuotes(c.MultipleUnspecifiedQuotesRequest{QuoteNb: res})
+	// One more quote tells whether there is a next page
+	request := c.TrashRequest{ChatID: groupID(ctx), QuoteNb: trashPageSize + 1, Offset: (page - 1) * trashPageSize}
+	quoteResponses, err := (*s.DB).GetTrash(ctx, request)
 	if err != nil {
-		s.Logger.Error("failed to get random quotes", zap.Error(err), zap.Int("QuoteNb", res))
+		s.Logger.Error("failed to get the trash", zap.Error(err), zap.Any("request", request))
 		return nil, err
 	}
+	next := 0
+	if len(quoteResponses) > trashPageSize {
+		quoteResponses = quoteResponses[:trashPageSize]
+		next = page + 1
+	}
 
-	response, err := GenerateQuotesMessage(quoteResponses)
+	response, err := GenerateTrashMessage(page, quoteResponses, next)
 	if err != nil {
-		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Any("quotes", quoteResponses))
+		s.Logger.Error("failed to generate trash message", zap.Error(err), zap.Any("quotes", quoteResponses))
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Chat, response)
+	return s.sendText(m.Sender, response)
 }
 
-func (s *Server) LastQuotes(m *tb.Message) (*tb.Message, error) {
-	res, err := ExtractNumber(m.Text)
+func (s *Server) RestoreQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
+
+	res, err := ExtractID(m.Text)
 	if err != nil {
-		s.Logger.Error("failed to extract number from command", zap.Error(err), zap.String("text", m.Text))
+		s.Logger.Error("failed to extract ID from command", zap.Error(err), zap.String("text", m.Text))
 		return nil, err
 	}
-	quoteResponses, err := (*s.DB).GetLastQuotes(c.MultipleUnspecifiedQuotesRequest{QuoteNb: res})
+
+	request := c.UniqueSpecifiedQuoteRequest{ChatID: groupID(ctx), QuoteID: res}
+	quote, err := (*s.DB).RestoreQuote(ctx, request)
+	if errors.Is(err, c.ErrNotFound) {
+		return s.TrashNotFound(m, res)
+	}
 	if err != nil {
-		s.Logger.Error("failed to get last quotes", zap.Error(err), zap.Int("QuoteNb", res))
+		s.Logger.Error("failed to restore quote", zap.Error(err), zap.Int("QuoteID", res))
 		return nil, err
 	}
+	s.refreshPosts(ctx, request.ChatID, request.QuoteID)
 
-	response, err := GenerateQuotesMessage(quoteResponses)
+	response, err := GenerateRestoredQuoteMessage(quote)
 	if err != nil {
-		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Any("quotes", quoteResponses))
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Chat, response)
+	return s.sendText(m.Sender, response)
 }
 
-func (s *Server) DeleteQuote(m *tb.Message) (*tb.Message, error) {
+// PurgeQuote deletes a trashed quote and its votes for good
+func (s *Server) PurgeQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
 	var err error
 	if m.FromGroup() {
 		err = s.Bot.Delete(m)
@@ -138,22 +302,159 @@ func (s *Server) DeleteQuote(m *tb.Message) (*tb.Message, error) {
 		return nil, err
 	}
 
-	err = (*s.DB).DeleteQuote(c.UniqueSpecifiedQuoteRequest{QuoteID: res})
+	request := c.UniqueSpecifiedQuoteRequest{ChatID: groupID(ctx), QuoteID: res}
+	err = (*s.DB).PurgeQuote(ctx, request)
+	if errors.Is(err, c.ErrNotFound) {
+		return s.TrashNotFound(m, res)
+	}
 	if err != nil {
-		s.Logger.Error("failed to delete quote", zap.Error(err), zap.Int("QuoteID", res))
+		s.Logger.Error("failed to purge quote", zap.Error(err), zap.Int("QuoteID", res))
 		return nil, err
 	}
 
-	response, err := GenerateDeleteQuoteMessage(c.UniqueSpecifiedQuoteRequest{QuoteID: res})
+	response, err := GeneratePurgedQuoteMessage(request)
 	if err != nil {
-		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Int("QuoteID", res))
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Int("QuoteID", res))
+		return nil, err
+	}
+
+	return s.sendText(m.Sender, response)
+}
+
+// EditQuote replaces the content and context of a quote, it is allowed to the
+// user who added the quote and to the administrators
+func (s *Server) EditQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
+
+	request, err := ExtractEditQuote(m.Text)
+	if err != nil {
+		s.sendText(m.Sender, "Cannot edit this quote, usage : /edit &lt;id&gt; quote | context")
+		return nil, err
+	}
+	request.ChatID = groupID(ctx)
+	request.Editor = m.Sender.Username
+
+	quotes, err := (*s.DB).GetQuotes(ctx, c.MultipleSpecifiedQuotesRequest{ChatID: request.ChatID, QuoteIDs: []string{fmt.Sprint(request.QuoteID)}})
+	if err != nil {
+		s.Logger.Error("failed to fetch quotes by ids", zap.Error(err), zap.Int("QuoteID", request.QuoteID))
+		return nil, err
+	}
+	if len(quotes) == 0 {
+		return s.QuoteNotFound(m, request.QuoteID)
+	}
+
+	isAuthor := m.Sender.Username != "" && quotes[0].Author == m.Sender.Username
+	if !isAuthor {
+		isAdmin, err := s.IsAdministrator(groupOf(ctx), m.Sender)
+		if err != nil {
+			s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", groupOf(ctx)), zap.Any("user", m.Sender))
+			return nil, err
+		}
+		if !isAdmin {
+			s.Logger.Info("unauthorized user tried to edit a quote", zap.Any("user", m.Sender), zap.String("message", m.Text))
+			return s.sendText(m.Sender, "You must have added the quote or be an administrator to edit it.")
+		}
+	}
+
+	edited, err := (*s.DB).EditQuote(ctx, request)
+	switch {
+	case errors.Is(err, c.ErrNotFound):
+		return s.QuoteNotFound(m, request.QuoteID)
+	case errors.Is(err, c.ErrForbiddenContext):
+		message, err := GenerateForbiddenContextMessage(c.AddQuoteRequest{Content: request.Content, QuoteContext: request.QuoteContext})
+		if err != nil {
+			s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("edit", request))
+			return nil, err
+		}
+		return s.sendText(m.Sender, message)
+	case err != nil:
+		s.Logger.Error("failed to edit a quote", zap.Error(err), zap.Any("edit", request))
+		return nil, err
+	}
+
+	response, err := GenerateEditedQuoteMessage(edited)
+	if err != nil {
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", edited))
+		return nil, err
+	}
+
+	return s.sendText(m.Sender, response)
+}
+
+func (s *Server) QuoteHistory(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	res, err := ExtractID(m.Text)
+	if err != nil {
+		s.Logger.Error("failed to extract ID from command", zap.Error(err), zap.String("text", m.Text))
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Sender, response)
+	request := c.UniqueSpecifiedQuoteRequest{ChatID: groupID(ctx), QuoteID: res}
+	revisions, err := (*s.DB).GetRevisions(ctx, request)
+	if errors.Is(err, c.ErrNotFound) {
+		return s.QuoteNotFound(m, res)
+	}
+	if err != nil {
+		s.Logger.Error("failed to get the revisions of a quote", zap.Error(err), zap.Int("QuoteID", res))
+		return nil, err
+	}
+
+	response, err := GenerateHistoryMessage(request, revisions)
+	if err != nil {
+		s.Logger.Error("failed to generate history message", zap.Error(err), zap.Any("revisions", revisions))
+		return nil, err
+	}
+
+	return s.sendText(m.Chat, response)
 }
 
-func (s *Server) UpVote(m *tb.Message) (*tb.Message, error) {
+// RollbackQuote restores a previous revision of a quote
+func (s *Server) RollbackQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
+
+	request, err := ExtractRollback(m.Text)
+	if err != nil {
+		s.Logger.Error("failed to extract ID and revision from command", zap.Error(err), zap.String("text", m.Text))
+		return nil, err
+	}
+	request.ChatID = groupID(ctx)
+	request.Editor = m.Sender.Username
+
+	quote, err := (*s.DB).RollbackQuote(ctx, request)
+	if errors.Is(err, c.ErrNotFound) {
+		response, err := GenerateRevisionNotFoundMessage(request)
+		if err != nil {
+			s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("request", request))
+			return nil, err
+		}
+		return s.sendText(m.Sender, response)
+	}
+	if err != nil {
+		s.Logger.Error("failed to roll back a quote", zap.Error(err), zap.Any("request", request))
+		return nil, err
+	}
+
+	response, err := GenerateEditedQuoteMessage(quote)
+	if err != nil {
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+		return nil, err
+	}
+
+	return s.sendText(m.Sender, response)
+}
+
+func (s *Server) UpVote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
 	var err error
 	if m.FromGroup() {
 		err = s.Bot.Delete(m)
@@ -168,14 +469,19 @@ func (s *Server) UpVote(m *tb.Message) (*tb.Message, error) {
 		return nil, err
 	}
 	request := c.VoteQuoteRequest{
+		ChatID:  groupID(ctx),
 		QuoteID: res,
 		Voter:   m.Sender.ID,
 	}
-	err = (*s.DB).UpVoteQuote(request)
+	err = (*s.DB).UpVoteQuote(ctx, request)
+	if errors.Is(err, c.ErrNotFound) {
+		return s.QuoteNotFound(m, res)
+	}
 	if err != nil {
 		s.Logger.Error("failed to up vote a quote", zap.Error(err), zap.Any("vote quote request", request))
 		return nil, err
 	}
+	s.refreshPosts(ctx, request.ChatID, request.QuoteID)
 
 	response, err := GenerateVoteAddedMessage(request)
 	if err != nil {
@@ -183,10 +489,10 @@ func (s *Server) UpVote(m *tb.Message) (*tb.Message, error) {
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Sender, response)
+	return s.sendText(m.Sender, response)
 }
 
-func (s *Server) DownVote(m *tb.Message) (*tb.Message, error) {
+func (s *Server) DownVote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
 	var err error
 	if m.FromGroup() {
 		err = s.Bot.Delete(m)
@@ -201,14 +507,19 @@ func (s *Server) DownVote(m *tb.Message) (*tb.Message, error) {
 		return nil, err
 	}
 	request := c.VoteQuoteRequest{
+		ChatID:  groupID(ctx),
 		QuoteID: res,
 		Voter:   m.Sender.ID,
 	}
-	err = (*s.DB).DownVoteQuote(request)
+	err = (*s.DB).DownVoteQuote(ctx, request)
+	if errors.Is(err, c.ErrNotFound) {
+		return s.QuoteNotFound(m, res)
+	}
 	if err != nil {
 		s.Logger.Error("failed to down vote a quote", zap.Error(err), zap.Any("vote quote request", request))
 		return nil, err
 	}
+	s.refreshPosts(ctx, request.ChatID, request.QuoteID)
 
 	response, err := GenerateVoteAddedMessage(request)
 	if err != nil {
@@ -216,10 +527,10 @@ func (s *Server) DownVote(m *tb.Message) (*tb.Message, error) {
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Sender, response)
+	return s.sendText(m.Sender, response)
 }
 
-func (s *Server) UnVote(m *tb.Message) (*tb.Message, error) {
+func (s *Server) UnVote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
 	var err error
 	if m.FromGroup() {
 		err = s.Bot.Delete(m)
@@ -234,14 +545,19 @@ func (s *Server) UnVote(m *tb.Message) (*tb.Message, error) {
 		return nil, err
 	}
 	request := c.VoteQuoteRequest{
+		ChatID:  groupID(ctx),
 		QuoteID: res,
 		Voter:   m.Sender.ID,
 	}
-	err = (*s.DB).UnVoteQuote(request)
+	err = (*s.DB).UnVoteQuote(ctx, request)
+	if errors.Is(err, c.ErrNotFound) {
+		return s.QuoteNotFound(m, res)
+	}
 	if err != nil {
 		s.Logger.Error("failed to unvote a quote", zap.Error(err), zap.Any("vote quote request", request))
 		return nil, err
 	}
+	s.refreshPosts(ctx, request.ChatID, request.QuoteID)
 
 	response, err := GenerateVoteRemovedMessage(request)
 	if err != nil {
@@ -249,83 +565,239 @@ func (s *Server) UnVote(m *tb.Message) (*tb.Message, error) {
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Sender, response)
+	return s.sendText(m.Sender, response)
+}
+
+func (s *Server) TopQuotes(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	res, tag, err := ExtractNumberAndTag(m.Text)
+	if err != nil {
+		s.Logger.Error("failed to extract number from command", zap.Error(err), zap.String("text", m.Text))
+		return nil, err
+	}
+	request := c.MultipleUnspecifiedQuotesRequest{ChatID: groupID(ctx), Filter: c.QuoteFilter{Tag: tag}}
+
+	return s.sendListing(ctx, m.Chat, res, func(ctx context.Context, offset, n int) ([]c.QuoteResponse, error) {
+		request.Offset, request.QuoteNb = offset, n
+		quoteResponses, err := (*s.DB).GetTopQuotes(ctx, request)
+		if err != nil {
+			s.Logger.Error("failed to get top ranking", zap.Error(err), zap.Int("QuoteNb", res), zap.Int("Offset", offset), zap.String("tag", tag))
+		}
+		return quoteResponses, err
+	})
 }
 
-func (s *Server) TopQuotes(m *tb.Message) (*tb.Message, error) {
-	res, err := ExtractNumber(m.Text)
+func (s *Server) FlopQuotes(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	res, tag, err := ExtractNumberAndTag(m.Text)
 	if err != nil {
 		s.Logger.Error("failed to extract number from command", zap.Error(err), zap.String("text", m.Text))
 		return nil, err
 	}
-	quoteResponses, err := (*s.DB).GetTopQuotes(c.MultipleUnspecifiedQuotesRequest{QuoteNb: res})
+	request := c.MultipleUnspecifiedQuotesRequest{ChatID: groupID(ctx), Filter: c.QuoteFilter{Tag: tag}}
+
+	return s.sendListing(ctx, m.Chat, res, func(ctx context.Context, offset, n int) ([]c.QuoteResponse, error) {
+		request.Offset, request.QuoteNb = offset, n
+		quoteResponses, err := (*s.DB).GetFlopQuotes(ctx, request)
+		if err != nil {
+			s.Logger.Error("failed to get flop ranking", zap.Error(err), zap.Int("QuoteNb", res), zap.Int("Offset", offset), zap.String("tag", tag))
+		}
+		return quoteResponses, err
+	})
+}
+
+func (s *Server) SearchQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	res := ExtractExpressionAndNumber(m.Text)
+	res.ChatID = groupID(ctx)
+
+	return s.sendListing(ctx, m.Chat, res.QuoteNb, func(ctx context.Context, offset, n int) ([]c.QuoteResponse, error) {
+		request := res
+		request.Offset, request.QuoteNb = offset, n
+		quoteResponses, err := (*s.DB).SearchExpression(ctx, request)
+		if err != nil {
+			s.Logger.Error("failed to search expression", zap.Error(err), zap.Any("request", request))
+		}
+		return quoteResponses, err
+	})
+}
+
+func (s *Server) SearchWordQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	res := ExtractExpressionAndNumber(m.Text)
+	res.ChatID = groupID(ctx)
+
+	return s.sendListing(ctx, m.Chat, res.QuoteNb, func(ctx context.Context, offset, n int) ([]c.QuoteResponse, error) {
+		request := res
+		request.Offset, request.QuoteNb = offset, n
+		quoteResponses, err := (*s.DB).SearchWord(ctx, request)
+		if err != nil {
+			s.Logger.Error("failed to search word", zap.Error(err), zap.Any("QuoteNb", request))
+		}
+		return quoteResponses, err
+	})
+}
+
+// Speakers lists the speakers of the group, the most quoted first
+func (s *Server) Speakers(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	speakers, err := (*s.DB).GetSpeakers(ctx, groupID(ctx))
 	if err != nil {
-		s.Logger.Error("failed to get top ranking", zap.Error(err), zap.Int("QuoteNb", res))
+		s.Logger.Error("failed to get the speakers", zap.Error(err))
 		return nil, err
 	}
 
-	response, err := GenerateQuotesMessage(quoteResponses)
+	response, err := GenerateSpeakersMessage(speakers)
 	if err != nil {
-		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Any("quotes", quoteResponses))
+		s.Logger.Error("failed to generate speakers message", zap.Error(err), zap.Any("speakers", speakers))
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Chat, response)
+	return s.sendText(m.Chat, response)
 }
 
-func (s *Server) FlopQuotes(m *tb.Message) (*tb.Message, error) {
-	res, err := ExtractNumber(m.Text)
+// AliasSpeaker makes a name match an existing speaker, /alias <name> <canonical>
+func (s *Server) AliasSpeaker(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
+
+	alias, name, err := ExtractSpeakers(m.Text)
 	if err != nil {
-		s.Logger.Error("failed to extract number from command", zap.Error(err), zap.String("text", m.Text))
+		s.sendText(m.Sender, "Cannot add this alias, usage : /alias &lt;name&gt; &lt;canonical&gt;")
 		return nil, err
 	}
-	quoteResponses, err := (*s.DB).GetFlopQuotes(c.MultipleUnspecifiedQuotesRequest{QuoteNb: res})
+
+	request := c.AliasSpeakerRequest{ChatID: groupID(ctx), Alias: alias, Speaker: name}
+	speaker, err := (*s.DB).AliasSpeaker(ctx, request)
+	var response string
+	switch {
+	case errors.Is(err, c.ErrSpeakerNotFound):
+		response, err = GenerateSpeakerNotFoundMessage(name)
+	case errors.Is(err, c.ErrAliasTaken):
+		response, err = GenerateAliasTakenMessage(request)
+	case err != nil:
+		s.Logger.Error("failed to alias a speaker", zap.Error(err), zap.Any("request", request))
+		return nil, err
+	default:
+		response, err = GenerateAliasedSpeakerMessage(speaker)
+	}
 	if err != nil {
-		s.Logger.Error("failed to get flop ranking", zap.Error(err), zap.Int("QuoteNb", res))
+		s.Logger.Error("failed to generate speaker message", zap.Error(err), zap.Any("request", request))
 		return nil, err
 	}
 
-	response, err := GenerateQuotesMessage(quoteResponses)
+	return s.sendText(m.Sender, response)
+}
+
+// MergeSpeakers makes one speaker of two, /mergespeakers <from> <into>
+func (s *Server) MergeSpeakers(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
+
+	from, into, err := ExtractSpeakers(m.Text)
 	if err != nil {
-		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Any("quotes", quoteResponses))
+		s.sendText(m.Sender, "Cannot merge these speakers, usage : /mergespeakers &lt;from&gt; &lt;into&gt;")
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Chat, response)
+	request := c.MergeSpeakersRequest{ChatID: groupID(ctx), From: from, Into: into}
+	speaker, err := (*s.DB).MergeSpeakers(ctx, request)
+	var response string
+	switch {
+	case errors.Is(err, c.ErrSpeakerNotFound):
+		response, err = GenerateSpeakerNotFoundMessage(from, into)
+	case err != nil:
+		s.Logger.Error("failed to merge speakers", zap.Error(err), zap.Any("request", request))
+		return nil, err
+	default:
+		response, err = GenerateMergedSpeakersMessage(speaker)
+	}
+	if err != nil {
+		s.Logger.Error("failed to generate speaker message", zap.Error(err), zap.Any("request", request))
+		return nil, err
+	}
+
+	return s.sendText(m.Sender, response)
 }
 
-func (s *Server) SearchQuote(m *tb.Message) (*tb.Message, error) {
-	res := ExtractExpressionAndNumber(m.Text)
+// TagQuote files and removes tags on a quote, /tag <id> +tag -tag
+func (s *Server) TagQuote(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	var err error
+	if m.FromGroup() {
+		err = s.Bot.Delete(m)
+		if err != nil {
+			s.Logger.Error("failed to delete a message", zap.Error(err), zap.Any("message to delete", m))
+		}
+	}
 
-	quoteResponses, err := (*s.DB).SearchExpression(res)
+	request, err := ExtractTagQuote(m.Text)
 	if err != nil {
-		s.Logger.Error("failed to get flop ranking", zap.Error(err), zap.Int("QuoteNb", res.QuoteNb))
+		s.sendText(m.Sender, "Cannot tag this quote, usage : /tag &lt;id&gt; +tag -tag")
 		return nil, err
 	}
-
-	response, err := GenerateQuotesMessage(quoteResponses)
+	request.ChatID = groupID(ctx)
+
+	quote, err := (*s.DB).TagQuote(ctx, request)
+	var response string
+	switch {
+	case errors.Is(err, c.ErrNotFound):
+		return s.QuoteNotFound(m, request.QuoteID)
+	case errors.Is(err, c.ErrInvalidTag):
+		response, err = GenerateInvalidTagMessage(append(append([]string(nil), request.Add...), request.Remove...))
+	case err != nil:
+		s.Logger.Error("failed to tag a quote", zap.Error(err), zap.Any("request", request))
+		return nil, err
+	default:
+		response, err = GenerateTaggedQuoteMessage(quote)
+	}
 	if err != nil {
-		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Any("quotes", quoteResponses))
+		s.Logger.Error("failed to generate tag message", zap.Error(err), zap.Any("request", request))
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Chat, response)
+	return s.sendText(m.Sender, response)
 }
 
-func (s *Server) SearchWordQuote(m *tb.Message) (*tb.Message, error) {
-	res := ExtractExpressionAndNumber(m.Text)
+// Tags lists the tags of the group, the most used first
+func (s *Server) Tags(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	tags, err := (*s.DB).GetTags(ctx, groupID(ctx))
+	if err != nil {
+		s.Logger.Error("failed to get the tags", zap.Error(err))
+		return nil, err
+	}
 
-	quoteResponses, err := (*s.DB).SearchWord(res)
+	response, err := GenerateTagsMessage(tags)
 	if err != nil {
-		s.Logger.Error("failed to search word", zap.Error(err), zap.Any("QuoteNb", res))
+		s.Logger.Error("failed to generate tags message", zap.Error(err), zap.Any("tags", tags))
 		return nil, err
 	}
 
-	response, err := GenerateQuotesMessage(quoteResponses)
+	return s.sendText(m.Chat, response)
+}
+
+// QuoteNotFound tells the sender that the quote does not exist or has been deleted
+func (s *Server) QuoteNotFound(m *tb.Message, quoteID int) (*tb.Message, error) {
+	response, err := GenerateQuoteNotFoundMessage(c.UniqueSpecifiedQuoteRequest{QuoteID: quoteID})
+	if err != nil {
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Int("QuoteID", quoteID))
+		return nil, err
+	}
+
+	return s.sendText(m.Sender, response)
+}
+
+// TrashNotFound tells the sender that the quote is not in the trash
+func (s *Server) TrashNotFound(m *tb.Message, quoteID int) (*tb.Message, error) {
+	response, err := GenerateTrashNotFoundMessage(c.UniqueSpecifiedQuoteRequest{QuoteID: quoteID})
 	if err != nil {
-		s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Any("quotes", quoteResponses))
+		s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Int("QuoteID", quoteID))
 		return nil, err
 	}
 
-	return s.Bot.Send(m.Chat, response)
+	return s.sendText(m.Sender, response)
 }
@@ -6,19 +6,42 @@ import (
 	"errors"
 	"fmt"
 	"goquotebot/pkg/storages"
+	"html/template"
 	"io/fs"
 	"regexp"
 	"strconv"
 	"strings"
-	"text/template"
+	"time"
+	"unicode"
 
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
 var (
 	ErrNoIDProvided = errors.New("no id provided")
+	ErrInvalidEdit  = errors.New("invalid edit")
+	// ErrInvalidSpeakers is returned when a command does not name two speakers
+	ErrInvalidSpeakers = errors.New("invalid speakers")
+	// ErrInvalidTags is returned when /tag does not give a quote and tags
+	ErrInvalidTags = errors.New("invalid tags")
+	// ErrInvalidThread is returned when a reply asks for no message or too many
+	ErrInvalidThread = errors.New("invalid thread")
+	// ErrNothingToQuote is returned when the replied message has no text
+	ErrNothingToQuote = errors.New("nothing to quote")
 
 	regexAddQuote               *regexp.Regexp
+	regexEditQuote              *regexp.Regexp
+	regexAddDialogue            *regexp.Regexp
+	regexReplyCount             *regexp.Regexp
+	regexMediaCommand           *regexp.Regexp
+	regexMediaContext           *regexp.Regexp
+	regexEditDialogue           *regexp.Regexp
+	regexRollback               *regexp.Regexp
+	regexSpeakers               *regexp.Regexp
+	regexSpeakerWords           *regexp.Regexp
+	regexTagQuote               *regexp.Regexp
+	regexHashtag                *regexp.Regexp
+	regexQuoteRef               *regexp.Regexp
 	regexQuotesIDs              *regexp.Regexp
 	regexCmdNumber              *regexp.Regexp
 	regexSearchExpressionNumber *regexp.Regexp
@@ -31,6 +54,18 @@ var (
 func init() {
 
 	regexAddQuote = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}(\S.+?)\s{0,}\|\s{0,}(\S.+?)\s{0,}$`)
+	regexEditQuote = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}#{0,}Q{0,}([0-9]{1,})\s{1,}(\S.+?)\s{0,}\|\s{0,}(\S.+?)\s{0,}$`)
+	regexAddDialogue = regexp.MustCompile(`(?s)^\/[a-zA-Z]{1,}\s{1,}(\S.*)$`)
+	regexEditDialogue = regexp.MustCompile(`(?s)^\/[a-zA-Z]{1,}\s{1,}#{0,}Q{0,}([0-9]{1,})\s{1,}(\S.*)$`)
+	regexReplyCount = regexp.MustCompile(`^\/[a-zA-Z]{1,}(\s{1,}([0-9]{1,}))?\s{0,}$`)
+	regexMediaCommand = regexp.MustCompile(`^\/(add|quote)(\s|$)`)
+	regexMediaContext = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}(\S.*?)\s{0,}$`)
+	regexRollback = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}#{0,}Q{0,}([0-9]{1,})\s{1,}([0-9]{1,})\s{0,}$`)
+	regexSpeakers = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}(\S.*?)\s{0,}\|\s{0,}(\S.*?)\s{0,}$`)
+	regexSpeakerWords = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}(\S+)\s{1,}(\S+)\s{0,}$`)
+	regexTagQuote = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}#{0,}Q{0,}([0-9]{1,})\s{1,}(\S.*?)\s{0,}$`)
+	regexHashtag = regexp.MustCompile(`^#[\p{L}\p{N}-]*\p{L}[\p{L}\p{N}-]*$`)
+	regexQuoteRef = regexp.MustCompile(`^#{0,}Q{0,}[0-9]{1,}$`)
 	regexQuotesIDs = regexp.MustCompile(`(^|\s)#Q{0,}([0-9]{1,})\b`)
 	regexCmdNumber = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}#{0,}Q{0,}([0-9]{1,})\s{0,}$`)
 	//regexSearchExpressionNumber = regexp.MustCompile(`^\/[a-zA-Z]{1,}\s{1,}(.+?)\s{0,}(\d{0,})\s{0,}$`)
@@ -56,7 +91,8 @@ func LoadTemplates(templatesDir string, extension string) error {
 			continue
 		}
 
-		pt, err := template.ParseFS(files, templatesDir+"/"+tmpl.Name())
+		// The partials define the blocks shared by several templates
+		pt, err := template.ParseFS(files, templatesDir+"/"+tmpl.Name(), templatesDir+"/partials/*.tmpl")
 		if err != nil {
 			return err
 		}
@@ -105,16 +141,338 @@ func ExtractQuotesID(t string) []string {
 	return res
 }
 
+// ExtractQuote parses /add quote | context and /add quote | context | tags,
+// the tags being the third element when given
 func ExtractQuote(t string) []string {
 	matches := regexAddQuote.FindAllStringSubmatch(t, -1)
 	res := make([]string, 0)
 	for _, match := range matches {
 		res = append(res, match[1])
-		res = append(res, match[2])
+		quoteContext := match[2]
+		if i := strings.Index(quoteContext, "|"); i >= 0 {
+			res = append(res, strings.TrimSpace(quoteContext[:i]), strings.TrimSpace(quoteContext[i+1:]))
+			continue
+		}
+		res = append(res, quoteContext)
 	}
 	return res
 }
 
+// ExtractDialogue parses /add followed by "Speaker: words" lines, with the tags
+// on a last "| tags" line, as ExtractQuote does: the dialogue, its speakers as
+// the context and the tags when given
+func ExtractDialogue(t string) []string {
+	matches := regexAddDialogue.FindStringSubmatch(t)
+	if matches == nil {
+		return []string{}
+	}
+	return extractLines(matches[1])
+}
+
+// extractLines reads the dialogue and the "| tags" line ending it, if any
+func extractLines(t string) []string {
+	lines := strings.Split(strings.TrimSpace(t), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	tagged := strings.HasPrefix(last, "|")
+	if tagged {
+		lines = lines[:len(lines)-1]
+	}
+
+	dialogue, ok := storages.ParseDialogue(strings.Join(lines, "\n"))
+	if !ok {
+		return []string{}
+	}
+	res := []string{storages.FormatDialogue(dialogue), storages.DialogueContext(dialogue)}
+	if tagged {
+		res = append(res, strings.TrimSpace(last[1:]))
+	}
+	return res
+}
+
+// ExtractReplyCount parses /add and /add <n> sent as a reply, the number of
+// messages to quote from the replied one
+func ExtractReplyCount(t string) (int, error) {
+	matches := regexReplyCount.FindStringSubmatch(t)
+	if matches == nil {
+		return 0, ErrInvalidThread
+	}
+	if matches[2] == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(matches[2])
+	if err != nil || n < 1 || n > maxThreadLength {
+		return 0, ErrInvalidThread
+	}
+	return n, nil
+}
+
+// SpeakerName is the name a Telegram user is quoted under, its full name or
+// its username, without the colons that would split a dialogue line
+func SpeakerName(user *tb.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Username
+	}
+	return strings.Join(strings.Fields(strings.ReplaceAll(name, ":", "")), " ")
+}
+
+// QuoteMessages builds the quote of a thread of messages: their text by its
+// only speaker, or a dialogue when several people talk. The quote was said
+// when the first message was sent, and links to it and to its speakers.
+func QuoteMessages(messages []*tb.Message) (storages.AddQuoteRequest, error) {
+	// A photo, voice note, video or sticker is quoted on its own
+	if len(messages) > 0 {
+		if media, caption := MessageMedia(messages[0]); !media.IsZero() {
+			return quoteMedia(messages[0], media, caption)
+		}
+	}
+
+	var lines []storages.QuoteLine
+	quote := storages.AddQuoteRequest{TelegramIDs: make(map[string]int64)}
+	for _, m := range messages {
+		if m.Sender == nil || strings.TrimSpace(m.Text) == "" {
+			continue
+		}
+		name := SpeakerName(m.Sender)
+		if len(lines) == 0 {
+			quote.SaidAt = m.Time().UTC()
+			quote.MessageID = m.ID
+		}
+		quote.TelegramIDs[name] = m.Sender.ID
+		lines = append(lines, storages.QuoteLine{Speaker: name, Content: strings.TrimSpace(m.Text)})
+	}
+	if len(lines) == 0 {
+		return storages.AddQuoteRequest{}, ErrNothingToQuote
+	}
+
+	if len(quote.TelegramIDs) == 1 {
+		contents := make([]string, 0, len(lines))
+		for _, line := range lines {
+			contents = append(contents, line.Content)
+		}
+		quote.Content = strings.Join(contents, "\n")
+		quote.QuoteContext = lines[0].Speaker
+		return quote, nil
+	}
+
+	for i := range lines {
+		lines[i].Content = strings.Join(strings.Fields(lines[i].Content), " ")
+	}
+	quote.Content = storages.FormatDialogue(lines)
+	quote.QuoteContext = storages.DialogueContext(lines)
+	return quote, nil
+}
+
+// quoteMedia builds the quote of a media message, its caption said by its sender
+func quoteMedia(m *tb.Message, media storages.Media, caption string) (storages.AddQuoteRequest, error) {
+	if m.Sender == nil {
+		return storages.AddQuoteRequest{}, ErrNothingToQuote
+	}
+	name := SpeakerName(m.Sender)
+	return storages.AddQuoteRequest{
+		Content:      strings.TrimSpace(caption),
+		QuoteContext: name,
+		SaidAt:       m.Time().UTC(),
+		MessageID:    m.ID,
+		TelegramIDs:  map[string]int64{name: m.Sender.ID},
+		Media:        media,
+	}, nil
+}
+
+// MessageMedia returns the photo, voice note, video or sticker of a message and
+// its caption, or no media and the text of the other messages
+func MessageMedia(m *tb.Message) (storages.Media, string) {
+	switch {
+	case m.Photo != nil:
+		return storages.Media{Type: storages.MediaPhoto, FileID: m.Photo.FileID}, m.Caption
+	case m.Voice != nil:
+		return storages.Media{Type: storages.MediaVoice, FileID: m.Voice.FileID}, m.Caption
+	case m.Video != nil:
+		return storages.Media{Type: storages.MediaVideo, FileID: m.Video.FileID}, m.Caption
+	case m.Sticker != nil:
+		return storages.Media{Type: storages.MediaSticker, FileID: m.Sticker.FileID}, ""
+	}
+	return storages.Media{}, m.Text
+}
+
+// IsMediaQuote tells whether a media message is to be quoted: sent with an
+// /add or /quote caption, or forwarded to the bot in DM
+func IsMediaQuote(m *tb.Message) bool {
+	if m.Chat != nil && m.Chat.Type == tb.ChatPrivate && m.OriginalUnixtime != 0 {
+		return true
+	}
+	return regexMediaCommand.MatchString(m.Caption)
+}
+
+// ExtractMediaQuote builds the quote of a media sent with an /add caption, as
+// /add caption | context | tags with optional tags, or /add context alone
+func ExtractMediaQuote(m *tb.Message) (storages.AddQuoteRequest, error) {
+	media, caption := MessageMedia(m)
+	if media.IsZero() {
+		return storages.AddQuoteRequest{}, ErrNothingToQuote
+	}
+
+	quote := storages.AddQuoteRequest{Media: media}
+	if tmp := ExtractQuote(caption); len(tmp) >= 2 {
+		quote.Content, quote.QuoteContext = tmp[0], tmp[1]
+		if len(tmp) > 2 {
+			quote.Tags = ExtractTags(tmp[2])
+		}
+		return quote, nil
+	}
+	matches := regexMediaContext.FindStringSubmatch(caption)
+	if matches == nil {
+		return storages.AddQuoteRequest{}, ErrNothingToQuote
+	}
+	quote.QuoteContext = matches[1]
+	return quote, nil
+}
+
+// ExtractForward builds the quote of a forwarded message, said by its original
+// sender when it was first sent
+func ExtractForward(m *tb.Message) (storages.AddQuoteRequest, error) {
+	media, content := MessageMedia(m)
+	content = strings.TrimSpace(content)
+	if content == "" && media.IsZero() {
+		return storages.AddQuoteRequest{}, ErrNothingToQuote
+	}
+
+	quote := storages.AddQuoteRequest{Content: content, SaidAt: time.Unix(int64(m.OriginalUnixtime), 0).UTC(), Media: media}
+	switch {
+	case m.OriginalSender != nil:
+		quote.QuoteContext = SpeakerName(m.OriginalSender)
+		quote.TelegramIDs = map[string]int64{quote.QuoteContext: m.OriginalSender.ID}
+	case m.OriginalSenderName != "":
+		quote.QuoteContext = SpeakerName(&tb.User{FirstName: m.OriginalSenderName})
+	case m.OriginalChat != nil:
+		quote.QuoteContext = SpeakerName(&tb.User{FirstName: m.OriginalChat.Title})
+	}
+	if quote.QuoteContext == "" {
+		return storages.AddQuoteRequest{}, ErrNothingToQuote
+	}
+	return quote, nil
+}
+
+// ExtractTags splits tags separated by commas or spaces, "work, #cats" giving work and #cats
+func ExtractTags(t string) []string {
+	return strings.FieldsFunc(t, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// ExtractTagQuote parses /tag <id> +tag -tag, the tags without sign are added
+func ExtractTagQuote(t string) (storages.TagQuoteRequest, error) {
+	matches := regexTagQuote.FindStringSubmatch(t)
+	if matches == nil {
+		return storages.TagQuoteRequest{}, ErrInvalidTags
+	}
+
+	quoteID, err := ConvertMatchToInt(matches)
+	if err != nil {
+		return storages.TagQuoteRequest{}, err
+	}
+	request := storages.TagQuoteRequest{QuoteID: quoteID}
+	for _, tag := range ExtractTags(matches[2]) {
+		if strings.HasPrefix(tag, "-") {
+			request.Remove = append(request.Remove, tag[1:])
+			continue
+		}
+		request.Add = append(request.Add, strings.TrimPrefix(tag, "+"))
+	}
+	return request, nil
+}
+
+// ExtractNumberAndTag parses /random <n> #tag, the number and the tag being
+// optional and in any order. The tag is returned without its #, #Q30 remains
+// the number 30.
+func ExtractNumberAndTag(t string) (int, string, error) {
+	fields := strings.Fields(t)
+	kept := make([]string, 0, len(fields))
+	tag := ""
+	for i, field := range fields {
+		if i > 0 && tag == "" && regexHashtag.MatchString(field) && !regexQuoteRef.MatchString(field) {
+			tag = field[1:]
+			continue
+		}
+		kept = append(kept, field)
+	}
+
+	nb, err := ExtractNumber(strings.Join(kept, " "))
+	return nb, tag, err
+}
+
+// ExtractEditQuote parses /edit <id> quote | context and /edit <id> followed by
+// the lines of a dialogue
+func ExtractEditQuote(t string) (storages.EditQuoteRequest, error) {
+	matches := regexEditQuote.FindStringSubmatch(t)
+	if matches == nil {
+		return extractEditDialogue(t)
+	}
+
+	quoteID, err := ConvertMatchToInt(matches)
+	if err != nil {
+		return storages.EditQuoteRequest{}, err
+	}
+	return storages.EditQuoteRequest{
+		QuoteID:      quoteID,
+		Content:      matches[2],
+		QuoteContext: matches[3],
+	}, nil
+}
+
+// extractEditDialogue parses /edit <id> followed by "Speaker: words" lines
+func extractEditDialogue(t string) (storages.EditQuoteRequest, error) {
+	matches := regexEditDialogue.FindStringSubmatch(t)
+	if matches == nil {
+		return storages.EditQuoteRequest{}, ErrInvalidEdit
+	}
+	dialogue := extractLines(matches[2])
+	if len(dialogue) != 2 {
+		return storages.EditQuoteRequest{}, ErrInvalidEdit
+	}
+
+	quoteID, err := ConvertMatchToInt(matches)
+	if err != nil {
+		return storages.EditQuoteRequest{}, err
+	}
+	return storages.EditQuoteRequest{
+		QuoteID:      quoteID,
+		Content:      dialogue[0],
+		QuoteContext: dialogue[1],
+	}, nil
+}
+
+// ExtractRollback parses /rollback <id> <revision>
+func ExtractRollback(t string) (storages.RollbackQuoteRequest, error) {
+	matches := regexRollback.FindStringSubmatch(t)
+	if matches == nil {
+		return storages.RollbackQuoteRequest{}, ErrNoIDProvided
+	}
+
+	quoteID, err := ConvertMatchToInt(matches)
+	if err != nil {
+		return storages.RollbackQuoteRequest{}, err
+	}
+	revision, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return storages.RollbackQuoteRequest{}, err
+	}
+	return storages.RollbackQuoteRequest{QuoteID: quoteID, Revision: revision}, nil
+}
+
+// ExtractSpeakers parses /alias <name> <canonical> and /mergespeakers <from> <into>,
+// names with spaces are separated by a pipe: /alias Bob Jr | Bob
+func ExtractSpeakers(t string) (string, string, error) {
+	matches := regexSpeakers.FindStringSubmatch(t)
+	if matches == nil {
+		matches = regexSpeakerWords.FindStringSubmatch(t)
+	}
+	if matches == nil {
+		return "", "", ErrInvalidSpeakers
+	}
+	return matches[1], matches[2], nil
+}
+
 func ConvertMatchToInt(m []string) (int, error) {
 	res, err := strconv.Atoi(m[1])
 	if err != nil {
@@ -142,21 +500,46 @@ func ExtractNumber(t string) (int, error) {
 	return ConvertMatchToInt(matches[0])
 }
 
+// GenerateQuotesMessage renders the quotes in a single text, each one cut to
+// fit in a message. renderQuotes splits them in messages instead.
 func GenerateQuotesMessage(quotes []storages.QuoteResponse) (string, error) {
 	if len(quotes) == 0 {
 		return "No quote available", nil
 	}
 
+	blocks := make([]string, 0, len(quotes))
+	for _, quote := range quotes {
+		block, err := renderQuote(quote, messageLimit)
+		if err != nil {
+			return "", err
+		}
+		blocks = append(blocks, block)
+	}
+	return "\n" + strings.Join(blocks, quoteSeparator), nil
+}
+
+// GenerateGroupMessage names the group the commands of a chat go to, and
+// invites to pick another one when there is a choice
+func GenerateGroupMessage(group *tb.Chat, private, choosable bool) (string, error) {
+	data := struct {
+		Group     string
+		Private   bool
+		Choosable bool
+	}{
+		Group:     group.Title,
+		Private:   private,
+		Choosable: choosable,
+	}
+
 	var buf bytes.Buffer
-	err := templates["quotes.tmpl"].Execute(&buf, quotes)
+	err := templates["group.tmpl"].Execute(&buf, data)
 	if err != nil {
 		return "", err
 	}
-	response := buf.String()
-	return response[:len(response)-38], nil
+	return buf.String(), nil
 }
 
-func GenerateNewQuoteMessage(quote storages.AddQuoteRequest) (string, error) {
+func GenerateNewQuoteMessage(quote storages.QuoteResponse) (string, error) {
 	var buf bytes.Buffer
 	err := templates["quote_added.tmpl"].Execute(&buf, quote)
 	if err != nil {
@@ -165,6 +548,149 @@ func GenerateNewQuoteMessage(quote storages.AddQuoteRequest) (string, error) {
 	return buf.String(), nil
 }
 
+// GenerateInlineResult builds the article sharing a quote from an inline
+// query, titled with its first words and described by its speaker and votes
+func GenerateInlineResult(quote storages.QuoteResponse) (*tb.ArticleResult, error) {
+	text, err := GenerateQuotesMessage([]storages.QuoteResponse{quote})
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.Join(strings.Fields(quote.Content), " ")
+	if title == "" {
+		title = string(quote.Media.Type)
+	}
+	if runes := []rune(title); len(runes) > inlineTitleLength {
+		title = string(runes[:inlineTitleLength-1]) + "…"
+	}
+	result := &tb.ArticleResult{
+		Title:       title,
+		Description: fmt.Sprintf("#Q%d (%+d) by %s", quote.QuoteID, quote.Votes, quote.QuoteContext),
+	}
+	result.SetResultID(strconv.Itoa(quote.QuoteID))
+	result.SetContent(&tb.InputTextMessageContent{Text: strings.TrimSpace(text), ParseMode: tb.ModeHTML})
+	return result, nil
+}
+
+// GenerateConfirmQuoteMessage asks to confirm the quote before publishing it in the group
+func GenerateConfirmQuoteMessage(group *tb.Chat, quote storages.AddQuoteRequest) (string, error) {
+	data := struct {
+		Group string
+		Quote storages.AddQuoteRequest
+	}{
+		Group: group.Title,
+		Quote: quote,
+	}
+
+	var buf bytes.Buffer
+	err := templates["quote_confirm.tmpl"].Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateForbiddenContextMessage(quote storages.AddQuoteRequest) (string, error) {
+	var buf bytes.Buffer
+	err := templates["quote_forbidden.tmpl"].Execute(&buf, quote)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// addAnywayCommand is the /addanyway adding the quote again with its tags, a
+// dialogue being sent as its lines followed by a "| tags" line
+func addAnywayCommand(quote storages.AddQuoteRequest) string {
+	tags := strings.Join(quote.Tags, ", ")
+	if _, ok := storages.ParseDialogue(quote.Content); ok {
+		command := "/addanyway " + quote.Content
+		if tags != "" {
+			command += "\n| " + tags
+		}
+		return command
+	}
+
+	command := "/addanyway " + quote.Content + " | " + quote.QuoteContext
+	if tags != "" {
+		command += " | " + tags
+	}
+	return command
+}
+
+// GenerateDuplicateQuoteMessage mentions the similar quotes as #Q<id>, so that
+// the reply can be fed to Message to show them. Near misses can be added anyway.
+func GenerateDuplicateQuoteMessage(quote storages.AddQuoteRequest, duplicate storages.ErrProbableDuplicate) (string, error) {
+	type match struct {
+		QuoteID int
+		Percent float64
+	}
+	data := struct {
+		Content  string
+		Command  string
+		Matches  []match
+		NearMiss bool
+	}{
+		Content:  quote.Content,
+		Command:  addAnywayCommand(quote),
+		NearMiss: duplicate.NearMiss(),
+	}
+	for _, m := range duplicate.Matches {
+		data.Matches = append(data.Matches, match{QuoteID: m.QuoteID, Percent: m.Similarity * 100})
+	}
+
+	var buf bytes.Buffer
+	err := templates["quote_duplicate.tmpl"].Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateEditedQuoteMessage(quote storages.QuoteResponse) (string, error) {
+	var buf bytes.Buffer
+	err := templates["quote_edited.tmpl"].Execute(&buf, quote)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateHistoryMessage(quote storages.UniqueSpecifiedQuoteRequest, revisions []storages.RevisionResponse) (string, error) {
+	data := struct {
+		QuoteID   int
+		Revisions []storages.RevisionResponse
+	}{
+		QuoteID:   quote.QuoteID,
+		Revisions: revisions,
+	}
+
+	var buf bytes.Buffer
+	err := templates["quote_history.tmpl"].Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateRevisionNotFoundMessage(request storages.RollbackQuoteRequest) (string, error) {
+	var buf bytes.Buffer
+	err := templates["revision_not_found.tmpl"].Execute(&buf, request)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateQuoteNotFoundMessage(quote storages.UniqueSpecifiedQuoteRequest) (string, error) {
+	var buf bytes.Buffer
+	err := templates["quote_not_found.tmpl"].Execute(&buf, quote)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 func GenerateDeleteQuoteMessage(quote storages.UniqueSpecifiedQuoteRequest) (string, error) {
 	var buf bytes.Buffer
 	err := templates["quote_deleted.tmpl"].Execute(&buf, quote)
@@ -174,6 +700,54 @@ func GenerateDeleteQuoteMessage(quote storages.UniqueSpecifiedQuoteRequest) (str
 	return buf.String(), nil
 }
 
+// GenerateTrashMessage lists a page of deleted quotes, next is the number of
+// the following page or 0 when this one is the last
+func GenerateTrashMessage(page int, quotes []storages.QuoteResponse, next int) (string, error) {
+	data := struct {
+		Page   int
+		Quotes []storages.QuoteResponse
+		Next   int
+	}{
+		Page:   page,
+		Quotes: quotes,
+		Next:   next,
+	}
+
+	var buf bytes.Buffer
+	err := templates["trash.tmpl"].Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateRestoredQuoteMessage(quote storages.QuoteResponse) (string, error) {
+	var buf bytes.Buffer
+	err := templates["quote_restored.tmpl"].Execute(&buf, quote)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GeneratePurgedQuoteMessage(quote storages.UniqueSpecifiedQuoteRequest) (string, error) {
+	var buf bytes.Buffer
+	err := templates["quote_purged.tmpl"].Execute(&buf, quote)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateTrashNotFoundMessage(quote storages.UniqueSpecifiedQuoteRequest) (string, error) {
+	var buf bytes.Buffer
+	err := templates["trash_not_found.tmpl"].Execute(&buf, quote)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 func GenerateVoteAddedMessage(vote storages.VoteQuoteRequest) (string, error) {
 	var buf bytes.Buffer
 	err := templates["vote_added.tmpl"].Execute(&buf, vote)
@@ -192,6 +766,81 @@ func GenerateVoteRemovedMessage(vote storages.VoteQuoteRequest) (string, error)
 	return buf.String(), nil
 }
 
+func GenerateSpeakersMessage(speakers []storages.SpeakerResponse) (string, error) {
+	var buf bytes.Buffer
+	err := templates["speakers.tmpl"].Execute(&buf, speakers)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateAliasedSpeakerMessage(speaker storages.SpeakerResponse) (string, error) {
+	var buf bytes.Buffer
+	err := templates["speaker_aliased.tmpl"].Execute(&buf, speaker)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateMergedSpeakersMessage(speaker storages.SpeakerResponse) (string, error) {
+	var buf bytes.Buffer
+	err := templates["speakers_merged.tmpl"].Execute(&buf, speaker)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateAliasTakenMessage(request storages.AliasSpeakerRequest) (string, error) {
+	var buf bytes.Buffer
+	err := templates["alias_taken.tmpl"].Execute(&buf, request)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// GenerateSpeakerNotFoundMessage tells that no speaker matches one of the names
+func GenerateSpeakerNotFoundMessage(names ...string) (string, error) {
+	var buf bytes.Buffer
+	err := templates["speaker_not_found.tmpl"].Execute(&buf, names)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// GenerateTagsMessage lists the tags with their number of quotes
+func GenerateTagsMessage(tags []storages.TagResponse) (string, error) {
+	var buf bytes.Buffer
+	err := templates["tags.tmpl"].Execute(&buf, tags)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func GenerateTaggedQuoteMessage(quote storages.QuoteResponse) (string, error) {
+	var buf bytes.Buffer
+	err := templates["quote_tagged.tmpl"].Execute(&buf, quote)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// GenerateInvalidTagMessage explains what a tag is made of
+func GenerateInvalidTagMessage(tags []string) (string, error) {
+	var buf bytes.Buffer
+	err := templates["tag_invalid.tmpl"].Execute(&buf, tags)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 func isAtLeastMember(member *tb.ChatMember) bool {
 	switch member.Role {
 	case "member":
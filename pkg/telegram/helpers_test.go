@@ -2,8 +2,15 @@ package telegram
 
 import (
 	"errors"
+	"fmt"
+	"goquotebot/pkg/search"
 	c "goquotebot/pkg/storages"
+	"html"
+	"strings"
 	"testing"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
 )
 
 func areEquals(a, b []string) bool {
@@ -105,6 +112,12 @@ func TestExtractQuote(t *testing.T) {
 		}, {
 			Input:    "/add I want to love Go a lot but your algorithm is blocking me | Gopher",
 			Expected: []string{"I want to love Go a lot but your algorithm is blocking me", "Gopher"},
+		}, {
+			Input:    "/add A tagged quote | owner | work, #cats ",
+			Expected: []string{"A tagged quote", "owner", "work, #cats"},
+		}, {
+			Input:    "/add A quote|owner|",
+			Expected: []string{"A quote", "owner", ""},
 		},
 	}
 
@@ -116,6 +129,243 @@ func TestExtractQuote(t *testing.T) {
 	}
 }
 
+func TestExtractDialogue(t *testing.T) {
+	samples := []struct {
+		Input    string
+		Expected []string
+	}{
+		{
+			Input:    "/add\nAlice: Who ate the croissant?\nBob: Not me",
+			Expected: []string{"Alice: Who ate the croissant?\nBob: Not me", "Alice, Bob"},
+		}, {
+			Input:    "/add Alice : Who?\n\n  @Bob:   Me  \nalice: Thanks\n| food, #mondays",
+			Expected: []string{"Alice: Who?\nBob: Me\nalice: Thanks", "Alice, Bob", "food, #mondays"},
+		}, {
+			Input:    "/add\nAlice: A single line",
+			Expected: []string{},
+		}, {
+			Input:    "/add\nAlice: Who ate the croissant?\nnobody said this",
+			Expected: []string{},
+		}, {
+			Input:    "/add A quote | owner",
+			Expected: []string{},
+		}, {
+			Input:    "/add",
+			Expected: []string{},
+		},
+	}
+
+	for _, sample := range samples {
+		tmp := ExtractDialogue(sample.Input)
+		if !areEquals(tmp, sample.Expected) {
+			t.Errorf("got %q, wanted %q for the input : %q", tmp, sample.Expected, sample.Input)
+		}
+	}
+}
+
+func TestExtractReplyCount(t *testing.T) {
+	samples := []struct {
+		Input         string
+		ErrorExpected error
+		Expected      int
+	}{
+		{Input: "/add", Expected: 1},
+		{Input: "/quote 3 ", Expected: 3},
+		{Input: "/add 10", Expected: 10},
+		{Input: "/add 0", ErrorExpected: ErrInvalidThread},
+		{Input: "/add 11", ErrorExpected: ErrInvalidThread},
+		{Input: "/add a quote", ErrorExpected: ErrInvalidThread},
+	}
+
+	for _, sample := range samples {
+		n, err := ExtractReplyCount(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v for the input : %s", err, sample.ErrorExpected, sample.Input)
+			continue
+		}
+		if n != sample.Expected {
+			t.Errorf("got %d, wanted %d for the input : %s", n, sample.Expected, sample.Input)
+		}
+	}
+}
+
+func TestSpeakerName(t *testing.T) {
+	samples := []struct {
+		Input    tb.User
+		Expected string
+	}{
+		{Input: tb.User{FirstName: "Alice", LastName: "Smith", Username: "alice"}, Expected: "Alice Smith"},
+		{Input: tb.User{FirstName: "Bob"}, Expected: "Bob"},
+		{Input: tb.User{Username: "carol"}, Expected: "carol"},
+		{Input: tb.User{FirstName: "Re: Dave ", LastName: " :)"}, Expected: "Re Dave )"},
+	}
+
+	for _, sample := range samples {
+		name := SpeakerName(&sample.Input)
+		if name != sample.Expected {
+			t.Errorf("got %q, wanted %q", name, sample.Expected)
+		}
+	}
+}
+
+func TestQuoteMessages(t *testing.T) {
+	alice := &tb.User{ID: 1001, FirstName: "Alice"}
+	bob := &tb.User{ID: 1002, FirstName: "Bob", LastName: "Smith"}
+	said := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	samples := []struct {
+		Input         []*tb.Message
+		ErrorExpected error
+		Expected      c.AddQuoteRequest
+	}{
+		{
+			Input:    []*tb.Message{{ID: 42, Sender: alice, Unixtime: said.Unix(), Text: " I never said that "}},
+			Expected: c.AddQuoteRequest{Content: "I never said that", QuoteContext: "Alice", SaidAt: said, MessageID: 42, TelegramIDs: map[string]int64{"Alice": 1001}},
+		},
+		{
+			Input: []*tb.Message{
+				{ID: 42, Sender: alice, Unixtime: said.Unix(), Text: "I never said that"},
+				{ID: 43, Sender: alice, Unixtime: said.Unix() + 60, Text: "Or did I?"},
+			},
+			Expected: c.AddQuoteRequest{Content: "I never said that\nOr did I?", QuoteContext: "Alice", SaidAt: said, MessageID: 42, TelegramIDs: map[string]int64{"Alice": 1001}},
+		},
+		{
+			Input: []*tb.Message{
+				{ID: 42, Sender: alice, Unixtime: said.Unix(), Text: "Who ate\nthe croissant?"},
+				{ID: 43, Sender: bob, Unixtime: said.Unix() + 60, Text: "Not me"},
+				{ID: 44, Sender: alice, Unixtime: said.Unix() + 120, Text: "Crumbs!"},
+			},
+			Expected: c.AddQuoteRequest{Content: "Alice: Who ate the croissant?\nBob Smith: Not me\nAlice: Crumbs!", QuoteContext: "Alice, Bob Smith", SaidAt: said, MessageID: 42, TelegramIDs: map[string]int64{"Alice": 1001, "Bob Smith": 1002}},
+		},
+		{
+			Input:         []*tb.Message{{ID: 42, Sender: alice, Unixtime: said.Unix()}},
+			ErrorExpected: ErrNothingToQuote,
+		},
+		{
+			// A media is quoted without the messages following it
+			Input: []*tb.Message{
+				{ID: 42, Sender: alice, Unixtime: said.Unix(), Photo: &tb.Photo{File: tb.File{FileID: "AgAD"}}, Caption: " Me on Mondays "},
+				{ID: 43, Sender: bob, Unixtime: said.Unix() + 60, Text: "So relatable"},
+			},
+			Expected: c.AddQuoteRequest{Content: "Me on Mondays", QuoteContext: "Alice", SaidAt: said, MessageID: 42, TelegramIDs: map[string]int64{"Alice": 1001}, Media: c.Media{Type: c.MediaPhoto, FileID: "AgAD"}},
+		},
+		{
+			Input:    []*tb.Message{{ID: 42, Sender: bob, Unixtime: said.Unix(), Sticker: &tb.Sticker{File: tb.File{FileID: "CAAD"}}}},
+			Expected: c.AddQuoteRequest{QuoteContext: "Bob Smith", SaidAt: said, MessageID: 42, TelegramIDs: map[string]int64{"Bob Smith": 1002}, Media: c.Media{Type: c.MediaSticker, FileID: "CAAD"}},
+		},
+	}
+
+	for _, sample := range samples {
+		quote, err := QuoteMessages(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v", err, sample.ErrorExpected)
+			continue
+		}
+		if fmt.Sprint(quote) != fmt.Sprint(sample.Expected) {
+			t.Errorf("got %+v, wanted %+v", quote, sample.Expected)
+		}
+	}
+}
+
+func TestExtractForward(t *testing.T) {
+	said := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	samples := []struct {
+		Input         tb.Message
+		ErrorExpected error
+		Expected      c.AddQuoteRequest
+	}{
+		{
+			Input:    tb.Message{Text: " I never said that ", OriginalSender: &tb.User{ID: 1001, FirstName: "Alice"}, OriginalUnixtime: int(said.Unix())},
+			Expected: c.AddQuoteRequest{Content: "I never said that", QuoteContext: "Alice", SaidAt: said, TelegramIDs: map[string]int64{"Alice": 1001}},
+		},
+		{
+			Input:    tb.Message{Text: "Hidden", OriginalSenderName: "Bob Smith", OriginalUnixtime: int(said.Unix())},
+			Expected: c.AddQuoteRequest{Content: "Hidden", QuoteContext: "Bob Smith", SaidAt: said},
+		},
+		{
+			Input:    tb.Message{Text: "Breaking news", OriginalChat: &tb.Chat{Title: "The Daily"}, OriginalUnixtime: int(said.Unix())},
+			Expected: c.AddQuoteRequest{Content: "Breaking news", QuoteContext: "The Daily", SaidAt: said},
+		},
+		{
+			Input:         tb.Message{OriginalSender: &tb.User{ID: 1001, FirstName: "Alice"}, OriginalUnixtime: int(said.Unix())},
+			ErrorExpected: ErrNothingToQuote,
+		},
+		{
+			Input:    tb.Message{Voice: &tb.Voice{File: tb.File{FileID: "AwAD"}}, OriginalSenderName: "Bob Smith", OriginalUnixtime: int(said.Unix())},
+			Expected: c.AddQuoteRequest{QuoteContext: "Bob Smith", SaidAt: said, Media: c.Media{Type: c.MediaVoice, FileID: "AwAD"}},
+		},
+	}
+
+	for _, sample := range samples {
+		quote, err := ExtractForward(&sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v", err, sample.ErrorExpected)
+			continue
+		}
+		if fmt.Sprint(quote) != fmt.Sprint(sample.Expected) {
+			t.Errorf("got %+v, wanted %+v", quote, sample.Expected)
+		}
+	}
+}
+
+func TestExtractMediaQuote(t *testing.T) {
+	photo := &tb.Photo{File: tb.File{FileID: "AgAD"}}
+	samples := []struct {
+		Input         tb.Message
+		ErrorExpected error
+		Expected      c.AddQuoteRequest
+	}{
+		{
+			Input:    tb.Message{Photo: photo, Caption: "/add Me on Mondays | Bob | mood"},
+			Expected: c.AddQuoteRequest{Content: "Me on Mondays", QuoteContext: "Bob", Tags: []string{"mood"}, Media: c.Media{Type: c.MediaPhoto, FileID: "AgAD"}},
+		},
+		{
+			Input:    tb.Message{Video: &tb.Video{File: tb.File{FileID: "BAAD"}}, Caption: "/add  Bob Smith "},
+			Expected: c.AddQuoteRequest{QuoteContext: "Bob Smith", Media: c.Media{Type: c.MediaVideo, FileID: "BAAD"}},
+		},
+		{
+			Input:         tb.Message{Photo: photo, Caption: "/add"},
+			ErrorExpected: ErrNothingToQuote,
+		},
+		{
+			Input:         tb.Message{Text: "/add Me on Mondays | Bob"},
+			ErrorExpected: ErrNothingToQuote,
+		},
+	}
+
+	for _, sample := range samples {
+		quote, err := ExtractMediaQuote(&sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v", err, sample.ErrorExpected)
+			continue
+		}
+		if fmt.Sprint(quote) != fmt.Sprint(sample.Expected) {
+			t.Errorf("got %+v, wanted %+v", quote, sample.Expected)
+		}
+	}
+}
+
+func TestIsMediaQuote(t *testing.T) {
+	photo := &tb.Photo{File: tb.File{FileID: "AgAD"}}
+	group := &tb.Chat{ID: -100, Type: tb.ChatSuperGroup}
+	samples := []struct {
+		Input    tb.Message
+		Expected bool
+	}{
+		{Input: tb.Message{Chat: group, Photo: photo, Caption: "/add Bob"}, Expected: true},
+		{Input: tb.Message{Chat: group, Photo: photo, Caption: "/quote"}, Expected: true},
+		{Input: tb.Message{Chat: group, Photo: photo, Caption: "/addanyway Bob"}, Expected: false},
+		{Input: tb.Message{Chat: group, Photo: photo, Caption: "Look at this /add Bob"}, Expected: false},
+		{Input: tb.Message{Chat: group, Sticker: &tb.Sticker{}, OriginalUnixtime: 1614834367}, Expected: false},
+		{Input: tb.Message{Chat: &tb.Chat{ID: 1001, Type: tb.ChatPrivate}, Sticker: &tb.Sticker{}, OriginalUnixtime: 1614834367}, Expected: true},
+	}
+
+	for _, sample := range samples {
+		if got := IsMediaQuote(&sample.Input); got != sample.Expected {
+			t.Errorf("got %v for %+v, wanted %v", got, sample.Input, sample.Expected)
+		}
+	}
+}
+
 func TestExtractNumber(t *testing.T) {
 	samples := []struct {
 		Input         string
@@ -161,6 +411,75 @@ func TestExtractNumber(t *testing.T) {
 	}
 }
 
+func TestExtractNumberAndTag(t *testing.T) {
+	samples := []struct {
+		Input       string
+		ExpectedNb  int
+		ExpectedTag string
+	}{
+		{Input: "/random", ExpectedNb: 1},
+		{Input: "/random 3", ExpectedNb: 3},
+		{Input: "/random #work", ExpectedNb: 1, ExpectedTag: "work"},
+		{Input: "/top 5 #road-trip", ExpectedNb: 5, ExpectedTag: "road-trip"},
+		{Input: "/top  #Work  5 ", ExpectedNb: 5, ExpectedTag: "Work"},
+		{Input: "/last #Q30", ExpectedNb: 30},
+		{Input: "/last #30", ExpectedNb: 30},
+		{Input: "/random #work #cats", ExpectedNb: 1, ExpectedTag: "work"},
+	}
+
+	for _, sample := range samples {
+		nb, tag, err := ExtractNumberAndTag(sample.Input)
+		if err != nil {
+			t.Errorf("error %v should not have occured for %s", err, sample.Input)
+			continue
+		}
+		if nb != sample.ExpectedNb || tag != sample.ExpectedTag {
+			t.Errorf("got %d %q, wanted %d %q for %s", nb, tag, sample.ExpectedNb, sample.ExpectedTag, sample.Input)
+		}
+	}
+}
+
+func TestExtractTags(t *testing.T) {
+	tags := ExtractTags(" work,#cats  road-trip,, ")
+	expected := []string{"work", "#cats", "road-trip"}
+	if !areEquals(tags, expected) {
+		t.Errorf("got %q, wanted %q", tags, expected)
+	}
+}
+
+func TestExtractTagQuote(t *testing.T) {
+	samples := []struct {
+		Input         string
+		ErrorExpected error
+		Expected      c.TagQuoteRequest
+	}{
+		{
+			Input:    "/tag 12 work",
+			Expected: c.TagQuoteRequest{QuoteID: 12, Add: []string{"work"}},
+		}, {
+			Input:    "/tag #Q12 +work, -cats +#road-trip",
+			Expected: c.TagQuoteRequest{QuoteID: 12, Add: []string{"work", "#road-trip"}, Remove: []string{"cats"}},
+		}, {
+			Input:         "/tag 12",
+			ErrorExpected: ErrInvalidTags,
+		}, {
+			Input:         "/tag work",
+			ErrorExpected: ErrInvalidTags,
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := ExtractTagQuote(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v for the input : %s", err, sample.ErrorExpected, sample.Input)
+			continue
+		}
+		if tmp.QuoteID != sample.Expected.QuoteID || !areEquals(tmp.Add, sample.Expected.Add) || !areEquals(tmp.Remove, sample.Expected.Remove) {
+			t.Errorf("got %+v, wanted %+v", tmp, sample.Expected)
+		}
+	}
+}
+
 func TestExtractID(t *testing.T) {
 	samples := []struct {
 		Input         string
@@ -204,6 +523,118 @@ func TestExtractID(t *testing.T) {
 	}
 }
 
+func TestExtractEditQuote(t *testing.T) {
+	samples := []struct {
+		Input         string
+		ErrorExpected error
+		Expected      c.EditQuoteRequest
+	}{
+		{
+			Input:         "/edit 104 the fixed quote | Bob",
+			ErrorExpected: nil,
+			Expected:      c.EditQuoteRequest{QuoteID: 104, Content: "the fixed quote", QuoteContext: "Bob"},
+		}, {
+			Input:         "/edit #Q104   ab | cd  ",
+			ErrorExpected: nil,
+			Expected:      c.EditQuoteRequest{QuoteID: 104, Content: "ab", QuoteContext: "cd"},
+		}, {
+			Input:         "/edit the fixed quote | Bob",
+			ErrorExpected: ErrInvalidEdit,
+		}, {
+			Input:         "/edit 104 the fixed quote",
+			ErrorExpected: ErrInvalidEdit,
+		}, {
+			Input:         "/edit #Q104\nAlice: Who ate it?\n@bob: Not me",
+			ErrorExpected: nil,
+			Expected:      c.EditQuoteRequest{QuoteID: 104, Content: "Alice: Who ate it?\nbob: Not me", QuoteContext: "Alice, bob"},
+		}, {
+			Input:         "/edit 104\nAlice: a single line",
+			ErrorExpected: ErrInvalidEdit,
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := ExtractEditQuote(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v for the input : %s", err, sample.ErrorExpected, sample.Input)
+			continue
+		}
+		if sample.ErrorExpected == nil && tmp != sample.Expected {
+			t.Errorf("got %+v, wanted %+v", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestExtractRollback(t *testing.T) {
+	samples := []struct {
+		Input         string
+		ErrorExpected error
+		Expected      c.RollbackQuoteRequest
+	}{
+		{
+			Input:         "/rollback 104 2",
+			ErrorExpected: nil,
+			Expected:      c.RollbackQuoteRequest{QuoteID: 104, Revision: 2},
+		}, {
+			Input:         "/rollback #Q104  1 ",
+			ErrorExpected: nil,
+			Expected:      c.RollbackQuoteRequest{QuoteID: 104, Revision: 1},
+		}, {
+			Input:         "/rollback 104",
+			ErrorExpected: ErrNoIDProvided,
+		}, {
+			Input:         "/rollback 104 last",
+			ErrorExpected: ErrNoIDProvided,
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := ExtractRollback(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v for the input : %s", err, sample.ErrorExpected, sample.Input)
+			continue
+		}
+		if sample.ErrorExpected == nil && tmp != sample.Expected {
+			t.Errorf("got %+v, wanted %+v", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestExtractSpeakers(t *testing.T) {
+	samples := []struct {
+		Input         string
+		ErrorExpected error
+		Expected      [2]string
+	}{
+		{
+			Input:         "/alias Bobby Bob",
+			ErrorExpected: nil,
+			Expected:      [2]string{"Bobby", "Bob"},
+		}, {
+			Input:         "/mergespeakers  Bob Jr |  Bob  ",
+			ErrorExpected: nil,
+			Expected:      [2]string{"Bob Jr", "Bob"},
+		}, {
+			Input:         "/alias Bobby",
+			ErrorExpected: ErrInvalidSpeakers,
+		}, {
+			Input:         "/alias Bob Jr Bob",
+			ErrorExpected: ErrInvalidSpeakers,
+		},
+	}
+
+	for _, sample := range samples {
+		first, second, err := ExtractSpeakers(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v for the input : %s", err, sample.ErrorExpected, sample.Input)
+			continue
+		}
+		if sample.ErrorExpected == nil && [2]string{first, second} != sample.Expected {
+			t.Errorf("got %q %q, wanted %q", first, second, sample.Expected)
+		}
+	}
+}
+
 func TestExtractSearchExpressionRequest(t *testing.T) {
 	samples := []struct {
 		Input         string
@@ -262,7 +693,7 @@ func TestGenerateQuotesMessage(t *testing.T) {
 				},
 			},
 			ErrorExpected: nil,
-			Expected:      "\n#Q4 (+2)\n*Content of the quote*\n\n_by Contexte_",
+			Expected:      "\n#Q4 (+2)\n<b>Content of the quote</b>\n\n<i>by Contexte</i>",
 		},
 		{
 			Input: []c.QuoteResponse{
@@ -282,7 +713,55 @@ func TestGenerateQuotesMessage(t *testing.T) {
 				},
 			},
 			ErrorExpected: nil,
-			Expected:      "\n#Q4 (+3)\n*Content 1*\n\n_by Contexte 1_\n\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\\_\n\n#Q5 (-4)\n*Content 2 | \n Test*\n\n_by Contexte 2<>_",
+			Expected:      "\n#Q4 (+3)\n<b>Content 1</b>\n\n<i>by Contexte 1</i>\n__________________\n\n#Q5 (-4)\n<b>Content 2 | \n Test</b>\n\n<i>by Contexte 2&lt;&gt;</i>",
+		}, {
+			Input: []c.QuoteResponse{
+				{
+					QuoteID:      4,
+					Content:      "Content 1",
+					QuoteContext: "Contexte 1",
+					Tags:         []string{"cats", "work"},
+				},
+				{
+					QuoteID:      5,
+					Content:      "Content 2",
+					QuoteContext: "Contexte 2",
+					Tags:         []string{"road-trip"},
+				},
+			},
+			ErrorExpected: nil,
+			Expected:      "\n#Q4 (+0)\n<b>Content 1</b>\n\n<i>by Contexte 1</i>\n#cats #work\n__________________\n\n#Q5 (+0)\n<b>Content 2</b>\n\n<i>by Contexte 2</i>\n#road-trip",
+		},
+		{
+			Input: []c.QuoteResponse{
+				{
+					QuoteID:      7,
+					Votes:        2,
+					QuoteContext: "Bob",
+					Media:        c.Media{Type: c.MediaSticker, FileID: "CAAD"},
+				},
+			},
+			ErrorExpected: nil,
+			Expected:      "\n#Q7 (+2)\n<i>sticker</i>\n\n<i>by Bob</i>",
+		},
+		{
+			Input: []c.QuoteResponse{
+				{
+					QuoteID:      6,
+					Votes:        1,
+					Content:      "Alice: Who?\nBob: Me",
+					QuoteContext: "Alice, Bob",
+					Lines:        []c.QuoteLine{{SpeakerID: 1, Speaker: "Alice", Content: "Who?"}, {SpeakerID: 2, Speaker: "Bob", Content: "Me"}},
+					Tags:         []string{"food"},
+				},
+				{
+					QuoteID:      7,
+					Content:      "Content",
+					QuoteContext: "Contexte",
+				},
+			},
+			ErrorExpected: nil,
+			Expected:      "\n#Q6 (+1)\n<b>Alice:</b> Who?\n<b>Bob:</b> Me\n#food\n__________________\n\n#Q7 (+0)\n<b>Content</b>\n\n<i>by Contexte</i>",
 		},
 	}
 
@@ -300,18 +779,29 @@ func TestGenerateQuotesMessage(t *testing.T) {
 
 func TestGenerateNewQuoteMessage(t *testing.T) {
 	samples := []struct {
-		Input         c.AddQuoteRequest
+		Input         c.QuoteResponse
 		ErrorExpected error
 		Expected      string
 	}{
 		{
-			Input: c.AddQuoteRequest{
+			Input: c.QuoteResponse{
+				QuoteID:      102,
 				Author:       "9080987",
 				Content:      "<oij!jmoij>",
 				QuoteContext: "jj!|&$ù",
 			},
 			ErrorExpected: nil,
-			Expected:      "✅ New quote added ✅\n*<oij!jmoij>*\n\n_by jj!|&$ù_\n",
+			Expected:      "✅ New quote added ✅ #Q102\n<b>&lt;oij!jmoij&gt;</b>\n\n<i>by jj!|&amp;$ù</i>\n",
+		},
+		{
+			Input: c.QuoteResponse{
+				QuoteID:      103,
+				Content:      "Content",
+				QuoteContext: "Context",
+				Tags:         []string{"cats", "work"},
+			},
+			ErrorExpected: nil,
+			Expected:      "✅ New quote added ✅ #Q103\n<b>Content</b>\n\n<i>by Context</i>\n#cats #work\n",
 		},
 	}
 
@@ -327,6 +817,248 @@ func TestGenerateNewQuoteMessage(t *testing.T) {
 	}
 }
 
+func TestGenerateInlineResult(t *testing.T) {
+	long := strings.Repeat("ça ", 40)
+	samples := []struct {
+		Input       c.QuoteResponse
+		Title       string
+		Description string
+		Text        string
+	}{
+		{
+			Input:       c.QuoteResponse{QuoteID: 4, Content: "Coffee first,\n questions later", QuoteContext: "Alice", Votes: 2},
+			Title:       "Coffee first, questions later",
+			Description: "#Q4 (+2) by Alice",
+			Text:        "#Q4 (+2)\n<b>Coffee first,\n questions later</b>\n\n<i>by Alice</i>",
+		},
+		{
+			Input:       c.QuoteResponse{QuoteID: 5, Content: long, QuoteContext: "Bob", Votes: -1},
+			Title:       strings.Repeat("ça ", 21) + "…",
+			Description: "#Q5 (-1) by Bob",
+		},
+		{
+			Input:       c.QuoteResponse{QuoteID: 6, QuoteContext: "Carol", Media: c.Media{Type: c.MediaSticker, FileID: "CAAD"}},
+			Title:       "sticker",
+			Description: "#Q6 (+0) by Carol",
+		},
+	}
+
+	for _, sample := range samples {
+		result, err := GenerateInlineResult(sample.Input)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if result.Title != sample.Title || result.Description != sample.Description || result.ID != fmt.Sprint(sample.Input.QuoteID) {
+			t.Errorf("got %q %q %q, wanted %q %q", result.ID, result.Title, result.Description, sample.Title, sample.Description)
+		}
+		content, ok := (*result.Content).(*tb.InputTextMessageContent)
+		if !ok || content.ParseMode != tb.ModeHTML {
+			t.Errorf("got content %+v, wanted HTML text", *result.Content)
+			continue
+		}
+		if sample.Text != "" && content.Text != sample.Text {
+			t.Errorf("got %q, wanted %q", content.Text, sample.Text)
+		}
+	}
+}
+
+func TestGenerateConfirmQuoteMessage(t *testing.T) {
+	tmp, err := GenerateConfirmQuoteMessage(&tb.Chat{Title: "Friends"}, c.AddQuoteRequest{Content: "blabla", QuoteContext: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "📨 Publish this quote in Friends? 📨\n<b>blabla</b>\n\n<i>by Bob</i>\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateGroupMessage(t *testing.T) {
+	samples := []struct {
+		Private   bool
+		Choosable bool
+		Expected  string
+	}{
+		{Private: false, Choosable: false, Expected: "👥 Your commands here go to <b>Friends &amp; Co</b> 👥\n"},
+		{Private: true, Choosable: true, Expected: "👥 Your commands in private go to <b>Friends &amp; Co</b> 👥\nPick another one of your groups below.\n<i>The group picked is forgotten when the bot restarts, your private commands then go to your first group again.</i>\n"},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateGroupMessage(&tb.Chat{Title: "Friends & Co"}, sample.Private, sample.Choosable)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestGenerateForbiddenContextMessage(t *testing.T) {
+	samples := []struct {
+		Input         c.AddQuoteRequest
+		ErrorExpected error
+		Expected      string
+	}{
+		{
+			Input:         c.AddQuoteRequest{Content: "blabla", QuoteContext: "Anonyme"},
+			ErrorExpected: nil,
+			Expected:      "🚫 Quote not added 🚫\nYour context:\n<b>Anonyme</b>\n\nis forbidden\n",
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateForbiddenContextMessage(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v", err, sample.ErrorExpected)
+			continue
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestGenerateDuplicateQuoteMessage(t *testing.T) {
+	samples := []struct {
+		Input         c.AddQuoteRequest
+		Duplicate     c.ErrProbableDuplicate
+		ErrorExpected error
+		Expected      string
+		ExpectedIDs   []string
+	}{
+		{
+			Input:         c.AddQuoteRequest{Content: "blabla", QuoteContext: "Bob"},
+			Duplicate:     c.ErrProbableDuplicate{Matches: []search.Match{{QuoteID: 104, Similarity: 0.876}, {QuoteID: 12, Similarity: 0.5}}},
+			ErrorExpected: nil,
+			Expected:      "🚫 Quote not added 🚫\nYour quote:\n<b>blabla</b>\n\nis very similar to:\n#Q104 (88%)\n#Q12 (50%)\n\nTo add it anyway, send:\n<code>/addanyway blabla | Bob</code>\n",
+			ExpectedIDs:   []string{"104", "12"},
+		},
+		{
+			Input:         c.AddQuoteRequest{Content: "blabla", QuoteContext: "Bob"},
+			Duplicate:     c.ErrProbableDuplicate{Matches: []search.Match{{QuoteID: 104, Similarity: 1}}},
+			ErrorExpected: nil,
+			Expected:      "🚫 Quote not added 🚫\nYour quote:\n<b>blabla</b>\n\nis very similar to:\n#Q104 (100%)\n",
+			ExpectedIDs:   []string{"104"},
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateDuplicateQuoteMessage(sample.Input, sample.Duplicate)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v", err, sample.ErrorExpected)
+			continue
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+		if IDs := ExtractQuotesID(tmp); !areEquals(IDs, sample.ExpectedIDs) {
+			t.Errorf("got IDs %v from %q, wanted %v", IDs, tmp, sample.ExpectedIDs)
+		}
+	}
+}
+
+func TestAddAnywayCommand(t *testing.T) {
+	samples := []c.AddQuoteRequest{
+		{Content: "blabla", QuoteContext: "Bob"},
+		{Content: "blabla", QuoteContext: "Bob", Tags: []string{"work", "fun"}},
+		{Content: "Alice: hi\nBob: hello", QuoteContext: "Alice, Bob"},
+		{Content: "Alice: hi\nBob: hello\nAlice: bye", QuoteContext: "Alice, Bob", Tags: []string{"work"}},
+	}
+
+	s := &Server{}
+	for _, sample := range samples {
+		duplicate := c.ErrProbableDuplicate{Matches: []search.Match{{QuoteID: 104, Similarity: 0.9}}}
+		message, err := GenerateDuplicateQuoteMessage(sample, duplicate)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		// The command suggested adds the same quote
+		start := strings.Index(message, "<code>") + len("<code>")
+		end := strings.Index(message, "</code>")
+		command := html.UnescapeString(message[start:end])
+		quote, err := s.newQuote(&tb.Message{Text: command})
+		if err != nil {
+			t.Errorf("error %v should not have occured for %q", err, command)
+			continue
+		}
+		if quote.Content != sample.Content || quote.QuoteContext != sample.QuoteContext || fmt.Sprint(quote.Tags) != fmt.Sprint(sample.Tags) {
+			t.Errorf("got %+v from %q, wanted %+v", quote, command, sample)
+		}
+	}
+}
+
+func TestGenerateEditedQuoteMessage(t *testing.T) {
+	tmp, err := GenerateEditedQuoteMessage(c.QuoteResponse{QuoteID: 104, Content: "blabla", QuoteContext: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "✏️ Quote edited ✏️ #Q104\n<b>blabla</b>\n\n<i>by Bob</i>\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+
+	tmp, err = GenerateEditedQuoteMessage(c.QuoteResponse{QuoteID: 104, Content: "Alice: Who?\nBob: Me", Lines: []c.QuoteLine{{Speaker: "Alice", Content: "Who?"}, {Speaker: "Bob", Content: "Me"}}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected = "✏️ Quote edited ✏️ #Q104\n<b>Alice:</b> Who?\n<b>Bob:</b> Me\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateHistoryMessage(t *testing.T) {
+	revisions := []c.RevisionResponse{
+		{QuoteID: 104, Revision: 1, Content: "a quote", QuoteContext: "Bob", Editor: "alice", EditedAt: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)},
+		{QuoteID: 104, Revision: 2, Content: "the quote", QuoteContext: "Bob", Editor: "admin", EditedAt: time.Date(2021, 4, 5, 6, 7, 8, 0, time.UTC), Diff: "content: [-a-] {+the+} quote"},
+	}
+	tmp, err := GenerateHistoryMessage(c.UniqueSpecifiedQuoteRequest{QuoteID: 104}, revisions)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "📜 History of #Q104 📜\n<pre>\nr1 by alice on 2021-03-04 05:06\ncontent: a quote\ncontext: Bob\n\nr2 by admin on 2021-04-05 06:07\ncontent: [-a-] {&#43;the&#43;} quote\n</pre>\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateRevisionNotFoundMessage(t *testing.T) {
+	tmp, err := GenerateRevisionNotFoundMessage(c.RollbackQuoteRequest{QuoteID: 104, Revision: 3})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "🚫 Revision 3 of quote #Q104 not found 🚫\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateQuoteNotFoundMessage(t *testing.T) {
+	samples := []struct {
+		Input         c.UniqueSpecifiedQuoteRequest
+		ErrorExpected error
+		Expected      string
+	}{
+		{
+			Input:         c.UniqueSpecifiedQuoteRequest{QuoteID: 4},
+			ErrorExpected: nil,
+			Expected:      "🚫 Quote #Q4 not found 🚫\n",
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateQuoteNotFoundMessage(sample.Input)
+		if err != sample.ErrorExpected {
+			t.Errorf("got %v instead of %v", err, sample.ErrorExpected)
+			continue
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+	}
+}
+
 func TestGenerateDeleteQuoteMessage(t *testing.T) {
 	samples := []struct {
 		Input         c.UniqueSpecifiedQuoteRequest
@@ -352,6 +1084,208 @@ func TestGenerateDeleteQuoteMessage(t *testing.T) {
 	}
 }
 
+func TestGenerateTrashMessage(t *testing.T) {
+	quotes := []c.QuoteResponse{
+		{QuoteID: 104, Content: "a quote", QuoteContext: "Bob", DeletedAt: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), DeletedBy: "admin_1"},
+		{QuoteID: 102, Content: "old quote", QuoteContext: "Alice", DeletedAt: time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)},
+	}
+	samples := []struct {
+		Page     int
+		Quotes   []c.QuoteResponse
+		Next     int
+		Expected string
+	}{
+		{
+			Page:     1,
+			Quotes:   quotes,
+			Next:     2,
+			Expected: "🗑 Trash, page 1 🗑\n\n#Q104 deleted by <code>admin_1</code> on <code>2021-03-04 05:06</code>\n<b>a quote</b>\n<i>by Bob</i>\n\n#Q102 deleted by <code>someone</code> on <code>2021-02-03 04:05</code>\n<b>old quote</b>\n<i>by Alice</i>\n\n/trash 2 for the next page\n",
+		},
+		{
+			Page:     3,
+			Quotes:   nil,
+			Next:     0,
+			Expected: "🗑 Trash, page 3 🗑\n\nThe trash is empty\n",
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateTrashMessage(sample.Page, sample.Quotes, sample.Next)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestGenerateRestoredQuoteMessage(t *testing.T) {
+	tmp, err := GenerateRestoredQuoteMessage(c.QuoteResponse{QuoteID: 104, Content: "a quote", QuoteContext: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "♻️ Quote restored ♻️ #Q104\n<b>a quote</b>\n\n<i>by Bob</i>\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGeneratePurgedQuoteMessage(t *testing.T) {
+	tmp, err := GeneratePurgedQuoteMessage(c.UniqueSpecifiedQuoteRequest{QuoteID: 104})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "🔥 Quote purged : #Q104\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateTrashNotFoundMessage(t *testing.T) {
+	tmp, err := GenerateTrashNotFoundMessage(c.UniqueSpecifiedQuoteRequest{QuoteID: 104})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "🚫 Quote #Q104 is not in the trash 🚫\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateSpeakersMessage(t *testing.T) {
+	samples := []struct {
+		Speakers []c.SpeakerResponse
+		Expected string
+	}{
+		{
+			Speakers: []c.SpeakerResponse{{Name: "Bob", Aliases: []string{"Bobby", "Robert"}, Quotes: 3}, {Name: "Alice", Quotes: 1}},
+			Expected: "🗣 Speakers 🗣\n<b>Bob</b> (3) aka Bobby, Robert\n<b>Alice</b> (1)\n",
+		},
+		{
+			Speakers: nil,
+			Expected: "🗣 Speakers 🗣\nNobody has been quoted yet\n",
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateSpeakersMessage(sample.Speakers)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestGenerateAliasedSpeakerMessage(t *testing.T) {
+	tmp, err := GenerateAliasedSpeakerMessage(c.SpeakerResponse{Name: "Bob", Aliases: []string{"Bobby", "Robert"}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "✅ Speaker <b>Bob</b> is also known as Bobby, Robert\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateMergedSpeakersMessage(t *testing.T) {
+	tmp, err := GenerateMergedSpeakersMessage(c.SpeakerResponse{Name: "Bob", Aliases: []string{"Bobby"}, Quotes: 5})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "✅ Speakers merged into <b>Bob</b> ✅\n5 quotes, also known as Bobby\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateAliasTakenMessage(t *testing.T) {
+	tmp, err := GenerateAliasTakenMessage(c.AliasSpeakerRequest{Alias: "Bobby", Speaker: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "🚫 Bobby is already another speaker 🚫\nTo make them one, send:\n<code>/mergespeakers Bobby | Bob</code>\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateSpeakerNotFoundMessage(t *testing.T) {
+	tmp, err := GenerateSpeakerNotFoundMessage("Zoe", "Bob")
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "🚫 Speaker Zoe or Bob not found 🚫\n"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
+func TestGenerateTagsMessage(t *testing.T) {
+	samples := []struct {
+		Tags     []c.TagResponse
+		Expected string
+	}{
+		{
+			Tags:     []c.TagResponse{{Tag: "work", Quotes: 3}, {Tag: "cats", Quotes: 1}},
+			Expected: "🏷 Tags 🏷\n#work (3)\n#cats (1)\n",
+		},
+		{
+			Tags:     nil,
+			Expected: "🏷 Tags 🏷\nNo quote has been tagged yet\n",
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateTagsMessage(sample.Tags)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestGenerateTaggedQuoteMessage(t *testing.T) {
+	samples := []struct {
+		Quote    c.QuoteResponse
+		Expected string
+	}{
+		{
+			Quote:    c.QuoteResponse{QuoteID: 4, Tags: []string{"cats", "work"}},
+			Expected: "🏷 Quote tagged 🏷 #Q4\n#cats #work",
+		},
+		{
+			Quote:    c.QuoteResponse{QuoteID: 4},
+			Expected: "🏷 Quote tagged 🏷 #Q4\nThe quote has no tag anymore",
+		},
+	}
+
+	for _, sample := range samples {
+		tmp, err := GenerateTaggedQuoteMessage(sample.Quote)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if tmp != sample.Expected {
+			t.Errorf("got %q, wanted %q", tmp, sample.Expected)
+		}
+	}
+}
+
+func TestGenerateInvalidTagMessage(t *testing.T) {
+	tmp, err := GenerateInvalidTagMessage([]string{"42", "not a tag"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := "🚫 42, not a tag cannot be used as a tag 🚫\nTags are words of letters, digits and dashes with at least one letter, like #road-trip"
+	if tmp != expected {
+		t.Errorf("got %q, wanted %q", tmp, expected)
+	}
+}
+
 func TestGenerateVoteAddedMessage(t *testing.T) {
 	samples := []struct {
 		Input         c.VoteQuoteRequest
@@ -361,7 +1295,7 @@ func TestGenerateVoteAddedMessage(t *testing.T) {
 		{
 			Input:         c.VoteQuoteRequest{QuoteID: 12},
 			ErrorExpected: nil,
-			Expected:      "✅ *Vote Registered ✅\nYour vote about the quote #Q12 has been registered.",
+			Expected:      "✅ <b>Vote registered</b> ✅\nYour vote about the quote #Q12 has been registered.",
 		},
 	}
 
@@ -386,7 +1320,7 @@ func TestGenerateVoteRemovedMessage(t *testing.T) {
 		{
 			Input:         c.VoteQuoteRequest{QuoteID: 15},
 			ErrorExpected: nil,
-			Expected:      "✅ *Vote removed* ✅\nYou have successfully removed your vote on the quote #Q15.",
+			Expected:      "✅ <b>Vote removed</b> ✅\nYou have successfully removed your vote on the quote #Q15.",
 		},
 	}
 
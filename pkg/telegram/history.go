@@ -0,0 +1,64 @@
+package telegram
+
+import (
+	"sync"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// historySize is the number of recent messages kept per group
+const historySize = 50
+
+// maxThreadLength is the number of messages a reply can quote at most
+const maxThreadLength = 10
+
+// history keeps the last text messages of each group, Telegram offering no way
+// to fetch the messages following the one a /add replies to
+type history struct {
+	mu       sync.Mutex
+	messages map[int64][]*tb.Message
+}
+
+// record keeps the message when it was sent in a group
+func (h *history) record(m *tb.Message) {
+	if m.Chat == nil || m.Chat.Type == tb.ChatPrivate {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.messages == nil {
+		h.messages = make(map[int64][]*tb.Message)
+	}
+	messages := append(h.messages[m.Chat.ID], m)
+	if len(messages) > historySize {
+		messages = append([]*tb.Message(nil), messages[len(messages)-historySize:]...)
+	}
+	h.messages[m.Chat.ID] = messages
+}
+
+// thread returns the first message and the ones sent after it in its group, n
+// messages in order, fewer when the following ones were not seen
+func (h *history) thread(first *tb.Message, n int) []*tb.Message {
+	thread := []*tb.Message{first}
+	if first.Chat == nil {
+		return thread
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	messages := h.messages[first.Chat.ID]
+	for i, m := range messages {
+		if m.ID != first.ID {
+			continue
+		}
+		for _, next := range messages[i+1:] {
+			if len(thread) >= n {
+				break
+			}
+			thread = append(thread, next)
+		}
+		break
+	}
+	return thread
+}
@@ -0,0 +1,53 @@
+package telegram
+
+import (
+	"testing"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func threadIDs(messages []*tb.Message) []int {
+	ids := make([]int, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestHistoryThread(t *testing.T) {
+	group := &tb.Chat{ID: -100, Type: tb.ChatSuperGroup}
+	other := &tb.Chat{ID: -200, Type: tb.ChatGroup}
+	var h history
+	for id := 1; id <= historySize+5; id++ {
+		h.record(&tb.Message{ID: id, Chat: group})
+		h.record(&tb.Message{ID: 1000 + id, Chat: other})
+	}
+	h.record(&tb.Message{ID: 2000, Chat: &tb.Chat{ID: 1, Type: tb.ChatPrivate}})
+
+	samples := []struct {
+		First    *tb.Message
+		N        int
+		Expected []int
+	}{
+		{First: &tb.Message{ID: 20, Chat: group}, N: 3, Expected: []int{20, 21, 22}},
+		{First: &tb.Message{ID: historySize + 4, Chat: group}, N: 3, Expected: []int{historySize + 4, historySize + 5}},
+		// The oldest messages are forgotten
+		{First: &tb.Message{ID: 2, Chat: group}, N: 3, Expected: []int{2}},
+		{First: &tb.Message{ID: 2000, Chat: &tb.Chat{ID: 1, Type: tb.ChatPrivate}}, N: 2, Expected: []int{2000}},
+		{First: &tb.Message{ID: 1020}, N: 2, Expected: []int{1020}},
+	}
+
+	for _, sample := range samples {
+		ids := threadIDs(h.thread(sample.First, sample.N))
+		if len(ids) != len(sample.Expected) {
+			t.Errorf("got %v, wanted %v", ids, sample.Expected)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != sample.Expected[i] {
+				t.Errorf("got %v, wanted %v", ids, sample.Expected)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package telegram
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	c "goquotebot/pkg/storages"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// inlinePageSize is the number of quotes answering an inline query, the
+	// next ones come with the next offset
+	inlinePageSize = 20
+	// maxInlineResults is the number of quotes an inline query pages through at most
+	maxInlineResults = 100
+	// inlineCacheTTL is how long the quotes found for an inline query are
+	// kept, by the bot for its next pages and by Telegram for the user
+	inlineCacheTTL = time.Minute
+	// inlineTitleLength is the number of characters of a quote titling its result
+	inlineTitleLength = 64
+)
+
+// inlineKey is an inline query as cached, its terms within a group
+type inlineKey struct {
+	chatID int64
+	terms  string
+}
+
+type inlineEntry struct {
+	quotes  []c.QuoteResponse
+	expires time.Time
+}
+
+// inlineResults keeps the quotes found for the recent inline queries, their
+// pages being taken from the same results, whose order random word searches
+// would not keep
+type inlineResults struct {
+	mu      sync.Mutex
+	entries map[inlineKey]inlineEntry
+}
+
+// get returns the quotes found for the query if they are still cached
+func (r *inlineResults) get(key inlineKey) ([]c.QuoteResponse, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.quotes, true
+}
+
+// add keeps the quotes found for the query for inlineCacheTTL
+func (r *inlineResults) add(key inlineKey, quotes []c.QuoteResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries == nil {
+		r.entries = make(map[inlineKey]inlineEntry)
+	}
+	now := time.Now()
+	for k, entry := range r.entries {
+		if now.After(entry.expires) {
+			delete(r.entries, k)
+		}
+	}
+	r.entries[key] = inlineEntry{quotes: quotes, expires: now.Add(inlineCacheTTL)}
+}
+
+// InlineQuery answers @bot <terms> from any chat with the quotes of the group
+// of the user matching the terms, or the last quotes without terms
+func (s *Server) InlineQuery(ctx context.Context, q *tb.Query) (*tb.QueryResponse, error) {
+	response := &tb.QueryResponse{Results: tb.Results{}, CacheTime: int(inlineCacheTTL / time.Second), IsPersonal: true}
+
+	group, _, err := s.resolveGroup(&tb.Message{Sender: &q.From})
+	if err != nil {
+		s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", group), zap.Any("user", q.From))
+		return nil, err
+	}
+	if group == nil {
+		s.Logger.Info("unauthorized user queried the bot", zap.Any("user", q.From), zap.String("query", q.Text))
+		return response, nil
+	}
+
+	key := inlineKey{chatID: group.ID, terms: strings.Join(strings.Fields(strings.ToLower(q.Text)), " ")}
+	quotes, ok := s.inline.get(key)
+	if !ok {
+		quotes, err = s.searchInline(ctx, key)
+		if err != nil {
+			s.Logger.Error("failed to search quotes", zap.Error(err), zap.String("query", q.Text))
+			return nil, err
+		}
+		s.inline.add(key, quotes)
+	}
+
+	page, next := inlinePage(quotes, q.Offset)
+	for _, quote := range page {
+		result, err := GenerateInlineResult(quote)
+		if err != nil {
+			s.Logger.Error("failed to generate quote message", zap.Error(err), zap.Any("quote", quote))
+			return nil, err
+		}
+		response.Results = append(response.Results, result)
+	}
+	response.NextOffset = next
+	return response, nil
+}
+
+// searchInline finds the quotes of an inline query: the closest ones to its
+// terms then the other ones containing them
+func (s *Server) searchInline(ctx context.Context, key inlineKey) ([]c.QuoteResponse, error) {
+	if key.terms == "" {
+		return (*s.DB).GetLastQuotes(ctx, c.MultipleUnspecifiedQuotesRequest{ChatID: key.chatID, QuoteNb: maxInlineResults})
+	}
+
+	request := c.SearchExpressionRequest{ChatID: key.chatID, Expression: key.terms, QuoteNb: maxInlineResults}
+	quotes, err := (*s.DB).SearchExpression(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	words, err := (*s.DB).SearchWord(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[int]bool, len(quotes))
+	for _, quote := range quotes {
+		found[quote.QuoteID] = true
+	}
+	for _, quote := range words {
+		if len(quotes) >= maxInlineResults {
+			break
+		}
+		if !found[quote.QuoteID] {
+			found[quote.QuoteID] = true
+			quotes = append(quotes, quote)
+		}
+	}
+	return quotes, nil
+}
+
+// inlinePage returns the page of the quotes starting at the offset sent by
+// Telegram, and the offset of the next page, empty after the last one
+func inlinePage(quotes []c.QuoteResponse, offset string) ([]c.QuoteResponse, string) {
+	start, err := strconv.Atoi(offset)
+	if err != nil || start < 0 {
+		start = 0
+	}
+	if start >= len(quotes) {
+		return nil, ""
+	}
+	end := start + inlinePageSize
+	if end >= len(quotes) {
+		return quotes[start:], ""
+	}
+	return quotes[start:end], strconv.Itoa(end)
+}
@@ -0,0 +1,106 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	c "goquotebot/pkg/storages"
+)
+
+func TestInlineResults(t *testing.T) {
+	var r inlineResults
+	key := inlineKey{chatID: 1, terms: "coffee"}
+	if _, ok := r.get(key); ok {
+		t.Fatalf("got results for a query never cached")
+	}
+
+	r.add(key, []c.QuoteResponse{{QuoteID: 1}})
+	quotes, ok := r.get(key)
+	if !ok || len(quotes) != 1 {
+		t.Errorf("got %v, wanted the cached quotes", quotes)
+	}
+	// The same terms are another query in another group
+	if _, ok = r.get(inlineKey{chatID: 2, terms: "coffee"}); ok {
+		t.Errorf("got the results of another group")
+	}
+
+	r.entries[key] = inlineEntry{quotes: quotes, expires: time.Now().Add(-time.Second)}
+	if _, ok = r.get(key); ok {
+		t.Errorf("got expired results")
+	}
+	r.add(inlineKey{chatID: 1, terms: "tea"}, nil)
+	if _, ok = r.entries[key]; ok {
+		t.Errorf("expired results should have been dropped")
+	}
+}
+
+func TestInlinePage(t *testing.T) {
+	quotes := make([]c.QuoteResponse, 45)
+	for i := range quotes {
+		quotes[i].QuoteID = i + 1
+	}
+	samples := []struct {
+		Offset   string
+		First    int
+		Length   int
+		Expected string
+	}{
+		{Offset: "", First: 1, Length: 20, Expected: "20"},
+		{Offset: "20", First: 21, Length: 20, Expected: "40"},
+		{Offset: "40", First: 41, Length: 5, Expected: ""},
+		{Offset: "45", Length: 0, Expected: ""},
+		{Offset: "nope", First: 1, Length: 20, Expected: "20"},
+	}
+
+	for _, sample := range samples {
+		page, next := inlinePage(quotes, sample.Offset)
+		if len(page) != sample.Length || next != sample.Expected {
+			t.Errorf("got %d quotes and offset %q for %q, wanted %d and %q", len(page), next, sample.Offset, sample.Length, sample.Expected)
+			continue
+		}
+		if len(page) > 0 && page[0].QuoteID != sample.First {
+			t.Errorf("got #Q%d first for %q, wanted #Q%d", page[0].QuoteID, sample.Offset, sample.First)
+		}
+	}
+}
+
+func TestSearchInline(t *testing.T) {
+	ctx := context.Background()
+	var db c.DB = c.NewMemoryStore()
+	for _, quote := range []c.AddQuoteRequest{
+		{ChatID: 1, Content: "Coffee first, questions later", QuoteContext: "Alice"},
+		{ChatID: 1, Content: "My mug says I love coffee", QuoteContext: "Bob"},
+		{ChatID: 1, Content: "Tea is just leaf soup", QuoteContext: "Carol"},
+		{ChatID: 2, Content: "Coffee in the other group", QuoteContext: "Dave"},
+	} {
+		_, err := db.AddQuote(ctx, quote)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+	}
+	s := &Server{DB: &db}
+
+	quotes, err := s.searchInline(ctx, inlineKey{chatID: 1, terms: "coffee"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	seen := make(map[string]bool)
+	for _, quote := range quotes {
+		if seen[quote.Content] || quote.ChatID != 1 {
+			t.Errorf("got %+v twice or from another group", quote)
+		}
+		seen[quote.Content] = true
+	}
+	if !seen["Coffee first, questions later"] || !seen["My mug says I love coffee"] {
+		t.Errorf("got %v, wanted both coffee quotes", seen)
+	}
+
+	last, err := s.searchInline(ctx, inlineKey{chatID: 1})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if len(last) != 3 {
+		t.Errorf("got %d quotes without terms, wanted the 3 last ones", len(last))
+	}
+}
@@ -9,6 +9,7 @@ var (
 	commandsReceived *prometheus.CounterVec
 	messagesReceived prometheus.Counter
 	commandsTriggers *prometheus.CounterVec
+	quotesPurged     prometheus.Counter
 )
 
 func init() {
@@ -26,4 +27,9 @@ func init() {
 		Name: "command_triggered_counter",
 		Help: "The number of trigger of each command with the resulting status code",
 	}, []string{"command", "status"})
+
+	quotesPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "trash_quotes_purged",
+		Help: "The total number of deleted quotes purged after the retention period",
+	})
 }
@@ -1,11 +1,11 @@
 package telegram
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"goquotebot/internal/monitoring/metrics"
 	"goquotebot/pkg/config"
-	"os"
+	"sync"
 	"time"
 
 	c "goquotebot/pkg/storages"
@@ -16,52 +16,99 @@ import (
 )
 
 type Server struct {
-	Bot    *tb.Bot
-	DB     *c.DB
-	Chat   *tb.Chat
+	Bot *tb.Bot
+	DB  *c.DB
+	// Chats are the groups served by the bot, a DM reaches the group its sender
+	// picked with /group, else their first one
+	Chats  []*tb.Chat
 	Logger *zap.Logger
 	ms     *metrics.MonitoringServer
+
+	// ctx is canceled by Stop to abort in-flight requests
+	ctx            context.Context
+	cancel         context.CancelFunc
+	requestTimeout time.Duration
+	inFlight       sync.WaitGroup
+
+	// retention is how long deleted quotes are kept, jobs tracks the background purge
+	retention time.Duration
+	jobs      sync.WaitGroup
+
+	// history keeps the recent messages of the groups, for /add to quote a thread
+	history history
+	// pending keeps the forwarded quotes waiting for their confirmation
+	pending pendingQuotes
+	// inline keeps the quotes found for the recent inline queries
+	inline inlineResults
+	// listings keeps the listings browsed page by page
+	listings listings
+	// choices keeps the group each user picked for their DMs
+	choices groupChoices
 }
 
 func NewServer(logger *zap.Logger, cfg *config.Config) (*Server, error) {
 	b, err := tb.NewBot(tb.Settings{
 		Token:     cfg.Telegram.Token,
 		Poller:    &tb.LongPoller{Timeout: 1 * time.Second},
-		ParseMode: tb.ModeMarkdown,
+		ParseMode: tb.ModeHTML,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	chat, err := b.ChatByID(cfg.Telegram.GroupID)
+	chats, err := groupChats(b, cfg.Telegram.GroupID, cfg.Telegram.Groups)
 	if err != nil {
 		return nil, err
 	}
+	if len(chats) == 0 {
+		return nil, errors.New("telegram.groups must be set")
+	}
 
-	path, err := localizeDB()
+	db, err := c.NewDB(cfg.Storage)
 	if err != nil {
 		return nil, err
 	}
-	pathDB := fmt.Sprintf("%squotes.db", path)
-	db, err := c.NewSqliteWrapper(pathDB)
-	if err != nil {
-		return nil, err
+
+	// The quotes stored before the groups were recorded belong to the legacy group
+	if cfg.Telegram.GroupID != "" {
+		adopted, err := db.AdoptQuotes(context.Background(), chats[0].ID)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if adopted > 0 {
+			logger.Info("moved the quotes to the legacy group", zap.Int("quotes", adopted), zap.Int64("chat", chats[0].ID))
+		}
+	}
+
+	requestTimeout := cfg.Telegram.RequestTimeout
+	if requestTimeout == 0 {
+		requestTimeout = 5 * time.Second
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	server := &Server{
-		Bot:    b,
-		DB:     &db,
-		Chat:   chat,
-		Logger: logger,
+		Bot:            b,
+		DB:             &db,
+		Chats:          chats,
+		Logger:         logger,
+		ctx:            ctx,
+		cancel:         cancel,
+		requestTimeout: requestTimeout,
+		retention:      cfg.Storage.Retention,
 	}
 
 	err = server.RegisterRoutes()
 	if err != nil {
+		cancel()
+		db.Close()
 		return nil, err
 	}
 
 	ms, err := metrics.StartMonitoringServer(logger, cfg.Metrics)
 	if err != nil {
+		cancel()
+		db.Close()
 		return nil, err
 	}
 
@@ -70,31 +117,28 @@ func NewServer(logger *zap.Logger, cfg *config.Config) (*Server, error) {
 	return server, nil
 }
 
-func localizeDB() (string, error) {
-	pathsToTry := []string{"sqlite/", "../../cmd/goquote/"}
-	for _, path := range pathsToTry {
-		if checkIfFolderExists(path) {
-			return path, nil
-		}
-	}
-	return "", errors.New("DB folder not found")
-}
-
-func checkIfFolderExists(path string) bool {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false
+func (s *Server) Start() {
+	if s.retention > 0 {
+		s.jobs.Add(1)
+		go s.purgeTrash()
 	}
-	return true
+	s.Bot.Start()
 }
 
-func (s *Server) Start() {
-	s.Bot.Start()
+// NewRequestContext returns the context bounding the handling of one update
+func (s *Server) NewRequestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.requestTimeout)
 }
 
 func (s *Server) Stop() error {
 	var errs error
 
+	// Abort the in-flight requests and wait for their handlers to return
+	s.cancel()
+	s.Bot.Stop()
+	s.inFlight.Wait()
+	s.jobs.Wait()
+
 	err := (*s.DB).Close()
 	if err != nil {
 		s.Logger.Error("failed to close the DB server")
@@ -107,7 +151,5 @@ func (s *Server) Stop() error {
 		errs = multierror.Append(errs, err)
 	}
 
-	s.Bot.Stop()
-
 	return errs
 }
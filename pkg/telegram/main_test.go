@@ -1,11 +1,15 @@
 package telegram
 
 import (
+	"context"
 	"errors"
 	"goquotebot/pkg/config"
+	c "goquotebot/pkg/storages"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
 )
 
 func TestNewServer(t *testing.T) {
@@ -42,3 +46,83 @@ func TestNewServer(t *testing.T) {
 		}
 	}
 }
+
+func TestNewRequestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &Server{
+		ctx:            ctx,
+		cancel:         cancel,
+		requestTimeout: time.Minute,
+	}
+
+	requestCtx, requestCancel := server.NewRequestContext()
+	defer requestCancel()
+
+	deadline, ok := requestCtx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("got deadline %v, expected one within a minute", deadline)
+	}
+
+	// Stopping the server cancels the requests in flight
+	server.cancel()
+	if requestCtx.Err() != context.Canceled {
+		t.Errorf("got %v instead of %v", requestCtx.Err(), context.Canceled)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := c.DB(c.NewMemoryStore())
+	quote, err := db.AddQuote(context.Background(), c.AddQuoteRequest{Author: "alice", Content: "I never said I was a morning person", QuoteContext: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	err = db.DeleteQuote(context.Background(), c.DeleteQuoteRequest{QuoteID: quote.QuoteID, Deleter: "alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &Server{
+		DB:             &db,
+		Logger:         zap.NewNop(),
+		ctx:            ctx,
+		cancel:         cancel,
+		requestTimeout: time.Minute,
+		retention:      time.Nanosecond,
+	}
+	server.jobs.Add(1)
+	go server.purgeTrash()
+
+	// The trash is purged as soon as the job starts
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		trash, err := db.GetTrash(context.Background(), c.TrashRequest{QuoteNb: 10})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if len(trash) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d quotes in the trash, it should have been purged", len(trash))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stopping the server stops the job
+	server.cancel()
+	server.jobs.Wait()
+}
+
+func TestGroupContext(t *testing.T) {
+	ctx := context.Background()
+	if groupOf(ctx) != nil || groupID(ctx) != 0 {
+		t.Errorf("got group %v, wanted none", groupOf(ctx))
+	}
+
+	group := &tb.Chat{ID: -111, Type: tb.ChatGroup}
+	ctx = withGroup(ctx, group)
+	if groupOf(ctx) != group || groupID(ctx) != -111 {
+		t.Errorf("got group %v, wanted %v", groupOf(ctx), group)
+	}
+}
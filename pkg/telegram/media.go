@@ -0,0 +1,124 @@
+package telegram
+
+import (
+	"context"
+
+	c "goquotebot/pkg/storages"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// messageLimit is the length Telegram accepts for a message, in UTF-16 code units
+	messageLimit = 4096
+	// captionLimit is the length Telegram accepts for the caption of a media
+	captionLimit = 1024
+)
+
+// MediaMessage quotes the photos, voice notes and videos sent with an /add
+// caption, and the media forwarded to the bot in DM
+func (s *Server) MediaMessage(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+	if m.Chat != nil && m.Chat.Type == tb.ChatPrivate && m.OriginalUnixtime != 0 {
+		return s.ForwardedQuote(ctx, m)
+	}
+	return s.AddQuote(ctx, m)
+}
+
+// sendQuote sends a quote with its vote buttons, see post
+func (s *Server) sendQuote(ctx context.Context, to tb.Recipient, quote c.QuoteResponse, text string) (*tb.Message, error) {
+	return s.post(ctx, to, []c.QuoteResponse{quote}, text)
+}
+
+// sendQuotes sends the quotes in order, the text ones together in as few
+// messages as they fit in and each media one on its own
+func (s *Server) sendQuotes(ctx context.Context, to tb.Recipient, quotes []c.QuoteResponse) (*tb.Message, error) {
+	if len(quotes) == 0 {
+		response, err := GenerateQuotesMessage(quotes)
+		if err != nil {
+			return nil, err
+		}
+		return s.sendText(to, response)
+	}
+
+	var sent *tb.Message
+	for _, batch := range quoteBatches(quotes) {
+		messages, err := renderQuotes(batch, messageLimit)
+		if err != nil {
+			s.Logger.Error("failed to generate quotes message", zap.Error(err), zap.Any("quotes", batch))
+			return nil, err
+		}
+		for _, message := range messages {
+			sent, err = s.post(ctx, to, message.Quotes, message.Text)
+			if err != nil {
+				return sent, err
+			}
+		}
+	}
+	return sent, nil
+}
+
+// post sends the text of quotes with their vote buttons, or the media of a
+// quote again with the text as caption. Stickers and the texts too long for
+// a caption follow their media as a reply to it. The message holding the text
+// is recorded to show the new scores after the votes.
+func (s *Server) post(ctx context.Context, to tb.Recipient, quotes []c.QuoteResponse, text string) (*tb.Message, error) {
+	markup := voteMarkup(quotes)
+	caption := text
+	if len(quotes) > 1 || quotes[0].Media.Type == c.MediaSticker || textLength(caption) > captionLimit {
+		caption = ""
+	}
+
+	var sent *tb.Message
+	var err error
+	switch {
+	case quotes[0].Media.IsZero():
+		sent, err = s.sendText(to, text, markup)
+	case caption != "":
+		sent, err = s.withPlainText(caption, func(caption string) (*tb.Message, error) {
+			return s.Bot.Send(to, mediaMessage(quotes[0].Media, caption), markup)
+		})
+	default:
+		sent, err = s.Bot.Send(to, mediaMessage(quotes[0].Media, ""))
+		if err != nil {
+			return sent, err
+		}
+		sent, err = s.sendText(to, text, &tb.SendOptions{ReplyTo: sent, ReplyMarkup: markup})
+	}
+	if err != nil {
+		return sent, err
+	}
+	s.recordPost(ctx, sent, quotes, !quotes[0].Media.IsZero() && caption != "")
+	return sent, nil
+}
+
+// mediaMessage returns the media to send again with its caption, stickers
+// having none
+func mediaMessage(media c.Media, caption string) tb.Sendable {
+	file := tb.File{FileID: media.FileID}
+	switch media.Type {
+	case c.MediaPhoto:
+		return &tb.Photo{File: file, Caption: caption}
+	case c.MediaVoice:
+		return &tb.Voice{File: file, Caption: caption}
+	case c.MediaVideo:
+		return &tb.Video{File: file, Caption: caption}
+	default:
+		return &tb.Sticker{File: file}
+	}
+}
+
+// quoteBatches splits the quotes in the messages sending them, in order: the
+// consecutive text quotes together and each media quote on its own
+func quoteBatches(quotes []c.QuoteResponse) [][]c.QuoteResponse {
+	var batches [][]c.QuoteResponse
+	for len(quotes) > 0 {
+		n := 1
+		for quotes[0].Media.IsZero() && n < len(quotes) && quotes[n].Media.IsZero() {
+			n++
+		}
+		batches = append(batches, quotes[:n])
+		quotes = quotes[n:]
+	}
+	return batches
+}
@@ -0,0 +1,29 @@
+package telegram
+
+import (
+	"fmt"
+	"testing"
+
+	c "goquotebot/pkg/storages"
+)
+
+func TestQuoteBatches(t *testing.T) {
+	photo := c.Media{Type: c.MediaPhoto, FileID: "AgAD"}
+	quotes := []c.QuoteResponse{{QuoteID: 1}, {QuoteID: 2}, {QuoteID: 3, Media: photo}, {QuoteID: 4, Media: photo}, {QuoteID: 5}}
+
+	var got [][]int
+	for _, batch := range quoteBatches(quotes) {
+		var IDs []int
+		for _, quote := range batch {
+			IDs = append(IDs, quote.QuoteID)
+		}
+		got = append(got, IDs)
+	}
+	expected := [][]int{{1, 2}, {3}, {4}, {5}}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("got batches %v, wanted %v", got, expected)
+	}
+	if len(quoteBatches(nil)) != 0 {
+		t.Errorf("no quote should give no batch")
+	}
+}
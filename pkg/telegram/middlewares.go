@@ -1,50 +1,68 @@
 package telegram
 
 import (
+	"context"
+
 	"go.uber.org/zap"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
-func Anyone(s *Server, m *tb.Message, f func(*tb.Message) (*tb.Message, error)) func(*tb.Message) (*tb.Message, error) {
+func Anyone(s *Server, m *tb.Message, f Handler) Handler {
 	return f
 }
 
-func MustBeMember(s *Server, m *tb.Message, f func(*tb.Message) (*tb.Message, error)) func(*tb.Message) (*tb.Message, error) {
-	member, err := s.Bot.ChatMemberOf(s.Chat, m.Sender)
+func MustBeMember(s *Server, m *tb.Message, f Handler) Handler {
+	group, member, err := s.resolveGroup(m)
 	if err != nil {
-		return func(t *tb.Message) (*tb.Message, error) {
-			s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", s.Chat), zap.Any("user", m.Sender))
+		return func(ctx context.Context, t *tb.Message) (*tb.Message, error) {
+			s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", group), zap.Any("user", m.Sender))
 			return nil, err
 		}
 	}
 
-	if !isAtLeastMember(member) {
-		return func(t *tb.Message) (*tb.Message, error) {
-			s.Bot.Send(t.Sender, "You must be at least a registered member to do this.")
+	if group == nil || !isAtLeastMember(member) {
+		return func(ctx context.Context, t *tb.Message) (*tb.Message, error) {
+			s.sendText(t.Sender, "You must be at least a registered member to do this.")
 			s.Logger.Info("unauthorized user spoke to the bot", zap.Any("user", t.Sender), zap.String("message", t.Text))
 			return nil, nil
 		}
 	}
 
-	return f
+	return inGroup(group, f)
 }
 
-func MustBeAdministrator(s *Server, m *tb.Message, f func(*tb.Message) (*tb.Message, error)) func(*tb.Message) (*tb.Message, error) {
-	member, err := s.Bot.ChatMemberOf(s.Chat, m.Sender)
+func MustBeAdministrator(s *Server, m *tb.Message, f Handler) Handler {
+	group, member, err := s.resolveGroup(m)
 	if err != nil {
-		return func(t *tb.Message) (*tb.Message, error) {
-			s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", s.Chat), zap.Any("user", m.Sender))
+		return func(ctx context.Context, t *tb.Message) (*tb.Message, error) {
+			s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", group), zap.Any("user", m.Sender))
 			return nil, err
 		}
 	}
 
-	if !isAtLeastAdmin(member) {
-		return func(t *tb.Message) (*tb.Message, error) {
-			s.Bot.Send(t.Sender, "You must be at least an administrator to do this.")
+	if group == nil || !isAtLeastAdmin(member) {
+		return func(ctx context.Context, t *tb.Message) (*tb.Message, error) {
+			s.sendText(t.Sender, "You must be at least an administrator to do this.")
 			s.Logger.Info("unauthorized user spoke to the bot", zap.Any("user", t.Sender), zap.String("message", t.Text))
 			return nil, nil
 		}
 	}
 
-	return f
+	return inGroup(group, f)
+}
+
+// inGroup scopes the handler to the group
+func inGroup(group *tb.Chat, f Handler) Handler {
+	return func(ctx context.Context, m *tb.Message) (*tb.Message, error) {
+		return f(withGroup(ctx, group), m)
+	}
+}
+
+// IsAdministrator tells whether the user administrates the group
+func (s *Server) IsAdministrator(group *tb.Chat, user *tb.User) (bool, error) {
+	member, err := s.Bot.ChatMemberOf(group, user)
+	if err != nil {
+		return false, err
+	}
+	return isAtLeastAdmin(member), nil
 }
@@ -0,0 +1,254 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	c "goquotebot/pkg/storages"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// pageSize is the number of quotes a page of a listing shows at most
+	pageSize = 10
+	// listingTTL is how long the pages of a listing can be browsed
+	listingTTL = 24 * time.Hour
+)
+
+var (
+	previousPageButton = tb.InlineButton{Unique: "previouspage", Text: "◀️"}
+	nextPageButton     = tb.InlineButton{Unique: "nextpage", Text: "▶️"}
+)
+
+// listQuotes fetches at most n quotes of a listing, after the offset
+type listQuotes func(ctx context.Context, offset, n int) ([]c.QuoteResponse, error)
+
+// messageKey is a message of a chat
+type messageKey struct {
+	chatID    int64
+	messageID int
+}
+
+// listing is the quotes of a command browsed page by page in the same message
+type listing struct {
+	fetch  listQuotes
+	chatID int64
+	// limit is the number of quotes asked by the command
+	limit int
+	// starts are the offsets of the pages found so far, as many quotes as fit
+	// in a message being shown on each
+	starts []int
+	// page is the page the message shows
+	page    int
+	message messageKey
+	expires time.Time
+}
+
+// listings holds the listings sent recently, by token
+type listings struct {
+	mu      sync.Mutex
+	entries map[string]*listing
+}
+
+// add keeps the listing for listingTTL and returns the token of its buttons
+func (l *listings) add(entry listing) (string, error) {
+	random := make([]byte, 8)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries == nil {
+		l.entries = make(map[string]*listing)
+	}
+	now := time.Now()
+	for key, listed := range l.entries {
+		if now.After(listed.expires) {
+			delete(l.entries, key)
+		}
+	}
+	entry.expires = now.Add(listingTTL)
+	l.entries[token] = &entry
+	return token, nil
+}
+
+// get returns a copy of the listing of the token if it has not expired
+func (l *listings) get(token string) (listing, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[token]
+	if !ok || time.Now().After(entry.expires) {
+		return listing{}, false
+	}
+	listed := *entry
+	listed.starts = append([]int(nil), entry.starts...)
+	return listed, true
+}
+
+// show records that the message shows the page of the listing, followed by a
+// page starting at next unless next is negative
+func (l *listings) show(token string, page, next int, message messageKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[token]
+	if !ok || page >= len(entry.starts) {
+		return
+	}
+	entry.starts = entry.starts[:page+1]
+	if next >= 0 {
+		entry.starts = append(entry.starts, next)
+	}
+	entry.page = page
+	entry.message = message
+}
+
+// navigation returns the page buttons of the message if it shows a listing
+func (l *listings) navigation(message messageKey) []tb.InlineButton {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for token, entry := range l.entries {
+		if entry.message == message && !now.After(entry.expires) {
+			return pageButtons(token, entry.page, len(entry.starts) > entry.page+1)
+		}
+	}
+	return nil
+}
+
+// pageButtons returns the buttons turning to the previous and the next page
+func pageButtons(token string, page int, next bool) []tb.InlineButton {
+	var row []tb.InlineButton
+	if page > 0 {
+		row = append(row, *previousPageButton.With(fmt.Sprintf("%s:%d", token, page-1)))
+	}
+	if next {
+		row = append(row, *nextPageButton.With(fmt.Sprintf("%s:%d", token, page+1)))
+	}
+	return row
+}
+
+// pageMarkup returns the vote buttons of the quotes of a page and the page
+// buttons below them
+func pageMarkup(quotes []c.QuoteResponse, navigation []tb.InlineButton) *tb.ReplyMarkup {
+	markup := voteMarkup(quotes)
+	if len(navigation) > 0 {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, navigation)
+	}
+	return markup
+}
+
+// listingPage fetches the quotes of a page of the listing and returns the
+// ones fitting in its message, with the offset of the next page, -1 after the
+// last one
+func listingPage(ctx context.Context, l listing, page int) ([]c.QuoteResponse, string, int, error) {
+	start := l.starts[page]
+	n := l.limit - start
+	if n > pageSize+1 {
+		n = pageSize + 1
+	}
+	var quotes []c.QuoteResponse
+	if n > 0 {
+		var err error
+		quotes, err = l.fetch(ctx, start, n)
+		if err != nil {
+			return nil, "", -1, err
+		}
+	}
+
+	shown := quotes
+	if len(shown) > pageSize {
+		shown = shown[:pageSize]
+	}
+	// The page holds the quotes fitting in its message
+	messages, err := renderQuotes(shown, messageLimit)
+	if err != nil {
+		return nil, "", -1, err
+	}
+	shown = messages[0].Quotes
+	if len(shown) < len(quotes) {
+		return shown, messages[0].Text, start + len(shown), nil
+	}
+	return shown, messages[0].Text, -1, nil
+}
+
+// sendListing sends the first page of the quotes listed by a command, with
+// the buttons turning its pages. The quotes fitting in a single page are sent
+// as usual.
+func (s *Server) sendListing(ctx context.Context, to *tb.Chat, limit int, fetch listQuotes) (*tb.Message, error) {
+	l := listing{fetch: fetch, chatID: groupID(ctx), limit: limit, starts: []int{0}}
+	quotes, response, next, err := listingPage(ctx, l, 0)
+	if err != nil {
+		return nil, err
+	}
+	if next < 0 {
+		return s.sendQuotes(ctx, to, quotes)
+	}
+
+	token, err := s.listings.add(l)
+	if err != nil {
+		s.Logger.Error("failed to keep a listing", zap.Error(err))
+		return nil, err
+	}
+	sent, err := s.sendText(to, response, pageMarkup(quotes, pageButtons(token, 0, true)))
+	if err != nil {
+		return sent, err
+	}
+	s.listings.show(token, 0, next, messageKey{chatID: sent.Chat.ID, messageID: sent.ID})
+	s.recordPost(ctx, sent, quotes, false)
+	return sent, nil
+}
+
+// PageButton edits the message of a listing to show the page of the button
+func (s *Server) PageButton(ctx context.Context, cb *tb.Callback) (*tb.CallbackResponse, error) {
+	separator := strings.LastIndex(cb.Data, ":")
+	if separator < 0 || cb.Message == nil {
+		return &tb.CallbackResponse{Text: "Cannot turn the page of this message"}, nil
+	}
+	token := cb.Data[:separator]
+	page, err := strconv.Atoi(cb.Data[separator+1:])
+	if err != nil {
+		return &tb.CallbackResponse{Text: "Cannot turn the page of this message"}, err
+	}
+	l, ok := s.listings.get(token)
+	if !ok || page < 0 || page >= len(l.starts) {
+		return &tb.CallbackResponse{Text: "This listing has expired, send the command again", ShowAlert: true}, nil
+	}
+
+	// The listing stays in its group, whichever group the DMs of the user go to
+	group, member, err := s.memberOf(l.chatID, cb.Sender)
+	if err != nil {
+		s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", group), zap.Any("user", cb.Sender))
+		return nil, err
+	}
+	if group == nil || !isAtLeastMember(member) {
+		return &tb.CallbackResponse{Text: "You must be at least a registered member to do this.", ShowAlert: true}, nil
+	}
+
+	quotes, response, next, err := listingPage(ctx, l, page)
+	if err != nil {
+		s.Logger.Error("failed to get a page of quotes", zap.Error(err), zap.Int("page", page))
+		return &tb.CallbackResponse{Text: "Cannot show this page"}, err
+	}
+	_, err = s.editText(cb.Message, response, pageMarkup(quotes, pageButtons(token, page, next >= 0)))
+	if err != nil && !errors.Is(err, tb.ErrMessageNotModified) && !errors.Is(err, tb.ErrSameMessageContent) {
+		s.Logger.Error("failed to edit a listing", zap.Error(err), zap.Int("page", page))
+		return &tb.CallbackResponse{Text: "Cannot show this page"}, err
+	}
+	s.listings.show(token, page, next, messageKey{chatID: cb.Message.Chat.ID, messageID: cb.Message.ID})
+	if len(quotes) > 0 {
+		s.recordPost(ctx, cb.Message, quotes, false)
+	}
+	return &tb.CallbackResponse{Text: fmt.Sprintf("Page %d", page+1)}, nil
+}
@@ -0,0 +1,97 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	c "goquotebot/pkg/storages"
+)
+
+// numbered returns n quotes numbered from 1, each content as long as given
+func numbered(n, length int) []c.QuoteResponse {
+	quotes := make([]c.QuoteResponse, n)
+	for i := range quotes {
+		quotes[i] = c.QuoteResponse{QuoteID: i + 1, Content: strings.Repeat("é", length), QuoteContext: "Alice"}
+	}
+	return quotes
+}
+
+func TestListingPage(t *testing.T) {
+	ctx := context.Background()
+	quotes := numbered(25, 20)
+	var requested []string
+	l := listing{limit: 25, starts: []int{0}, fetch: func(ctx context.Context, offset, n int) ([]c.QuoteResponse, error) {
+		requested = append(requested, fmt.Sprintf("%d+%d", offset, n))
+		if offset >= len(quotes) {
+			return nil, nil
+		}
+		end := offset + n
+		if end > len(quotes) {
+			end = len(quotes)
+		}
+		return quotes[offset:end], nil
+	}}
+
+	var pages []string
+	for page := 0; ; page++ {
+		shown, _, next, err := listingPage(ctx, l, page)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		pages = append(pages, fmt.Sprintf("%d-%d", shown[0].QuoteID, shown[len(shown)-1].QuoteID))
+		if next < 0 {
+			break
+		}
+		l.starts = append(l.starts, next)
+	}
+	if fmt.Sprint(pages) != "[1-10 11-20 21-25]" {
+		t.Errorf("got pages %v", pages)
+	}
+	// One more quote tells whether a next page follows, the limit is kept
+	if fmt.Sprint(requested) != "[0+11 10+11 20+5]" {
+		t.Errorf("got requests %v", requested)
+	}
+}
+
+func TestListings(t *testing.T) {
+	var l listings
+	token, err := l.add(listing{chatID: -100, limit: 30, starts: []int{0}})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	message := messageKey{chatID: -100, messageID: 42}
+	if row := l.navigation(message); row != nil {
+		t.Errorf("got %v for a message showing no listing", row)
+	}
+
+	l.show(token, 0, 10, message)
+	row := l.navigation(message)
+	if len(row) != 1 || row[0].Unique != nextPageButton.Unique || row[0].Data != token+":1" {
+		t.Errorf("got %+v, wanted the next page button", row)
+	}
+	l.show(token, 1, 20, message)
+	row = l.navigation(message)
+	if len(row) != 2 || row[0].Data != token+":0" || row[1].Data != token+":2" {
+		t.Errorf("got %+v, wanted both page buttons", row)
+	}
+	// The last page has no next one
+	l.show(token, 2, -1, message)
+	listed, ok := l.get(token)
+	if !ok || fmt.Sprint(listed.starts) != "[0 10 20]" || listed.page != 2 {
+		t.Errorf("got %+v, wanted the three pages", listed)
+	}
+	if row = l.navigation(message); len(row) != 1 || row[0].Unique != previousPageButton.Unique {
+		t.Errorf("got %+v, wanted the previous page button", row)
+	}
+
+	l.entries[token].expires = time.Now().Add(-time.Second)
+	if _, ok = l.get(token); ok {
+		t.Errorf("got an expired listing")
+	}
+	if row = l.navigation(message); row != nil {
+		t.Errorf("got %v for an expired listing", row)
+	}
+}
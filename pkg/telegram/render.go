@@ -0,0 +1,297 @@
+package telegram
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	c "goquotebot/pkg/storages"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// quoteSeparator is the line between the quotes of a message
+const quoteSeparator = "\n__________________\n\n"
+
+// ellipsis ends the texts cut to fit in a message
+const ellipsis = "…"
+
+var (
+	// regexTag matches the HTML tags of a message, a tag cut at its end included
+	regexTag = regexp.MustCompile(`<[^<>]*(>|$)`)
+	// regexMarkup matches the whole HTML tags and entities of a message
+	regexMarkup = regexp.MustCompile(`<[^<>]*>|&#?\w+;`)
+)
+
+// renderedMessage is a message of quotes as rendered, with the quotes it holds
+type renderedMessage struct {
+	Quotes []c.QuoteResponse
+	Text   string
+}
+
+// textLength is the length of a text as Telegram counts it, in UTF-16 code units
+func textLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// cutText splits the text after as many runes as fit in the limit
+func cutText(text string, limit int) (string, string) {
+	length := 0
+	for i, r := range text {
+		length += len(utf16.Encode([]rune{r}))
+		if length > limit {
+			return text[:i], text[i:]
+		}
+	}
+	return text, ""
+}
+
+// truncateText cuts the text to fit in the limit, ending it with an ellipsis
+// when it was too long
+func truncateText(text string, limit int) string {
+	if textLength(text) <= limit {
+		return text
+	}
+	head, _ := cutText(text, limit-textLength(ellipsis))
+	return head + ellipsis
+}
+
+// splitText splits an HTML text in messages fitting in the limit, between its
+// lines when it can and within the lines too long, but never inside a tag or an
+// entity. The tags open where it is split are closed at the end of a message
+// and opened again at the start of the next one.
+func splitText(text string, limit int) []string {
+	tokens := htmlTokens(text)
+	var messages []string
+	var open []string
+	for start := 0; ; {
+		prefix := strings.Join(open, "")
+		length := textLength(prefix)
+		stack := append([]string(nil), open...)
+		// The message ends after its last line fitting, or its last token
+		lineEnd, tokenEnd := -1, start
+		var lineStack, tokenStack []string
+		end := start
+		for ; end < len(tokens); end++ {
+			length += textLength(tokens[end])
+			stack = applyTag(stack, tokens[end])
+			if length+textLength(closingTags(stack)) > limit {
+				break
+			}
+			tokenEnd, tokenStack = end+1, append([]string(nil), stack...)
+			if tokens[end] == "\n" {
+				lineEnd, lineStack = end+1, tokenStack
+			}
+		}
+		if end == len(tokens) {
+			return append(messages, prefix+strings.Join(tokens[start:], "")+closingTags(stack))
+		}
+
+		cut, cutStack := tokenEnd, tokenStack
+		if lineEnd > start {
+			cut, cutStack = lineEnd, lineStack
+		}
+		if cut == start {
+			// A single tag longer than the limit, sent as it is
+			cut, cutStack = start+1, applyTag(append([]string(nil), open...), tokens[start])
+		}
+		body := strings.TrimRight(strings.Join(tokens[start:cut], ""), "\n")
+		messages = append(messages, prefix+body+closingTags(cutStack))
+		start, open = cut, cutStack
+	}
+}
+
+// htmlTokens splits an HTML text in its tags, its entities and the runes of
+// its text
+func htmlTokens(text string) []string {
+	var tokens []string
+	last := 0
+	for _, bounds := range regexMarkup.FindAllStringIndex(text, -1) {
+		for _, r := range text[last:bounds[0]] {
+			tokens = append(tokens, string(r))
+		}
+		tokens = append(tokens, text[bounds[0]:bounds[1]])
+		last = bounds[1]
+	}
+	for _, r := range text[last:] {
+		tokens = append(tokens, string(r))
+	}
+	return tokens
+}
+
+// applyTag returns the opening tags still open after the token
+func applyTag(open []string, token string) []string {
+	if !strings.HasPrefix(token, "<") {
+		return open
+	}
+	if !strings.HasPrefix(token, "</") {
+		return append(open, token)
+	}
+	name := tagName(token)
+	for i := len(open) - 1; i >= 0; i-- {
+		if tagName(open[i]) == name {
+			return append(open[:i], open[i+1:]...)
+		}
+	}
+	return open
+}
+
+// tagName returns the name of an opening or closing tag
+func tagName(tag string) string {
+	name := strings.TrimLeft(tag, "</")
+	end := strings.IndexAny(name, " \t\n>")
+	if end < 0 {
+		return name
+	}
+	return name[:end]
+}
+
+// closingTags closes the open tags, the last opened first
+func closingTags(open []string) string {
+	var closing strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		closing.WriteString("</" + tagName(open[i]) + ">")
+	}
+	return closing.String()
+}
+
+// renderQuote renders the quote as a block of a message. The longest of its
+// texts is cut until the block fits in the limit.
+func renderQuote(quote c.QuoteResponse, limit int) (string, error) {
+	quote.Lines = append([]c.QuoteLine(nil), quote.Lines...)
+	for {
+		var buf bytes.Buffer
+		err := templates["quote.tmpl"].Execute(&buf, quote)
+		if err != nil {
+			return "", err
+		}
+		block := buf.String()
+		excess := textLength(block) - limit
+		if excess <= 0 {
+			return block, nil
+		}
+
+		longest := &quote.QuoteContext
+		if len(quote.Lines) == 0 && textLength(quote.Content) > textLength(*longest) {
+			longest = &quote.Content
+		}
+		for i := range quote.Lines {
+			if textLength(quote.Lines[i].Content) > textLength(*longest) {
+				longest = &quote.Lines[i].Content
+			}
+		}
+		length := textLength(*longest)
+		if length <= textLength(ellipsis) {
+			// Nothing left to cut but the layout of the quote
+			head, _ := cutText(block, limit)
+			return head, nil
+		}
+		if excess >= length {
+			excess = length - textLength(ellipsis)
+		}
+		*longest = truncateText(*longest, length-excess)
+	}
+}
+
+// renderQuotes renders the quotes in as few messages fitting in the limit as
+// they need, split between the quotes
+func renderQuotes(quotes []c.QuoteResponse, limit int) ([]renderedMessage, error) {
+	if len(quotes) == 0 {
+		return []renderedMessage{{Text: "No quote available"}}, nil
+	}
+
+	var messages []renderedMessage
+	var current renderedMessage
+	for _, quote := range quotes {
+		block, err := renderQuote(quote, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(current.Quotes) > 0 && textLength(current.Text+quoteSeparator+block) <= limit {
+			current.Quotes = append(current.Quotes, quote)
+			current.Text += quoteSeparator + block
+			continue
+		}
+		if len(current.Quotes) > 0 {
+			messages = append(messages, current)
+		}
+		current = renderedMessage{Quotes: []c.QuoteResponse{quote}, Text: block}
+	}
+	return append(messages, current), nil
+}
+
+// renderPost renders the quotes of a posted message again in a single message
+// fitting in the limit, the quotes sharing it when their new scores no longer
+// let them fit together
+func renderPost(quotes []c.QuoteResponse, limit int) (string, error) {
+	messages, err := renderQuotes(quotes, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 1 {
+		return messages[0].Text, nil
+	}
+
+	budget := (limit - (len(quotes)-1)*textLength(quoteSeparator)) / len(quotes)
+	blocks := make([]string, 0, len(quotes))
+	for _, quote := range quotes {
+		block, err := renderQuote(quote, budget)
+		if err != nil {
+			return "", err
+		}
+		blocks = append(blocks, block)
+	}
+	return strings.Join(blocks, quoteSeparator), nil
+}
+
+// isFormattingError tells whether Telegram rejected the HTML of a message
+func isFormattingError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't parse entities")
+}
+
+// plainText drops the formatting of an HTML message, its text escaped again
+// to be shown as it is
+func plainText(text string) string {
+	return html.EscapeString(html.UnescapeString(regexTag.ReplaceAllString(text, "")))
+}
+
+// withPlainText sends a formatted text, and sends it again as plain text when
+// Telegram rejects its formatting
+func (s *Server) withPlainText(text string, send func(text string) (*tb.Message, error)) (*tb.Message, error) {
+	sent, err := send(text)
+	if isFormattingError(err) {
+		s.Logger.Warn("formatting rejected, sending plain text", zap.Error(err), zap.String("text", text))
+		return send(plainText(text))
+	}
+	return sent, err
+}
+
+// sendText sends a text in as many messages as it needs, the options going
+// with the last one
+func (s *Server) sendText(to tb.Recipient, text string, options ...interface{}) (*tb.Message, error) {
+	messages := splitText(strings.TrimSpace(text), messageLimit)
+	for i, message := range messages {
+		var messageOptions []interface{}
+		if i == len(messages)-1 {
+			messageOptions = options
+		}
+		sent, err := s.withPlainText(message, func(text string) (*tb.Message, error) {
+			return s.Bot.Send(to, text, messageOptions...)
+		})
+		if err != nil || i == len(messages)-1 {
+			return sent, err
+		}
+	}
+	return nil, nil
+}
+
+// editText edits a message with a formatted text, as plain text when Telegram
+// rejects its formatting
+func (s *Server) editText(message tb.Editable, text string, options ...interface{}) (*tb.Message, error) {
+	return s.withPlainText(text, func(text string) (*tb.Message, error) {
+		return s.Bot.Edit(message, text, options...)
+	})
+}
@@ -0,0 +1,348 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"goquotebot/pkg/search"
+	c "goquotebot/pkg/storages"
+)
+
+// nastyQuotes are texts that broke the formatting of the messages, or could
+var nastyQuotes = []string{
+	"*bold* _italic_ `code` ~strike~",
+	"```\nfenced\n```",
+	"unclosed *star, _underscore and `backtick",
+	"snake_case_name and 2*3*4",
+	"\\_escaped\\_ \\* and a trailing backslash \\",
+	"[link](http://example.com) and ![image](x.png)",
+	"<b>not bold</b> <script>alert(1)</script>",
+	"a < b > c, <3 and -->",
+	"Tom & Jerry &amp; &lt; &#43; &unknown;",
+	"'single' \"double\" `back`",
+	"1 + 1 = 2 {+the+} [-a-]",
+	"#hashtag @mention /command",
+	"emoji 👍🏽 family 👨‍👩‍👧 flag 🇫🇷",
+	"combining ü̈ and zero\u200bwidth",
+	"tabs\tand\r\nnewlines\n\n\n",
+}
+
+// regexEntity matches the tags and entities Telegram accepts in HTML, and the
+// characters it rejects outside of them
+var regexEntity = regexp.MustCompile(`<(/?)(b|i|code|pre)>|&(lt|gt|amp|quot|#[0-9]+);|[<>&]`)
+
+// checkHTML fails when Telegram would reject the HTML of the message
+func checkHTML(message string) error {
+	var open []string
+	for _, match := range regexEntity.FindAllStringSubmatch(message, -1) {
+		switch {
+		case match[2] != "" && match[1] == "":
+			open = append(open, match[2])
+		case match[2] != "":
+			if len(open) == 0 || open[len(open)-1] != match[2] {
+				return fmt.Errorf("unexpected </%s> in %q", match[2], message)
+			}
+			open = open[:len(open)-1]
+		case match[3] == "":
+			return fmt.Errorf("unescaped %q in %q", match[0], message)
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("unclosed %v in %q", open, message)
+	}
+	return nil
+}
+
+func TestTextLength(t *testing.T) {
+	samples := map[string]int{"": 0, "abc": 3, "café": 4, "😀": 2, "👍 #Q4": 6}
+	for text, expected := range samples {
+		if length := textLength(text); length != expected {
+			t.Errorf("got %d for %q, wanted %d", length, text, expected)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	samples := []struct {
+		Input    string
+		Limit    int
+		Expected string
+	}{
+		{Input: "coffee", Limit: 6, Expected: "coffee"},
+		{Input: "coffee", Limit: 4, Expected: "cof…"},
+		{Input: "café crème", Limit: 5, Expected: "café…"},
+		// A character out of the BMP counts twice and is never split
+		{Input: "ab😀cd", Limit: 4, Expected: "ab…"},
+		{Input: "ab😀cd", Limit: 5, Expected: "ab😀…"},
+	}
+
+	for _, sample := range samples {
+		got := truncateText(sample.Input, sample.Limit)
+		if got != sample.Expected || !utf8.ValidString(got) {
+			t.Errorf("got %q for %q under %d, wanted %q", got, sample.Input, sample.Limit, sample.Expected)
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	samples := []struct {
+		Input    string
+		Limit    int
+		Expected []string
+	}{
+		{Input: "one\ntwo", Limit: 10, Expected: []string{"one\ntwo"}},
+		{Input: "one\ntwo\nthree", Limit: 8, Expected: []string{"one\ntwo", "three"}},
+		{Input: "one\nécrémé\ntwo", Limit: 4, Expected: []string{"one", "écré", "mé", "two"}},
+		{Input: "😀😀😀", Limit: 3, Expected: []string{"😀", "😀", "😀"}},
+		{Input: "", Limit: 4, Expected: []string{""}},
+		// The tags open at a split are closed and opened again
+		{Input: "<b>one</b>\n<b>two</b>", Limit: 12, Expected: []string{"<b>one</b>", "<b>two</b>"}},
+		{Input: "<pre>one\ntwo</pre>", Limit: 16, Expected: []string{"<pre>one</pre>", "<pre>two</pre>"}},
+		{Input: "<i>abcdef</i>", Limit: 11, Expected: []string{"<i>abcd</i>", "<i>ef</i>"}},
+		// Entities are never cut
+		{Input: "a &amp; b", Limit: 5, Expected: []string{"a ", "&amp;", " b"}},
+	}
+
+	for _, sample := range samples {
+		got := splitText(sample.Input, sample.Limit)
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", sample.Expected) {
+			t.Errorf("got %q for %q under %d, wanted %q", got, sample.Input, sample.Limit, sample.Expected)
+		}
+	}
+}
+
+func TestSplitHTML(t *testing.T) {
+	// A long history: a block of lines holding entities
+	line := html.EscapeString("<b> & 'quoted' ")
+	text := "<b>History</b>\n<pre>" + strings.Repeat(line+"\n", 500) + "</pre>"
+	messages := splitText(text, messageLimit)
+	if len(messages) < 2 {
+		t.Fatalf("got %d messages, wanted the text split", len(messages))
+	}
+	for _, message := range messages {
+		if textLength(message) > messageLimit {
+			t.Errorf("got a message of %d, over the limit", textLength(message))
+		}
+		if err := checkHTML(message); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRenderQuote(t *testing.T) {
+	samples := []struct {
+		Name  string
+		Quote c.QuoteResponse
+	}{
+		{Name: "content", Quote: c.QuoteResponse{QuoteID: 1, Content: strings.Repeat("é", 5000), QuoteContext: "Alice"}},
+		{Name: "emoji", Quote: c.QuoteResponse{QuoteID: 2, Content: strings.Repeat("😀", 3000), QuoteContext: "Alice"}},
+		{Name: "context", Quote: c.QuoteResponse{QuoteID: 3, Content: "Hi", QuoteContext: strings.Repeat("Bob", 2000)}},
+		{Name: "dialogue", Quote: c.QuoteResponse{QuoteID: 4, Lines: []c.QuoteLine{
+			{Speaker: "Alice", Content: strings.Repeat("a", 3000)},
+			{Speaker: "Bob", Content: strings.Repeat("b", 3000)},
+		}}},
+	}
+
+	for _, sample := range samples {
+		block, err := renderQuote(sample.Quote, messageLimit)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if textLength(block) > messageLimit || !utf8.ValidString(block) {
+			t.Errorf("%s: got a block of %d, over the limit or broken", sample.Name, textLength(block))
+		}
+		if !strings.Contains(block, ellipsis) || !strings.HasPrefix(block, fmt.Sprintf("#Q%d ", sample.Quote.QuoteID)) {
+			t.Errorf("%s: got %.40q…, wanted the quote cut", sample.Name, block)
+		}
+	}
+
+	// The lines of the quote are left as they were
+	lines := samples[3].Quote.Lines
+	if len(lines[0].Content) != 3000 || len(lines[1].Content) != 3000 {
+		t.Errorf("the lines of the quote should not have been cut")
+	}
+
+	block, err := renderQuote(c.QuoteResponse{QuoteID: 5, Content: "Short", QuoteContext: "Bob"}, messageLimit)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	if block != "#Q5 (+0)\n<b>Short</b>\n\n<i>by Bob</i>" {
+		t.Errorf("got %q, wanted the quote as it is", block)
+	}
+}
+
+func TestRenderQuotes(t *testing.T) {
+	samples := []struct {
+		Name     string
+		Quotes   []c.QuoteResponse
+		Expected []int
+	}{
+		{Name: "none", Quotes: nil, Expected: []int{0}},
+		{Name: "short quotes", Quotes: numbered(10, 20), Expected: []int{10}},
+		{Name: "long quotes", Quotes: numbered(5, 1500), Expected: []int{2, 2, 1}},
+		{Name: "quotes too long", Quotes: numbered(2, 5000), Expected: []int{1, 1}},
+	}
+
+	for _, sample := range samples {
+		messages, err := renderQuotes(sample.Quotes, messageLimit)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		var got []int
+		var IDs []int
+		for _, message := range messages {
+			got = append(got, len(message.Quotes))
+			for _, quote := range message.Quotes {
+				IDs = append(IDs, quote.QuoteID)
+			}
+			if textLength(message.Text) > messageLimit {
+				t.Errorf("%s: got a message of %d, over the limit", sample.Name, textLength(message.Text))
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(sample.Expected) {
+			t.Errorf("%s: got messages of %v quotes, wanted %v", sample.Name, got, sample.Expected)
+		}
+		if len(IDs) != len(sample.Quotes) {
+			t.Errorf("%s: got quotes %v, wanted all of them in order", sample.Name, IDs)
+		}
+	}
+
+	messages, err := renderQuotes(nil, messageLimit)
+	if err != nil || messages[0].Text != "No quote available" {
+		t.Errorf("got %v, %v, wanted no quote available", messages, err)
+	}
+}
+
+func TestRenderPost(t *testing.T) {
+	samples := []struct {
+		Name   string
+		Quotes []c.QuoteResponse
+		Limit  int
+	}{
+		{Name: "short quotes", Quotes: numbered(3, 20), Limit: messageLimit},
+		{Name: "long quotes", Quotes: numbered(5, 1500), Limit: messageLimit},
+		{Name: "long caption", Quotes: numbered(2, 600), Limit: captionLimit},
+	}
+
+	for _, sample := range samples {
+		text, err := renderPost(sample.Quotes, sample.Limit)
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		if textLength(text) > sample.Limit {
+			t.Errorf("%s: got a post of %d, over the limit of %d", sample.Name, textLength(text), sample.Limit)
+		}
+		if blocks := strings.Count(text, quoteSeparator) + 1; blocks != len(sample.Quotes) {
+			t.Errorf("%s: got %d quotes, wanted %d", sample.Name, blocks, len(sample.Quotes))
+		}
+	}
+}
+
+func TestRenderPostError(t *testing.T) {
+	quoteTemplate := templates["quote.tmpl"]
+	defer func() { templates["quote.tmpl"] = quoteTemplate }()
+	templates["quote.tmpl"] = template.Must(template.New("quote.tmpl").Parse("{{ .Missing }}"))
+
+	_, err := renderPost(numbered(2, 20), messageLimit)
+	if err == nil {
+		t.Errorf("an error should have occured")
+	}
+}
+
+func TestNastyQuotes(t *testing.T) {
+	for _, nasty := range nastyQuotes {
+		quote := c.QuoteResponse{QuoteID: 1, Content: nasty, QuoteContext: nasty, Tags: []string{"work"}}
+		dialogue := c.QuoteResponse{QuoteID: 2, Content: nasty, Lines: []c.QuoteLine{{Speaker: nasty, Content: nasty}, {Speaker: "Bob", Content: nasty}}}
+
+		var messages []string
+		text, err := GenerateQuotesMessage([]c.QuoteResponse{quote, dialogue})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		messages = append(messages, text)
+		for _, generate := range []func(c.QuoteResponse) (string, error){GenerateNewQuoteMessage, GenerateEditedQuoteMessage, GenerateRestoredQuoteMessage} {
+			text, err = generate(quote)
+			if err != nil {
+				t.Fatalf("error %v should not have occured", err)
+			}
+			messages = append(messages, text)
+		}
+		request := c.AddQuoteRequest{Content: nasty, QuoteContext: nasty}
+		for _, generate := range []func(c.AddQuoteRequest) (string, error){GenerateForbiddenContextMessage, func(quote c.AddQuoteRequest) (string, error) {
+			return GenerateDuplicateQuoteMessage(quote, c.ErrProbableDuplicate{Matches: []search.Match{{QuoteID: 1, Similarity: 0.9}}})
+		}} {
+			text, err = generate(request)
+			if err != nil {
+				t.Fatalf("error %v should not have occured", err)
+			}
+			messages = append(messages, text)
+		}
+		text, err = GenerateSpeakersMessage([]c.SpeakerResponse{{Name: nasty, Aliases: []string{nasty}, Quotes: 1}})
+		if err != nil {
+			t.Fatalf("error %v should not have occured", err)
+		}
+		messages = append(messages, text)
+
+		for _, message := range messages {
+			if err = checkHTML(message); err != nil {
+				t.Errorf("%q: %v", nasty, err)
+			}
+			// The text shows as it was written
+			shown := html.UnescapeString(regexTag.ReplaceAllString(message, ""))
+			if !strings.Contains(shown, nasty) {
+				t.Errorf("%q is not shown as it is in %q", nasty, shown)
+			}
+			if err = checkHTML(plainText(message)); err != nil {
+				t.Errorf("%q as plain text: %v", nasty, err)
+			}
+		}
+	}
+
+	// Quotes cut to fit in a message keep their formatting and entities whole
+	long := c.QuoteResponse{QuoteID: 3, Content: strings.Repeat("<&>\"", 3000), QuoteContext: strings.Repeat("_*`", 10)}
+	rendered, err := renderQuotes([]c.QuoteResponse{long, long}, messageLimit)
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	for _, message := range rendered {
+		if err = checkHTML(message.Text); err != nil || textLength(message.Text) > messageLimit {
+			t.Errorf("got a message of %d: %v", textLength(message.Text), err)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	samples := map[string]string{
+		"<b>Coffee</b> &amp; <i>tea</i>": "Coffee &amp; tea",
+		"<b>1 &lt; 2</b>":                "1 &lt; 2",
+		"cut in a <b":                    "cut in a ",
+		"it&#39;s &#43;1":                "it&#39;s +1",
+	}
+	for input, expected := range samples {
+		if got := plainText(input); got != expected {
+			t.Errorf("got %q for %q, wanted %q", got, input, expected)
+		}
+	}
+}
+
+func TestIsFormattingError(t *testing.T) {
+	samples := []struct {
+		Input    error
+		Expected bool
+	}{
+		{Input: nil, Expected: false},
+		{Input: errors.New("telegram unknown: Bad Request: can't parse entities: Unsupported start tag \"x\" at byte offset 4 (400)"), Expected: true},
+		{Input: errors.New("telegram: message is too long (400)"), Expected: false},
+	}
+	for _, sample := range samples {
+		if got := isFormattingError(sample.Input); got != sample.Expected {
+			t.Errorf("got %v for %v, wanted %v", got, sample.Input, sample.Expected)
+		}
+	}
+}
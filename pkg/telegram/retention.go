@@ -0,0 +1,37 @@
+package telegram
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// trashPurgeInterval is how often the trash is checked for expired quotes
+const trashPurgeInterval = time.Hour
+
+// purgeTrash deletes for good the quotes trashed for longer than the
+// retention, until the server stops
+func (s *Server) purgeTrash() {
+	defer s.jobs.Done()
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := s.NewRequestContext()
+		purged, err := (*s.DB).PurgeTrash(ctx, s.retention)
+		cancel()
+		if err != nil {
+			s.Logger.Error("failed to purge the trash", zap.Error(err), zap.Duration("retention", s.retention))
+		} else if purged > 0 {
+			s.Logger.Info("purged the trash", zap.Int("quotes", purged), zap.Duration("retention", s.retention))
+			quotesPurged.Add(float64(purged))
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package telegram
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -8,10 +9,27 @@ import (
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
+// Handler answers a message, ctx is canceled when the request times out or the server stops
+type Handler func(ctx context.Context, m *tb.Message) (*tb.Message, error)
+
+// CallbackHandler answers a button press with the response shown to the user,
+// ctx is canceled when the request times out or the server stops
+type CallbackHandler func(ctx context.Context, c *tb.Callback) (*tb.CallbackResponse, error)
+
+// QueryHandler answers an inline query with the results shown to the user,
+// ctx is canceled when the request times out or the server stops
+type QueryHandler func(ctx context.Context, q *tb.Query) (*tb.QueryResponse, error)
+
+// SuperButton is an inline button and the handler of its presses
+type SuperButton struct {
+	Button  *tb.InlineButton
+	Handler CallbackHandler
+}
+
 type SuperCommand struct {
 	Command        tb.Command
-	Handler        func(*tb.Message) (*tb.Message, error)
-	AuthMiddleware func(*Server, *tb.Message, func(*tb.Message) (*tb.Message, error)) func(*tb.Message) (*tb.Message, error)
+	Handler        Handler
+	AuthMiddleware func(*Server, *tb.Message, Handler) Handler
 }
 
 func (server *Server) RegisterRoutes() error {
@@ -20,15 +38,31 @@ func (server *Server) RegisterRoutes() error {
 		{
 			Command: tb.Command{
 				Text:        "add",
-				Description: "Usage : /add quote | context",
+				Description: "Usage : /add quote | context | tag1,tag2 with optional tags, /add followed by Speaker: words lines for a dialogue, /add <n> in reply to a message, or /add context as the caption of a photo, voice note or video",
+			},
+			Handler:        server.AddQuote,
+			AuthMiddleware: MustBeMember,
+		},
+		{
+			Command: tb.Command{
+				Text:        "quote",
+				Description: "Usage : /quote <n> in reply to a message will quote it and the <n> - 1 messages following it",
 			},
 			Handler:        server.AddQuote,
 			AuthMiddleware: MustBeMember,
 		},
+		{
+			Command: tb.Command{
+				Text:        "addanyway",
+				Description: "Usage : /addanyway quote | context will add a quote even if it looks like a stored one",
+			},
+			Handler:        server.AddQuoteAnyway,
+			AuthMiddleware: MustBeMember,
+		},
 		{
 			Command: tb.Command{
 				Text:        "random",
-				Description: "Usage : /random <n> with <n> the number of random quotes to fetch",
+				Description: "Usage : /random <n> #tag with <n> the number of random quotes to fetch, tagged #tag if given",
 			},
 			Handler:        server.RandomQuotes,
 			AuthMiddleware: MustBeMember,
@@ -36,7 +70,7 @@ func (server *Server) RegisterRoutes() error {
 		{
 			Command: tb.Command{
 				Text:        "last",
-				Description: "Usage : /last <n> with <n> the number of last quotes to fetch",
+				Description: "Usage : /last <n> #tag with <n> the number of last quotes to fetch, tagged #tag if given",
 			},
 			Handler:        server.LastQuotes,
 			AuthMiddleware: MustBeMember,
@@ -49,6 +83,54 @@ func (server *Server) RegisterRoutes() error {
 			Handler:        server.DeleteQuote,
 			AuthMiddleware: MustBeAdministrator,
 		},
+		{
+			Command: tb.Command{
+				Text:        "trash",
+				Description: "Usage : /trash <n> will show the page <n> of the deleted quotes",
+			},
+			Handler:        server.TrashQuotes,
+			AuthMiddleware: MustBeAdministrator,
+		},
+		{
+			Command: tb.Command{
+				Text:        "restore",
+				Description: "Usage : /restore <id> will bring back the deleted <ID> quote",
+			},
+			Handler:        server.RestoreQuote,
+			AuthMiddleware: MustBeAdministrator,
+		},
+		{
+			Command: tb.Command{
+				Text:        "purge",
+				Description: "Usage : /purge <id> will delete the <ID> quote from the trash for good",
+			},
+			Handler:        server.PurgeQuote,
+			AuthMiddleware: MustBeAdministrator,
+		},
+		{
+			Command: tb.Command{
+				Text:        "edit",
+				Description: "Usage : /edit <id> quote | context, or Speaker: words lines, will replace the quote, if you added it or are an administrator",
+			},
+			Handler:        server.EditQuote,
+			AuthMiddleware: MustBeMember,
+		},
+		{
+			Command: tb.Command{
+				Text:        "history",
+				Description: "Usage : /history <id> will show the past versions of the <ID> quote",
+			},
+			Handler:        server.QuoteHistory,
+			AuthMiddleware: MustBeMember,
+		},
+		{
+			Command: tb.Command{
+				Text:        "rollback",
+				Description: "Usage : /rollback <id> <revision> will restore a past version of the <ID> quote",
+			},
+			Handler:        server.RollbackQuote,
+			AuthMiddleware: MustBeAdministrator,
+		},
 		{
 			Command: tb.Command{
 				Text:        "upvote",
@@ -76,7 +158,7 @@ func (server *Server) RegisterRoutes() error {
 		{
 			Command: tb.Command{
 				Text:        "top",
-				Description: "Usage : /top <n> will show the <n> most liked quotes",
+				Description: "Usage : /top <n> #tag will show the <n> most liked quotes, tagged #tag if given",
 			},
 			Handler:        server.TopQuotes,
 			AuthMiddleware: MustBeMember,
@@ -84,11 +166,59 @@ func (server *Server) RegisterRoutes() error {
 		{
 			Command: tb.Command{
 				Text:        "flop",
-				Description: "Usage : /flop <n> will show the <n> most disliked quotes",
+				Description: "Usage : /flop <n> #tag will show the <n> most disliked quotes, tagged #tag if given",
 			},
 			Handler:        server.FlopQuotes,
 			AuthMiddleware: MustBeMember,
 		},
+		{
+			Command: tb.Command{
+				Text:        "speakers",
+				Description: "Usage : /speakers will list the quoted people with their aliases",
+			},
+			Handler:        server.Speakers,
+			AuthMiddleware: MustBeMember,
+		},
+		{
+			Command: tb.Command{
+				Text:        "alias",
+				Description: "Usage : /alias <name> <canonical> will attribute the quotes by <name> to <canonical>",
+			},
+			Handler:        server.AliasSpeaker,
+			AuthMiddleware: MustBeAdministrator,
+		},
+		{
+			Command: tb.Command{
+				Text:        "mergespeakers",
+				Description: "Usage : /mergespeakers <from> <into> will move the quotes and aliases of <from> to <into>",
+			},
+			Handler:        server.MergeSpeakers,
+			AuthMiddleware: MustBeAdministrator,
+		},
+		{
+			Command: tb.Command{
+				Text:        "tag",
+				Description: "Usage : /tag <id> +tag -tag will add and remove tags on the <ID> quote",
+			},
+			Handler:        server.TagQuote,
+			AuthMiddleware: MustBeMember,
+		},
+		{
+			Command: tb.Command{
+				Text:        "tags",
+				Description: "Usage : /tags will list the tags with their number of quotes",
+			},
+			Handler:        server.Tags,
+			AuthMiddleware: MustBeMember,
+		},
+		{
+			Command: tb.Command{
+				Text:        "group",
+				Description: "Usage : /group will name the group your commands go to, and in private let you pick another one of your groups",
+			},
+			Handler:        server.Group,
+			AuthMiddleware: MustBeMember,
+		},
 		{
 			Command: tb.Command{
 				Text:        "s",
@@ -114,7 +244,7 @@ func (server *Server) RegisterRoutes() error {
 			server.Logger.Debug("command received", zap.String("command", m.Text), zap.Any("user", m.Sender), zap.Any("chat", m.Chat))
 			commandsReceived.With(prometheus.Labels{"command": h.Command.Text}).Inc()
 
-			content, err := h.AuthMiddleware(server, m, h.Handler)(m)
+			content, err := server.serve(m, h.AuthMiddleware(server, m, h.Handler))
 			if err != nil {
 				if content != nil {
 					server.Logger.Error("failed to send message", zap.Error(err), zap.Any("response", content))
@@ -132,11 +262,72 @@ func (server *Server) RegisterRoutes() error {
 		return err
 	}
 
+	buttons := []SuperButton{
+		{Button: &publishButton, Handler: server.PublishQuote},
+		{Button: &publishAnywayButton, Handler: server.PublishQuoteAnyway},
+		{Button: &discardButton, Handler: server.DiscardQuote},
+		{Button: &upVoteButton, Handler: server.UpVoteButton},
+		{Button: &downVoteButton, Handler: server.DownVoteButton},
+		{Button: &previousPageButton, Handler: server.PageButton},
+		{Button: &nextPageButton, Handler: server.PageButton},
+		{Button: &groupButton, Handler: server.GroupButton},
+	}
+	for _, button := range buttons {
+		h := button
+		server.Bot.Handle(h.Button, func(c *tb.Callback) {
+			server.Logger.Debug("button pressed", zap.String("button", h.Button.Unique), zap.Any("user", c.Sender))
+			commandsReceived.With(prometheus.Labels{"command": h.Button.Unique}).Inc()
+
+			err := server.serveCallback(c, h.Handler)
+			if err != nil {
+				server.Logger.Error("failed to answer a button", zap.Error(err), zap.String("button", h.Button.Unique))
+				commandsTriggers.With(prometheus.Labels{"command": h.Button.Unique, "status": "424"}).Inc()
+				return
+			}
+			commandsTriggers.With(prometheus.Labels{"command": h.Button.Unique, "status": "200"}).Inc()
+		})
+	}
+
+	server.Bot.Handle(tb.OnQuery, func(q *tb.Query) {
+		server.Logger.Debug("inline query received", zap.String("query", q.Text), zap.String("offset", q.Offset), zap.Any("user", q.From))
+		commandsReceived.With(prometheus.Labels{"command": "inline"}).Inc()
+
+		err := server.serveQuery(q, server.InlineQuery)
+		if err != nil {
+			server.Logger.Error("failed to answer an inline query", zap.Error(err), zap.String("query", q.Text))
+			commandsTriggers.With(prometheus.Labels{"command": "inline", "status": "424"}).Inc()
+			return
+		}
+		commandsTriggers.With(prometheus.Labels{"command": "inline", "status": "200"}).Inc()
+	})
+
+	// Only the media captioned with /add or /quote, or forwarded in DM, are
+	// quoted, the others do not go through the membership check
+	for _, event := range []string{tb.OnPhoto, tb.OnVoice, tb.OnVideo, tb.OnSticker} {
+		server.Bot.Handle(event, func(m *tb.Message) {
+			if !IsMediaQuote(m) {
+				return
+			}
+			server.Logger.Debug("media received", zap.String("caption", m.Caption), zap.Any("user", m.Sender), zap.Any("chat", m.Chat))
+			messagesReceived.Inc()
+
+			content, err := server.serve(m, MustBeMember(server, m, server.MediaMessage))
+			if err != nil {
+				if content != nil {
+					server.Logger.Error("failed to send message", zap.Error(err), zap.Any("response", content))
+				}
+				commandsTriggers.With(prometheus.Labels{"command": "media", "status": "424"}).Inc()
+				return
+			}
+			commandsTriggers.With(prometheus.Labels{"command": "media", "status": "200"}).Inc()
+		})
+	}
+
 	server.Bot.Handle(tb.OnText, func(m *tb.Message) {
 		server.Logger.Debug("command received", zap.String("command", m.Text), zap.Any("user", m.Sender), zap.Any("chat", m.Chat))
 		messagesReceived.Inc()
 
-		content, err := MustBeMember(server, m, server.Message)(m)
+		content, err := server.serve(m, MustBeMember(server, m, server.Message))
 		if err != nil {
 			if content != nil {
 				server.Logger.Error("failed to send message", zap.Error(err), zap.Any("response", content))
@@ -149,3 +340,54 @@ func (server *Server) RegisterRoutes() error {
 
 	return nil
 }
+
+// serve runs the handler within a per-update context, and keeps track of it until it returns
+func (server *Server) serve(m *tb.Message, h Handler) (*tb.Message, error) {
+	server.inFlight.Add(1)
+	defer server.inFlight.Done()
+
+	ctx, cancel := server.NewRequestContext()
+	defer cancel()
+
+	return h(ctx, m)
+}
+
+// serveCallback runs the handler within a per-update context like serve, and
+// always answers the callback so that the client stops waiting
+func (server *Server) serveCallback(c *tb.Callback, h CallbackHandler) error {
+	server.inFlight.Add(1)
+	defer server.inFlight.Done()
+
+	ctx, cancel := server.NewRequestContext()
+	defer cancel()
+
+	response, err := h(ctx, c)
+	if response == nil {
+		response = &tb.CallbackResponse{}
+	}
+	respondErr := server.Bot.Respond(c, response)
+	if err != nil {
+		return err
+	}
+	return respondErr
+}
+
+// serveQuery runs the handler of an inline query within a per-update context,
+// and answers it, with no result when the handler failed
+func (server *Server) serveQuery(q *tb.Query, h QueryHandler) error {
+	server.inFlight.Add(1)
+	defer server.inFlight.Done()
+
+	ctx, cancel := server.NewRequestContext()
+	defer cancel()
+
+	response, err := h(ctx, q)
+	if response == nil {
+		response = &tb.QueryResponse{Results: tb.Results{}, IsPersonal: true}
+	}
+	answerErr := server.Bot.Answer(q, response)
+	if err != nil {
+		return err
+	}
+	return answerErr
+}
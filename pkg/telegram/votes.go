@@ -0,0 +1,191 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	c "goquotebot/pkg/storages"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var (
+	upVoteButton   = tb.InlineButton{Unique: "upvotebutton", Text: "👍"}
+	downVoteButton = tb.InlineButton{Unique: "downvotebutton", Text: "👎"}
+)
+
+// voteMarkup returns the buttons voting for the quotes of a message, a row per
+// quote labelled with its ID when the message holds several. Their data is
+// the group and the ID of the quote, the message being possibly sent in DM.
+func voteMarkup(quotes []c.QuoteResponse) *tb.ReplyMarkup {
+	rows := make([][]tb.InlineButton, 0, len(quotes))
+	for _, quote := range quotes {
+		data := fmt.Sprintf("%d:%d", quote.ChatID, quote.QuoteID)
+		up, down := upVoteButton.With(data), downVoteButton.With(data)
+		if len(quotes) > 1 {
+			up.Text = fmt.Sprintf("%s #Q%d", up.Text, quote.QuoteID)
+			down.Text = fmt.Sprintf("%s #Q%d", down.Text, quote.QuoteID)
+		}
+		rows = append(rows, []tb.InlineButton{*up, *down})
+	}
+	return &tb.ReplyMarkup{InlineKeyboard: rows}
+}
+
+// UpVoteButton adds +1 vote to the quote of the button
+func (s *Server) UpVoteButton(ctx context.Context, cb *tb.Callback) (*tb.CallbackResponse, error) {
+	return s.voteButton(ctx, cb, true)
+}
+
+// DownVoteButton adds -1 vote to the quote of the button
+func (s *Server) DownVoteButton(ctx context.Context, cb *tb.Callback) (*tb.CallbackResponse, error) {
+	return s.voteButton(ctx, cb, false)
+}
+
+func (s *Server) voteButton(ctx context.Context, cb *tb.Callback, up bool) (*tb.CallbackResponse, error) {
+	chatID, quoteID, err := voteData(cb.Data)
+	if err != nil || cb.Message == nil {
+		return &tb.CallbackResponse{Text: "Cannot vote from this message"}, err
+	}
+	var group *tb.Chat
+	var member *tb.ChatMember
+	if chatID != 0 {
+		group, member, err = s.memberOf(chatID, cb.Sender)
+	} else {
+		// The buttons sent before the group was in their data
+		group, member, err = s.resolveGroup(&tb.Message{Sender: cb.Sender, Chat: cb.Message.Chat})
+	}
+	if err != nil {
+		s.Logger.Error("failed to check the status of a user", zap.Error(err), zap.Any("Chat", group), zap.Any("user", cb.Sender))
+		return nil, err
+	}
+	if group == nil || !isAtLeastMember(member) {
+		return &tb.CallbackResponse{Text: "You must be at least a registered member to do this.", ShowAlert: true}, nil
+	}
+
+	request := c.VoteQuoteRequest{
+		ChatID:  group.ID,
+		QuoteID: quoteID,
+		Voter:   cb.Sender.ID,
+	}
+	if up {
+		err = (*s.DB).UpVoteQuote(ctx, request)
+	} else {
+		err = (*s.DB).DownVoteQuote(ctx, request)
+	}
+	if errors.Is(err, c.ErrNotFound) {
+		return &tb.CallbackResponse{Text: fmt.Sprintf("The quote #Q%d does not exist anymore", quoteID)}, nil
+	}
+	if err != nil {
+		s.Logger.Error("failed to vote for a quote", zap.Error(err), zap.Any("vote quote request", request))
+		return &tb.CallbackResponse{Text: "Cannot register your vote"}, err
+	}
+	s.refreshPosts(ctx, request.ChatID, quoteID)
+
+	if up {
+		return &tb.CallbackResponse{Text: fmt.Sprintf("👍 Your vote for #Q%d has been registered", quoteID)}, nil
+	}
+	return &tb.CallbackResponse{Text: fmt.Sprintf("👎 Your vote for #Q%d has been registered", quoteID)}, nil
+}
+
+// voteData parses the group and the ID of the quote of a vote button, the
+// group being 0 for the buttons holding the ID only
+func voteData(data string) (int64, int, error) {
+	separator := strings.LastIndex(data, ":")
+	quoteID, err := strconv.Atoi(data[separator+1:])
+	if err != nil || separator < 0 {
+		return 0, quoteID, err
+	}
+	chatID, err := strconv.ParseInt(data[:separator], 10, 64)
+	return chatID, quoteID, err
+}
+
+// removedPost replaces the posts whose every quote has been deleted
+const removedPost = "🗑 Quote deleted 🗑"
+
+// refreshPosts edits the latest messages posting the quote to show its score,
+// or that it has been deleted
+func (s *Server) refreshPosts(ctx context.Context, chatID int64, quoteID int) {
+	posts, err := (*s.DB).GetPosts(ctx, c.UniqueSpecifiedQuoteRequest{ChatID: chatID, QuoteID: quoteID})
+	if err != nil {
+		s.Logger.Error("failed to get the posts of a quote", zap.Error(err), zap.Int("quoteID", quoteID))
+		return
+	}
+	for _, post := range posts {
+		err = s.editPost(ctx, chatID, post)
+		if err != nil {
+			s.Logger.Warn("failed to edit a post", zap.Error(err), zap.Any("post", post))
+		}
+	}
+}
+
+// editPost renders the quotes of the post again, the deleted ones left out,
+// with the page buttons of a listing. A post left without quotes loses its
+// buttons.
+func (s *Server) editPost(ctx context.Context, chatID int64, post c.PostResponse) error {
+	IDs := make([]string, 0, len(post.QuoteIDs))
+	positions := make(map[int]int, len(post.QuoteIDs))
+	for position, quoteID := range post.QuoteIDs {
+		IDs = append(IDs, strconv.Itoa(quoteID))
+		positions[quoteID] = position
+	}
+	quotes, err := (*s.DB).GetQuotes(ctx, c.MultipleSpecifiedQuotesRequest{ChatID: chatID, QuoteIDs: IDs})
+	if err != nil {
+		return err
+	}
+	message := tb.StoredMessage{MessageID: strconv.Itoa(post.MessageID), ChatID: post.PostChatID}
+	if len(quotes) == 0 {
+		return s.editPostText(message, post.Caption, removedPost)
+	}
+	sort.Slice(quotes, func(i, j int) bool {
+		return positions[quotes[i].QuoteID] < positions[quotes[j].QuoteID]
+	})
+
+	limit := messageLimit
+	if post.Caption {
+		limit = captionLimit
+	}
+	response, err := renderPost(quotes, limit)
+	if err != nil {
+		return err
+	}
+	markup := pageMarkup(quotes, s.listings.navigation(messageKey{chatID: post.PostChatID, messageID: post.MessageID}))
+	return s.editPostText(message, post.Caption, response, markup)
+}
+
+// editPostText edits the text or the caption of a post, the buttons it keeps
+// in the options. Without markup the buttons are removed.
+func (s *Server) editPostText(message tb.Editable, caption bool, text string, options ...interface{}) error {
+	var err error
+	if caption {
+		_, err = s.withPlainText(text, func(caption string) (*tb.Message, error) {
+			return s.Bot.EditCaption(message, caption, options...)
+		})
+	} else {
+		_, err = s.editText(message, text, options...)
+	}
+	// The score is the same when a vote is changed back
+	if errors.Is(err, tb.ErrMessageNotModified) || errors.Is(err, tb.ErrSameMessageContent) {
+		return nil
+	}
+	return err
+}
+
+// recordPost keeps the message posting the quotes to edit it after their votes
+func (s *Server) recordPost(ctx context.Context, sent *tb.Message, quotes []c.QuoteResponse, caption bool) {
+	if sent == nil || sent.Chat == nil {
+		return
+	}
+	request := c.AddPostRequest{ChatID: quotes[0].ChatID, PostChatID: sent.Chat.ID, MessageID: sent.ID, Caption: caption}
+	for _, quote := range quotes {
+		request.QuoteIDs = append(request.QuoteIDs, quote.QuoteID)
+	}
+	err := (*s.DB).AddPost(ctx, request)
+	if err != nil {
+		s.Logger.Error("failed to record a post", zap.Error(err), zap.Any("post", request))
+	}
+}
@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	c "goquotebot/pkg/storages"
+
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestVoteMarkup(t *testing.T) {
+	markup := voteMarkup([]c.QuoteResponse{{QuoteID: 4, ChatID: -100}})
+	if len(markup.InlineKeyboard) != 1 {
+		t.Fatalf("got %d rows, wanted 1", len(markup.InlineKeyboard))
+	}
+	row := markup.InlineKeyboard[0]
+	if row[0].Unique != upVoteButton.Unique || row[0].Data != "-100:4" || row[0].Text != "👍" || row[1].Unique != downVoteButton.Unique || row[1].Data != "-100:4" {
+		t.Errorf("got %+v, wanted the vote buttons of #Q4", row)
+	}
+
+	// The quotes of a message with several are told apart
+	markup = voteMarkup([]c.QuoteResponse{{QuoteID: 4}, {QuoteID: 5}})
+	var labels []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			labels = append(labels, button.Text+"="+button.Data)
+		}
+	}
+	expected := []string{"👍 #Q4=0:4", "👎 #Q4=0:4", "👍 #Q5=0:5", "👎 #Q5=0:5"}
+	if fmt.Sprint(labels) != fmt.Sprint(expected) {
+		t.Errorf("got %v, wanted %v", labels, expected)
+	}
+}
+
+func TestVoteData(t *testing.T) {
+	samples := []struct {
+		Input   string
+		ChatID  int64
+		QuoteID int
+		Error   bool
+	}{
+		{Input: "-100123:42", ChatID: -100123, QuoteID: 42},
+		// The buttons sent before the group was in their data
+		{Input: "42", QuoteID: 42},
+		{Input: "-100:nope", Error: true},
+		{Input: "group:42", QuoteID: 42, Error: true},
+	}
+
+	for _, sample := range samples {
+		chatID, quoteID, err := voteData(sample.Input)
+		if (err != nil) != sample.Error || (!sample.Error && (chatID != sample.ChatID || quoteID != sample.QuoteID)) {
+			t.Errorf("got %d %d %v for %q, wanted %d %d", chatID, quoteID, err, sample.Input, sample.ChatID, sample.QuoteID)
+		}
+	}
+}
+
+func TestRecordPost(t *testing.T) {
+	ctx := context.Background()
+	var db c.DB = c.NewMemoryStore()
+	first, err := db.AddQuote(ctx, c.AddQuoteRequest{ChatID: -100, Content: "Coffee first, questions later", QuoteContext: "Alice"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	second, err := db.AddQuote(ctx, c.AddQuoteRequest{ChatID: -100, Content: "Tea is just leaf soup", QuoteContext: "Bob"})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	s := &Server{DB: &db, Logger: zap.NewNop()}
+
+	s.recordPost(ctx, &tb.Message{ID: 500, Chat: &tb.Chat{ID: 1001}}, []c.QuoteResponse{first, second}, false)
+	// Nothing is recorded for the messages that failed
+	s.recordPost(ctx, nil, []c.QuoteResponse{first}, false)
+
+	posts, err := db.GetPosts(ctx, c.UniqueSpecifiedQuoteRequest{ChatID: -100, QuoteID: second.QuoteID})
+	if err != nil {
+		t.Fatalf("error %v should not have occured", err)
+	}
+	expected := fmt.Sprint([]c.PostResponse{{PostChatID: 1001, MessageID: 500, QuoteIDs: []int{first.QuoteID, second.QuoteID}}})
+	if fmt.Sprint(posts) != expected {
+		t.Errorf("got posts %v, wanted %v", posts, expected)
+	}
+}